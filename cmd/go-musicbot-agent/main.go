@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music/provider/mpv"
+	"github.com/svenwiltink/go-musicbot/pkg/music/provider/remote"
+)
+
+// go-musicbot-agent runs mpv next to the speakers, so a bot on another machine can play music
+// on them. Configure the agent in a zone of the bot with its address and token. The token is
+// sent in plain text unless the agent serves TLS with -tls-cert and -tls-key, the bot then
+// connects to wss://host:port/path instead of ws://.
+func main() {
+	listen := flag.String("listen", ":8100", "The address to listen on")
+	path := flag.String("path", "/agent", "The path the bot connects to")
+	token := flag.String("token", os.Getenv("MUSICBOT_AGENT_TOKEN"), "The token the bot must send, defaults to $MUSICBOT_AGENT_TOKEN")
+	mpvPath := flag.String("mpv", "mpv", "The location of mpv")
+	mpvSocket := flag.String("socket", "/tmp/go-musicbot-agent", "The location of the mpv ipc socket")
+	audioDevice := flag.String("audio-device", "", "The audio output of mpv, see mpv --audio-device=help")
+	volume := flag.Int("volume", mpv.DefaultVolume, "The volume mpv starts with")
+	tlsCert := flag.String("tls-cert", "", "The certificate to serve TLS with, the bot connects with wss://")
+	tlsKey := flag.String("tls-key", "", "The key of the TLS certificate")
+	flag.Parse()
+
+	if *token == "" {
+		log.Fatal("a token is required")
+	}
+
+	if (*tlsCert == "") != (*tlsKey == "") {
+		log.Fatal("tls-cert and tls-key are both required for TLS")
+	}
+
+	player := mpv.NewPlayer(*mpvPath, *mpvSocket)
+	player.Configure(mpv.Options{
+		AudioDevice: *audioDevice,
+		Volume:      volume,
+	})
+
+	if err := player.Start(); err != nil {
+		log.Fatalf("unable to start mpv: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(*path, remote.NewAgent(player, *token))
+
+	go func() {
+		if *tlsCert != "" {
+			log.Printf("listening on %s%s with TLS", *listen, *path)
+			log.Fatal(http.ListenAndServeTLS(*listen, *tlsCert, *tlsKey, mux))
+		}
+
+		log.Printf("listening on %s%s", *listen, *path)
+		log.Fatal(http.ListenAndServe(*listen, mux))
+	}()
+
+	// Wait for a terminate signal
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	<-sigs
+
+	log.Println("shutting down")
+	player.Stop()
+}
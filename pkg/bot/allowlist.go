@@ -23,7 +23,11 @@ func LoadAllowList(path string) (*AllowList, error) {
 	list := make(map[string]struct{})
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		list[scanner.Text()] = struct{}{}
+		// older versions stored slack users as <@U123>, they are identified by the id now
+		name := sanitizeName(scanner.Text())
+		if name != "" {
+			list[name] = struct{}{}
+		}
 	}
 
 	err = scanner.Err()
@@ -0,0 +1,46 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadAllowList_SlackMentions(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "allowlist.txt")
+	assert.NoError(t, os.WriteFile(path, []byte("<@U123>\n<@U456|someone>\nnick\n\n"), 0666))
+
+	allowlist, err := LoadAllowList(path)
+	assert.NoError(t, err)
+
+	// entries stored by older versions match the id of the slack user
+	assert.True(t, allowlist.Contains("U123"))
+	assert.True(t, allowlist.Contains("U456"))
+	assert.True(t, allowlist.Contains("nick"))
+	assert.False(t, allowlist.Contains("<@U123>"))
+	assert.False(t, allowlist.Contains(""))
+
+	// the file is migrated when it is written again
+	assert.NoError(t, allowlist.Add("U789"))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "<@")
+}
+
+func TestLoadConfig_SlackAdmin(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(path, []byte(`{"admin": "<@U123>", "mattermost": {"connectionTimeout": 30}}`), 0666))
+
+	config, err := LoadConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "U123", config.Admin)
+
+	bot := &MusicBot{config: config}
+	assert.True(t, bot.isAdmin(Message{Sender: Sender{ID: "U123", Name: "someone"}}))
+}
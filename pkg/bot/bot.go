@@ -5,13 +5,17 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/svenwiltink/go-musicbot/pkg/music"
+	"github.com/svenwiltink/go-musicbot/pkg/music/cache"
 	"github.com/svenwiltink/go-musicbot/pkg/music/dataprovider/nts"
 	"github.com/svenwiltink/go-musicbot/pkg/music/dataprovider/soundcloud"
 	"github.com/svenwiltink/go-musicbot/pkg/music/dataprovider/youtube"
-	"github.com/svenwiltink/go-musicbot/pkg/music/player"
-	"github.com/svenwiltink/go-musicbot/pkg/music/provider/mpv"
+	"github.com/svenwiltink/go-musicbot/pkg/music/metadata"
+	"github.com/svenwiltink/go-musicbot/pkg/music/prefetch"
+	"github.com/svenwiltink/go-musicbot/pkg/music/provider/stream"
 )
 
 var (
@@ -21,45 +25,143 @@ var (
 
 type MusicBot struct {
 	messageProvider MessageProvider
-	musicPlayer     music.Player
 	config          *Config
 	commands        map[string]Command
 	commandAliases  map[string]Command
 	searchCache     []music.Song
 
+	// zones are the rooms with their own player, the first one is the default
+	zones []*Zone
+	// groupLock guards the leaders and groups of the zones
+	groupLock sync.Mutex
+
 	allowlist *AllowList
+	jobs      *JobList
+	state     *State
+	// cache is the audio cache, nil when it is disabled
+	cache *cache.Cache
+	// metadata is the cache of the metadata of songs, nil when it is disabled
+	metadata *metadata.Cache
+	youtube  *youtube.DataProvider
 }
 
 func NewMusicBot(config *Config, messageProvider MessageProvider) *MusicBot {
 
-	mpvPlayer := mpv.NewPlayer(config.MpvPath, config.MpvSocket)
-	err := mpvPlayer.Start()
+	youtubeProvider, err := youtube.NewDataProvider(config.Youtube.APIKey, config.Youtube.DailyQuota)
 
 	if err != nil {
-		log.Printf("unable to start music player: %v", err)
+		log.Printf("unable to start youtube provider: %v", err)
 		return nil
 	}
 
-	youtubeProvider, err := youtube.NewDataProvider(config.Youtube.APIKey)
+	dataProviders := []music.DataProvider{
+		nts.DataProvider{},
+		soundcloud.DataProvider{},
+		youtubeProvider,
+	}
 
-	if err != nil {
-		log.Printf("unable to start youtube provider: %v", err)
-		return nil
+	// the stream plays along with the first zone
+	var mirrors []music.Provider
+
+	if config.Stream.Enabled {
+		streamProvider := stream.New(stream.Config{
+			MpvPath: config.MpvPath,
+			Listen:  config.Stream.Listen,
+			Path:    config.Stream.Path,
+			Name:    config.Stream.Name,
+			Bitrate: config.Stream.Bitrate,
+		})
+
+		err = streamProvider.Start()
+
+		if err != nil {
+			log.Printf("unable to start the stream: %v", err)
+			return nil
+		}
+
+		mirrors = append(mirrors, streamProvider)
+	}
+
+	var metadataCache *metadata.Cache
+
+	if config.Metadata.Enabled {
+		metadataCache, err = metadata.Open(metadata.Config{
+			File:      config.Metadata.File,
+			TTL:       config.Metadata.TTL * time.Hour,
+			SearchTTL: config.Metadata.SearchTTL * time.Minute,
+		})
+
+		if err != nil {
+			log.Printf("unable to open the metadata cache: %v", err)
+			return nil
+		}
+
+		for index, dataProvider := range dataProviders {
+			dataProviders[index] = metadataCache.Wrap(dataProvider)
+		}
+
+		metadataCache.Start()
+	}
+
+	var audioCache *cache.Cache
+
+	if config.Cache.Enabled {
+		identifiers := make([]music.Identifier, 0, len(dataProviders))
+		for _, dataProvider := range dataProviders {
+			if identifier, ok := dataProvider.(music.Identifier); ok {
+				identifiers = append(identifiers, identifier)
+			}
+		}
+
+		audioCache, err = cache.Open(cache.Config{
+			Directory: config.Cache.Directory,
+			MaxSize:   config.Cache.MaxSize * 1024 * 1024,
+			MaxAge:    config.Cache.MaxAge * time.Hour,
+		}, identifiers)
+
+		if err != nil {
+			log.Printf("unable to open the cache: %v", err)
+			return nil
+		}
+
+		// the data of cached songs does not have to be looked up
+		for index, dataProvider := range dataProviders {
+			dataProviders[index] = audioCache.Wrap(dataProvider)
+		}
+
+		audioCache.Start()
+	}
+
+	var preparer music.Preparer
+
+	if config.Prefetch.Enabled {
+		prefetcher := prefetch.New(prefetch.Config{Cache: audioCache})
+		prefetcher.Start()
+		preparer = prefetcher
+	}
+
+	zones := make([]*Zone, 0)
+	for _, zoneConfig := range config.GetZones() {
+		zone, err := newZone(config, zoneConfig, dataProviders, mirrors, preparer)
+
+		if err != nil {
+			log.Printf("unable to start zone %s: %v", zoneConfig.Name, err)
+			return nil
+		}
+
+		zones = append(zones, zone)
+		mirrors = nil
 	}
 
 	instance := &MusicBot{
 		config:          config,
 		messageProvider: messageProvider,
-		musicPlayer: player.NewMusicPlayer(
-			[]music.Provider{mpvPlayer},
-			[]music.DataProvider{
-				nts.DataProvider{},
-				soundcloud.DataProvider{},
-				youtubeProvider,
-			},
-		),
-		commands:       make(map[string]Command),
-		commandAliases: make(map[string]Command),
+		zones:           zones,
+		cache:           audioCache,
+		metadata:        metadataCache,
+		youtube:         youtubeProvider,
+		commands:        make(map[string]Command),
+		commandAliases:  make(map[string]Command),
 	}
 
 	return instance
@@ -68,21 +170,140 @@ func NewMusicBot(config *Config, messageProvider MessageProvider) *MusicBot {
 func (bot *MusicBot) Start() {
 
 	bot.loadAllowlist()
-	bot.musicPlayer.Start()
+	bot.loadJobs()
+	bot.loadState()
 	bot.registerCommands()
 
-	bot.musicPlayer.AddListener(music.EventSongStarted, func(arguments ...interface{}) {
+	for _, zone := range bot.zones {
+		zone.Player.Start()
+		zone.scheduler.Start()
+		bot.addZoneListeners(zone)
+	}
+
+	bot.youtube.SetQuotaListener(bot.warnQuota)
+
+	bot.jobs.Start(func(job Job) {
+		bot.handleCommand(job.Message)
+	})
+
+	go bot.messageLoop()
+}
+
+// addZoneListeners announces the events of the player of the zone
+func (bot *MusicBot) addZoneListeners(zone *Zone) {
+	zone.Player.AddListener(music.EventSongStarted, func(arguments ...interface{}) {
 		song := arguments[0].(music.Song)
-		bot.BroadcastMessage(fmt.Sprintf("Started playing %s: %s", song.Artist, song.Name))
+
+		if bot.cache != nil {
+			bot.cache.Played(song)
+		}
+
+		bot.broadcastZone(zone, Reply{
+			Title:   "Started playing",
+			Items:   []ReplyItem{songItem(song)},
+			Actions: playerActions,
+		})
 	})
 
-	bot.musicPlayer.AddListener(music.EventSongStartError, func(arguments ...interface{}) {
+	zone.Player.AddListener(music.EventSongStartError, func(arguments ...interface{}) {
 		song := arguments[0].(music.Song)
 		err := arguments[1].(error)
-		bot.BroadcastMessage(fmt.Sprintf("Error starting %v %v, skipping (%v)", song.Artist, song.Name, err))
+		bot.broadcastZone(zone, TextReply(fmt.Sprintf("Error starting %v %v, skipping (%v)", song.Artist, song.Name, err)))
 	})
 
-	go bot.messageLoop()
+	zone.Player.AddListener(music.EventSongFallback, func(arguments ...interface{}) {
+		song := arguments[0].(music.Song)
+		alternative := arguments[1].(music.Song)
+		err := arguments[2].(error)
+
+		text := fmt.Sprintf("Unable to play %v %v (%v), playing it from another source", song.Artist, song.Name, err)
+		if alternative.Name != song.Name || alternative.Artist != song.Artist {
+			text = fmt.Sprintf("Unable to play %v %v (%v), playing %v %v instead", song.Artist, song.Name, err, alternative.Artist, alternative.Name)
+		}
+
+		bot.broadcastZone(zone, TextReply(text))
+	})
+
+	zone.Player.AddListener(music.EventProviderCrashed, func(arguments ...interface{}) {
+		err := arguments[0].(error)
+		bot.broadcastZone(zone, TextReply(fmt.Sprintf("The music player crashed, restarting it (%v)", err)))
+	})
+
+	zone.Player.AddListener(music.EventProviderRestarted, func(arguments ...interface{}) {
+		song := arguments[0].(*music.Song)
+		resumed := arguments[1].(bool)
+
+		switch {
+		case song == nil:
+			bot.broadcastZone(zone, TextReply("The music player is running again"))
+		case resumed:
+			bot.broadcastZone(zone, TextReply(fmt.Sprintf("The music player is running again, resuming %s %s", song.Artist, song.Name)))
+		default:
+			bot.broadcastZone(zone, TextReply(fmt.Sprintf("The music player is running again, unable to resume %s %s, skipping it", song.Artist, song.Name)))
+		}
+	})
+
+	zone.Player.AddListener(music.EventSleepTimerEnded, func(arguments ...interface{}) {
+		bot.broadcastZone(zone, TextReply("Sleep timer ended, use play to continue"))
+	})
+}
+
+// warnQuota tells the admin that the quota of the youtube api is almost or completely used up
+func (bot *MusicBot) warnQuota(stats youtube.QuotaStats) {
+	reset := stats.Reset.Local().Format("15:04")
+
+	if stats.Exhausted {
+		bot.messageAdmin(fmt.Sprintf("the youtube api quota is used up, using yt-dlp until it resets at %s", reset))
+		return
+	}
+
+	bot.messageAdmin(fmt.Sprintf("%d of the %d youtube api quota units are used, it resets at %s", stats.Used, stats.Limit, reset))
+}
+
+// messageAdmin sends the message privately to the admin. When the message provider can't do
+// that the message is broadcast, mentioning the admin.
+func (bot *MusicBot) messageAdmin(message string) {
+	if messenger, ok := bot.messageProvider.(DirectMessenger); ok {
+		err := messenger.SendDirectMessage(bot.config.Admin, TextReply(message))
+		if err == nil {
+			return
+		}
+
+		log.Printf("unable to message the admin: %v", err)
+	}
+
+	bot.BroadcastMessage(fmt.Sprintf("%s: %s", bot.mention(bot.config.Admin), message))
+}
+
+func (bot *MusicBot) loadJobs() {
+	jobs, err := LoadJobList(bot.config.JobsFile)
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	bot.jobs = jobs
+}
+
+// loadState restores the stored state of the zones
+func (bot *MusicBot) loadState() {
+	state, err := LoadState(bot.config.StateFile)
+
+	if err != nil {
+		log.Println(err)
+	}
+
+	bot.state = state
+
+	for _, zone := range bot.zones {
+		zoneState := state.Zone(zone.Name)
+
+		if zoneState.RepeatMode != "" {
+			if err := zone.Player.SetRepeatMode(zoneState.RepeatMode); err != nil {
+				log.Printf("unable to restore the repeat mode of zone %s: %v", zone.Name, err)
+			}
+		}
+	}
 }
 
 func (bot *MusicBot) loadAllowlist() {
@@ -115,12 +336,27 @@ func (bot *MusicBot) registerCommands() {
 	bot.registerCommand(pausedCommand)
 	bot.registerCommand(playCommand)
 	bot.registerCommand(currentCommand)
+	bot.registerCommand(seekCommand)
 	bot.registerCommand(queueCommand)
 	bot.registerCommand(queueDeleteCommand)
 	bot.registerCommand(flushCommand)
 	bot.registerCommand(shuffleCommand)
+	bot.registerCommand(repeatCommand)
+	bot.registerCommand(normalizeCommand)
 	bot.registerCommand(allowListCommand)
 	bot.registerCommand(volCommand)
+	bot.registerCommand(devicesCommand)
+	bot.registerCommand(zonesCommand)
+	bot.registerCommand(groupCommand)
+	bot.registerCommand(ungroupCommand)
+	bot.registerCommand(stopAfterCommand)
+	bot.registerCommand(sleepCommand)
+	bot.registerCommand(scheduleCommand)
+	bot.registerCommand(atCommand)
+	bot.registerCommand(inCommand)
+	bot.registerCommand(jobsCommand)
+	bot.registerCommand(cacheCommand)
+	bot.registerCommand(statsCommand)
 	bot.registerCommand(aboutCommand)
 	bot.registerCommand(addPlaylistCommand)
 }
@@ -146,19 +382,46 @@ func (bot *MusicBot) getCommand(name string) (Command, error) {
 }
 
 func (bot *MusicBot) ReplyToMessage(message Message, reply string) {
+	bot.SendReply(message, TextReply(reply))
+}
+
+func (bot *MusicBot) SendReply(message Message, reply Reply) {
 	if err := bot.messageProvider.SendReplyToMessage(message, reply); err != nil {
 		log.Printf("Error replying to message: %s", err)
 	}
 }
 
 func (bot *MusicBot) BroadcastMessage(message string) {
-	if err := bot.messageProvider.BroadcastMessage(message); err != nil {
+	bot.BroadcastReply(TextReply(message))
+}
+
+func (bot *MusicBot) BroadcastReply(reply Reply) {
+	if err := bot.messageProvider.BroadcastMessage(reply); err != nil {
 		log.Printf("Error broadcasting message: %s", err)
 	}
 }
 
 func (bot *MusicBot) Stop() {
-	bot.musicPlayer.Stop()
+	bot.groupLock.Lock()
+	for _, zone := range bot.zones {
+		// the followers are stopped by their own player
+		if zone.group != nil {
+			zone.group.Stop()
+		}
+	}
+	bot.groupLock.Unlock()
+
+	for _, zone := range bot.zones {
+		zone.Player.Stop()
+	}
+
+	if bot.metadata != nil {
+		bot.metadata.Stop()
+	}
+
+	if bot.cache != nil {
+		bot.cache.Stop()
+	}
 }
 
 func (bot *MusicBot) handleMessage(message Message) {
@@ -175,11 +438,26 @@ func (bot *MusicBot) handleMessage(message Message) {
 }
 
 func (bot *MusicBot) handleCommand(message Message) {
-	if !(bot.config.Admin == message.Sender.Name || bot.allowlist.Contains(message.Sender.Name)) {
-		bot.ReplyToMessage(message, fmt.Sprintf("You're not on the allowlist %s", message.Sender.Name))
+	identity := message.Sender.Identity()
+	if !(bot.isAdmin(message) || bot.allowlist.Contains(identity)) {
+		bot.ReplyToMessage(message, fmt.Sprintf("You're not on the allowlist %s", bot.mention(identity)))
 		return
 	}
 
+	// a command can be prefixed with @zone to select the zone it is for
+	if name, command, selected := splitZone(message.Message); selected {
+		zone, exists := bot.findZone(name)
+		if !exists {
+			bot.ReplyToMessage(message, fmt.Sprintf("Unknown zone @%s. Use %s zones to list the zones", name, bot.config.CommandPrefix))
+			return
+		}
+
+		message.Zone = zone.Name
+		message.Message = command
+	} else if message.Zone == "" {
+		message.Zone = bot.zoneForChannel(message.Target).Name
+	}
+
 	words := strings.SplitN(message.Message, " ", 2)
 	if len(words) >= 1 {
 		commandWord := Message.getCommandWord(message)
@@ -189,7 +467,7 @@ func (bot *MusicBot) handleCommand(message Message) {
 			return
 		}
 
-		if command.AdminOnly && bot.config.Admin != message.Sender.Name {
+		if command.AdminOnly && !bot.isAdmin(message) {
 			bot.ReplyToMessage(message, "This command is for admins only")
 			return
 		}
@@ -200,6 +478,20 @@ func (bot *MusicBot) handleCommand(message Message) {
 	}
 }
 
+func (bot *MusicBot) isAdmin(message Message) bool {
+	return bot.config.Admin == message.Sender.Identity()
+}
+
+// mention returns the text that mentions the user with the identity in a message
+func (bot *MusicBot) mention(identity string) string {
+	if mentioner, ok := bot.messageProvider.(Mentioner); ok {
+		return mentioner.Mention(identity)
+	}
+
+	return identity
+}
+
+// GetMusicPlayer returns the player of the default zone
 func (bot *MusicBot) GetMusicPlayer() music.Player {
-	return bot.musicPlayer
+	return bot.zones[0].Player
 }
@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// broadcastProvider records the messages that are broadcast
+type broadcastProvider struct {
+	MessageProvider
+	broadcasts []string
+}
+
+func (provider *broadcastProvider) BroadcastMessage(message Reply) error {
+	provider.broadcasts = append(provider.broadcasts, message.String())
+	return nil
+}
+
+// directProvider records the direct messages, or fails to send them
+type directProvider struct {
+	broadcastProvider
+	err    error
+	direct map[string]string
+}
+
+func (provider *directProvider) SendDirectMessage(identity string, reply Reply) error {
+	if provider.err != nil {
+		return provider.err
+	}
+
+	provider.direct[identity] = reply.String()
+	return nil
+}
+
+func (provider *directProvider) Mention(identity string) string {
+	return "@" + identity
+}
+
+func TestMusicBot_MessageAdmin(t *testing.T) {
+	t.Parallel()
+
+	config := &Config{Admin: "sven"}
+
+	broadcaster := &broadcastProvider{}
+	bot := &MusicBot{config: config, messageProvider: broadcaster}
+	bot.messageAdmin("the quota is used up")
+	assert.Equal(t, []string{"sven: the quota is used up"}, broadcaster.broadcasts)
+
+	// the admin is messaged privately when possible
+	messenger := &directProvider{direct: map[string]string{}}
+	bot.messageProvider = messenger
+	bot.messageAdmin("the quota is used up")
+	assert.Equal(t, map[string]string{"sven": "the quota is used up"}, messenger.direct)
+	assert.Empty(t, messenger.broadcasts)
+
+	messenger.err = errors.New("no direct channel")
+	bot.messageAdmin("the quota is used up")
+	assert.Equal(t, []string{"@sven: the quota is used up"}, messenger.broadcasts)
+}
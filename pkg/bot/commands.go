@@ -3,7 +3,9 @@ package bot
 import (
 	"fmt"
 	"html"
+	"log"
 	"runtime/debug"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -18,11 +20,34 @@ type Command struct {
 	Function  func(bot *MusicBot, message Message)
 }
 
+// playerActions are the controls attached to replies about the current song
+var playerActions = []ReplyAction{
+	{Label: "Skip", Command: "next"},
+	{Label: "Pause", Command: "pause"},
+	{Label: "Play", Command: "play"},
+	{Label: "Queue", Command: "queue"},
+}
+
+// songItem creates a reply item for a song. Livestreams do not have a duration
+func songItem(song music.Song) ReplyItem {
+	item := ReplyItem{
+		Title: song.Artist,
+		Text:  song.Name,
+		Link:  song.Path,
+	}
+
+	if song.SongType == music.SongTypeSong {
+		item.Duration = song.Duration
+	}
+
+	return item
+}
+
 var helpCommand = Command{
 	Name:    "help",
 	Aliases: []string{"h"},
 	Function: func(bot *MusicBot, message Message) {
-		helpString := "Available commands: "
+		helpString := ""
 		for _, command := range bot.commands {
 			helpString += command.Name
 			if len(command.Aliases) > 0 {
@@ -31,7 +56,10 @@ var helpCommand = Command{
 			helpString += " "
 		}
 
-		bot.ReplyToMessage(message, helpString)
+		bot.SendReply(message, Reply{
+			Title: "Available commands",
+			Text:  strings.TrimSpace(helpString),
+		})
 	},
 }
 
@@ -43,6 +71,23 @@ func sanitizeSongURL(song string) string {
 	return song
 }
 
+// estimateQueueEnd estimates how long it takes until everything in the queue has been played.
+// There is no estimate while a livestream is playing.
+func estimateQueueEnd(musicPlayer music.Player) (time.Duration, bool) {
+	queueDuration := musicPlayer.GetQueue().GetTotalDuration()
+
+	song, remaining := musicPlayer.GetCurrentSong()
+	if song == nil || musicPlayer.GetStatus() == music.PlayerStatusWaiting {
+		return queueDuration, true
+	}
+
+	if song.SongType != music.SongTypeSong {
+		return 0, false
+	}
+
+	return remaining + queueDuration, true
+}
+
 var addCommand = Command{
 	Name:    "add",
 	Aliases: []string{"a"},
@@ -75,17 +120,30 @@ var addCommand = Command{
 			Path: parameter,
 		}
 
-		song, err = bot.musicPlayer.AddSong(song)
+		eta, hasEta := estimateQueueEnd(bot.player(message))
+
+		song, err = bot.player(message).AddSong(song)
 		if err != nil {
 			bot.ReplyToMessage(message, err.Error())
 			return
 		}
 
 		if message.IsPrivate {
-			bot.BroadcastMessage(fmt.Sprintf("%s: %s added by %s", song.Artist, song.Name, message.Sender.Name))
+			bot.BroadcastReply(Reply{
+				Title: fmt.Sprintf("Added by %s", message.Sender.Name),
+				Items: []ReplyItem{songItem(song)},
+			})
+		}
+		reply := Reply{
+			Title: "Added",
+			Items: []ReplyItem{songItem(song)},
+		}
+
+		if hasEta {
+			reply.Footer = fmt.Sprintf("Plays in about %s", FormatDuration(eta))
 		}
-		bot.ReplyToMessage(message, fmt.Sprintf("%s: %s added", song.Artist, song.Name))
 
+		bot.SendReply(message, reply)
 	},
 }
 
@@ -99,7 +157,7 @@ var searchCommand = Command{
 			return
 		}
 
-		songs, err := bot.musicPlayer.Search(parameter)
+		songs, err := bot.player(message).Search(parameter)
 
 		if err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("error: %v", err))
@@ -110,16 +168,28 @@ var searchCommand = Command{
 			return
 		}
 
-		var builder strings.Builder
+		reply := Reply{
+			Title:    "Search results",
+			Numbered: true,
+			Footer:   fmt.Sprintf("Use %s add <number> to add a song", bot.config.CommandPrefix),
+		}
 
 		for number, song := range songs {
-			builder.WriteString(fmt.Sprintf("%d  %s - %s (%s)\n", number+1, song.Artist, song.Name, song.Duration))
+			item := songItem(song)
+			item.Action = &ReplyAction{Label: "Add", Command: "add", Parameter: strconv.Itoa(number + 1)}
+
+			// songs with a path can be added directly, even if the search cache has changed
+			if song.Path != "" {
+				item.Action.Parameter = song.Path
+			}
+
+			reply.Items = append(reply.Items, item)
 		}
 
 		// populate the search cache
 		bot.searchCache = songs
 
-		bot.ReplyToMessage(message, builder.String())
+		bot.SendReply(message, reply)
 
 	},
 }
@@ -134,7 +204,7 @@ var searchAddCommand = Command{
 			return
 		}
 
-		songs, err := bot.musicPlayer.Search(parameter)
+		songs, err := bot.player(message).Search(parameter)
 
 		if err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("error: %v", err))
@@ -146,7 +216,7 @@ var searchAddCommand = Command{
 		}
 
 		song := songs[0]
-		song, err = bot.musicPlayer.AddSong(song)
+		song, err = bot.player(message).AddSong(song)
 
 		if err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
@@ -154,10 +224,16 @@ var searchAddCommand = Command{
 		}
 
 		if message.IsPrivate {
-			bot.BroadcastMessage(fmt.Sprintf("%s: %s added by %s", song.Artist, song.Name, message.Sender.Name))
+			bot.BroadcastReply(Reply{
+				Title: fmt.Sprintf("Added by %s", message.Sender.Name),
+				Items: []ReplyItem{songItem(song)},
+			})
 		}
 
-		bot.ReplyToMessage(message, fmt.Sprintf("%s: %s added", song.Artist, song.Name))
+		bot.SendReply(message, Reply{
+			Title: "Added",
+			Items: []ReplyItem{songItem(song)},
+		})
 	},
 }
 
@@ -165,14 +241,14 @@ var nextCommand = Command{
 	Name:    "next",
 	Aliases: []string{"n"},
 	Function: func(bot *MusicBot, message Message) {
-		err := bot.musicPlayer.Next()
+		err := bot.player(message).Next()
 		if err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("Could not skip song: %v", err))
 		} else {
 			if message.IsPrivate {
 				bot.BroadcastMessage(fmt.Sprintf("%s skipped the song", message.Sender.Name))
 			}
-			bot.ReplyToMessage(message, "Skipping song")
+			bot.SendReply(message, SuccessReply("Skipping song"))
 		}
 	},
 }
@@ -181,7 +257,7 @@ var pausedCommand = Command{
 	Name:    "pause",
 	Aliases: []string{},
 	Function: func(bot *MusicBot, message Message) {
-		err := bot.musicPlayer.Pause()
+		err := bot.player(message).Pause()
 		if err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
 			return
@@ -191,7 +267,7 @@ var pausedCommand = Command{
 			bot.BroadcastMessage(fmt.Sprintf("%s stopped the music", message.Sender.Name))
 		}
 
-		bot.ReplyToMessage(message, "Music paused")
+		bot.SendReply(message, SuccessReply("Music paused"))
 
 	},
 }
@@ -200,7 +276,7 @@ var playCommand = Command{
 	Name:    "play",
 	Aliases: []string{},
 	Function: func(bot *MusicBot, message Message) {
-		err := bot.musicPlayer.Play()
+		err := bot.player(message).Play()
 		if err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
 			return
@@ -210,8 +286,83 @@ var playCommand = Command{
 			bot.BroadcastMessage(fmt.Sprintf("%s resumed the music", message.Sender.Name))
 		}
 
-		bot.ReplyToMessage(message, "Music resumed")
+		bot.SendReply(message, SuccessReply("Music resumed"))
+
+	},
+}
+
+// parseSeekPosition parses positions like 90, 1:30 and 1:02:03. A leading + or - makes
+// the position relative to the current position.
+func parseSeekPosition(parameter string) (position time.Duration, relative bool, err error) {
+	sign := time.Duration(1)
+	switch {
+	case strings.HasPrefix(parameter, "+"):
+		relative = true
+		parameter = parameter[1:]
+	case strings.HasPrefix(parameter, "-"):
+		relative = true
+		sign = -1
+		parameter = parameter[1:]
+	}
+
+	parts := strings.Split(parameter, ":")
+	if len(parts) > 3 {
+		return 0, false, fmt.Errorf("%s is not a valid position", parameter)
+	}
+
+	for _, part := range parts {
+		value, err := strconv.Atoi(part)
+		if err != nil || value < 0 {
+			return 0, false, fmt.Errorf("%s is not a valid position", parameter)
+		}
+
+		position = position*60 + time.Duration(value)*time.Second
+	}
+
+	return sign * position, relative, nil
+}
+
+var seekCommand = Command{
+	Name:    "seek",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError != nil {
+			bot.ReplyToMessage(message, "seek <1:30|+30|-10>")
+			return
+		}
+
+		position, relative, err := parseSeekPosition(parameter)
+		if err != nil {
+			bot.ReplyToMessage(message, err.Error())
+			return
+		}
+
+		if relative {
+			err = bot.player(message).SeekRelative(position)
+		} else {
+			err = bot.player(message).Seek(position)
+		}
+
+		if err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Could not seek: %v", err))
+			return
+		}
 
+		song, _ := bot.player(message).GetCurrentSong()
+		if song == nil {
+			bot.SendReply(message, SuccessReply("Jumped"))
+			return
+		}
+
+		// the duration of the data provider can differ from what the player knows
+		position, duration := bot.player(message).GetPosition()
+		remaining := duration - position
+		if remaining < 0 {
+			remaining = 0
+		}
+
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("Jumped to %s, %s remaining", FormatDuration(position), FormatDuration(remaining))))
 	},
 }
 
@@ -219,21 +370,25 @@ var currentCommand = Command{
 	Name:    "current",
 	Aliases: []string{"c"},
 	Function: func(bot *MusicBot, message Message) {
-		song, durationLeft := bot.musicPlayer.GetCurrentSong()
+		song, durationLeft := bot.player(message).GetCurrentSong()
 		if song == nil {
 			bot.ReplyToMessage(message, "Nothing currently playing")
 			return
 		}
 
+		reply := Reply{
+			Title:   "Current song",
+			Items:   []ReplyItem{songItem(*song)},
+			Actions: playerActions,
+		}
+
 		if song.SongType == music.SongTypeSong {
-			bot.ReplyToMessage(
-				message,
-				fmt.Sprintf("Current song: %s %s. %s remaining (%s)", song.Artist, song.Name, durationLeft.String(), song.Duration.Round(time.Second).String()))
+			reply.Footer = fmt.Sprintf("%s remaining", FormatDuration(durationLeft))
 		} else {
-			bot.ReplyToMessage(
-				message,
-				fmt.Sprintf("Current song: %s %s. This is a livestream, use the next command to skip", song.Artist, song.Name))
+			reply.Footer = "This is a livestream, use the next command to skip"
 		}
+
+		bot.SendReply(message, reply)
 	},
 }
 
@@ -241,22 +396,35 @@ var queueCommand = Command{
 	Name:    "queue",
 	Aliases: []string{"q"},
 	Function: func(bot *MusicBot, message Message) {
-		queue := bot.GetMusicPlayer().GetQueue()
+		queue := bot.player(message).GetQueue()
 
 		queueLength := queue.GetLength()
 		nextSongs, _ := queue.GetNextN(5)
 		duration := queue.GetTotalDuration()
 
-		bot.ReplyToMessage(message, fmt.Sprintf("%d songs in the queue. Total duration %s", queueLength, duration.String()))
+		reply := Reply{
+			Title:    fmt.Sprintf("%d songs in the queue. Total duration %s", queueLength, FormatDuration(duration)),
+			Numbered: true,
+		}
+
+		if eta, hasEta := estimateQueueEnd(bot.player(message)); hasEta && queueLength > 0 {
+			reply.Title += fmt.Sprintf(", done in %s", FormatDuration(eta))
+		}
+
+		if mode := bot.player(message).GetRepeatMode(); mode != music.RepeatModeOff {
+			reply.Text = fmt.Sprintf("Repeat mode: %s", mode)
+		}
 
-		for index, song := range nextSongs {
-			bot.ReplyToMessage(message, fmt.Sprintf("#%d, %s: %s (%s)\n", index+1, song.Artist, song.Name, song.Duration.String()))
+		for _, song := range nextSongs {
+			reply.Items = append(reply.Items, songItem(song))
 		}
 
 		if queueLength > 5 {
-			bot.ReplyToMessage(message, fmt.Sprintf("and %d more", queueLength-5))
+			reply.Footer = fmt.Sprintf("and %d more", queueLength-5)
 		}
 
+		bot.SendReply(message, reply)
+
 	},
 }
 
@@ -276,13 +444,13 @@ var queueDeleteCommand = Command{
 			return
 		}
 
-		queue := bot.GetMusicPlayer().GetQueue()
+		queue := bot.player(message).GetQueue()
 		if err = queue.Delete(queueItem - 1); err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("Could not delete queue-item: %s", err))
 			return
 		}
 
-		bot.ReplyToMessage(message, fmt.Sprintf("queue-item %d deleted", queueItem))
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("queue-item %d deleted", queueItem)))
 	},
 }
 
@@ -290,13 +458,13 @@ var flushCommand = Command{
 	Name:    "flush",
 	Aliases: []string{"f"},
 	Function: func(bot *MusicBot, message Message) {
-		bot.musicPlayer.GetQueue().Flush()
+		bot.player(message).GetQueue().Flush()
 
 		if message.IsPrivate {
 			bot.BroadcastMessage(fmt.Sprintf("%s flushed the queue", message.Sender.Name))
 		}
 
-		bot.ReplyToMessage(message, "Queue flushed")
+		bot.SendReply(message, SuccessReply("Queue flushed"))
 	},
 }
 
@@ -304,13 +472,106 @@ var shuffleCommand = Command{
 	Name:    "shuffle",
 	Aliases: []string{},
 	Function: func(bot *MusicBot, message Message) {
-		bot.musicPlayer.GetQueue().Shuffle()
+		bot.player(message).GetQueue().Shuffle()
 
 		if message.IsPrivate {
 			bot.BroadcastMessage(fmt.Sprintf("%s shuffled the queue", message.Sender.Name))
 		}
 
-		bot.ReplyToMessage(message, "Queue shuffled")
+		bot.SendReply(message, SuccessReply("Queue shuffled"))
+	},
+}
+
+// sanitizeName strips the mention syntax some chat platforms wrap around user ids, like <@U123>
+func sanitizeName(name string) string {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, "<@") && strings.HasSuffix(name, ">") {
+		name = strings.TrimSuffix(strings.TrimPrefix(name, "<@"), ">")
+		name, _, _ = strings.Cut(name, "|")
+	}
+
+	return name
+}
+
+var repeatModes = map[string]music.RepeatMode{
+	"off":        music.RepeatModeOff,
+	"one":        music.RepeatModeOne,
+	"all":        music.RepeatModeAll,
+	"repeat-one": music.RepeatModeOne,
+	"repeat-all": music.RepeatModeAll,
+}
+
+var repeatCommand = Command{
+	Name:    "repeat",
+	Aliases: []string{"r"},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Repeat mode: %s. Use repeat <off|one|all> to change it", bot.player(message).GetRepeatMode()))
+			return
+		}
+
+		mode, exists := repeatModes[strings.ToLower(parameter)]
+		if !exists {
+			bot.ReplyToMessage(message, "repeat <off|one|all>")
+			return
+		}
+
+		zone := bot.zone(message)
+		if err := zone.Player.SetRepeatMode(mode); err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		if err := bot.state.SetRepeatMode(zone.Name, mode); err != nil {
+			log.Printf("unable to save the repeat mode: %v", err)
+		}
+
+		if message.IsPrivate {
+			bot.BroadcastMessage(fmt.Sprintf("%s set the repeat mode to %s", message.Sender.Name, mode))
+		}
+
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("Repeat mode set to %s", mode)))
+	},
+}
+
+var normalizeCommand = Command{
+	Name:    "normalize",
+	Aliases: []string{"normalise"},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError != nil {
+			state := "off"
+			if bot.player(message).GetNormalization() {
+				state = "on"
+			}
+
+			bot.ReplyToMessage(message, fmt.Sprintf("Normalisation is %s. Use normalize <on|off> to change it", state))
+			return
+		}
+
+		var enabled bool
+		switch strings.ToLower(parameter) {
+		case "on":
+			enabled = true
+		case "off":
+			enabled = false
+		default:
+			bot.ReplyToMessage(message, "normalize <on|off>")
+			return
+		}
+
+		if err := bot.player(message).SetNormalization(enabled); err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		state := strings.ToLower(parameter)
+		if message.IsPrivate {
+			bot.BroadcastMessage(fmt.Sprintf("%s turned normalisation %s", message.Sender.Name, state))
+		}
+
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("Normalisation turned %s", state)))
 	},
 }
 
@@ -325,6 +586,8 @@ var allowListCommand = Command{
 			return
 		}
 
+		name = sanitizeName(name)
+
 		if addOrRemove == "add" {
 			err := bot.allowlist.Add(name)
 			if err == nil {
@@ -346,6 +609,93 @@ var allowListCommand = Command{
 	},
 }
 
+var cacheCommand = Command{
+	Name:      "cache",
+	Aliases:   []string{},
+	AdminOnly: true,
+	Function: func(bot *MusicBot, message Message) {
+		if bot.cache == nil {
+			bot.ReplyToMessage(message, "The cache is disabled")
+			return
+		}
+
+		parameter, _ := message.getCommandParameter()
+
+		switch strings.ToLower(parameter) {
+		case "", "stats":
+			stats := bot.cache.Stats()
+
+			plays := stats.Hits + stats.Misses
+			hitRate := 0
+			if plays > 0 {
+				hitRate = stats.Hits * 100 / plays
+			}
+
+			size := fmt.Sprintf("%d MB", stats.Size/1024/1024)
+			if stats.MaxSize > 0 {
+				size = fmt.Sprintf("%d of %d MB", stats.Size/1024/1024, stats.MaxSize/1024/1024)
+			}
+
+			bot.SendReply(message, Reply{
+				Title: "Cache",
+				Items: []ReplyItem{
+					{Title: "Songs", Text: strconv.Itoa(stats.Songs)},
+					{Title: "Size", Text: size},
+					{Title: "Hits", Text: fmt.Sprintf("%d of %d plays (%d%%)", stats.Hits, plays, hitRate)},
+				},
+			})
+		case "clear":
+			if err := bot.cache.Clear(); err != nil {
+				bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
+				return
+			}
+
+			bot.SendReply(message, SuccessReply("Cleared the cache"))
+		default:
+			bot.ReplyToMessage(message, "cache [stats|clear]")
+		}
+	},
+}
+
+var statsCommand = Command{
+	Name:      "stats",
+	Aliases:   []string{"quota"},
+	AdminOnly: true,
+	Function: func(bot *MusicBot, message Message) {
+		quota := bot.youtube.Quota()
+
+		api := "disabled, using yt-dlp"
+		if quota.Enabled && quota.Limit > 0 {
+			api = fmt.Sprintf("%d of %d units (%d%%), resets at %s", quota.Used, quota.Limit, quota.Used*100/quota.Limit, quota.Reset.Local().Format("15:04"))
+		}
+
+		if quota.Exhausted {
+			api = fmt.Sprintf("used up, using yt-dlp until %s", quota.Reset.Local().Format("15:04"))
+		}
+
+		items := []ReplyItem{
+			{Title: "Youtube api", Text: api},
+			{Title: "Searches", Text: strconv.Itoa(quota.Searches)},
+			{Title: "Lookups", Text: strconv.Itoa(quota.Lookups)},
+			{Title: "yt-dlp lookups", Text: strconv.Itoa(quota.Fallbacks)},
+		}
+
+		if bot.metadata != nil {
+			stats := bot.metadata.Stats()
+			items = append(items, ReplyItem{
+				Title: "Metadata cache",
+				Text:  fmt.Sprintf("%d entries, %d hits and %d misses", stats.Entries, stats.Hits, stats.Misses),
+			})
+		}
+
+		bot.SendReply(message, Reply{
+			Title:  "Stats",
+			Items:  items,
+			Footer: "The quota is an estimate, the google cloud console shows the real usage",
+		})
+	},
+}
+
 var volCommand = Command{
 	Name:    "vol",
 	Aliases: []string{"v"},
@@ -353,7 +703,7 @@ var volCommand = Command{
 		volumeString, commandVariableErr := message.getCommandParameter()
 
 		if commandVariableErr != nil {
-			volume, err := bot.musicPlayer.GetVolume()
+			volume, err := bot.player(message).GetVolume()
 
 			if err != nil {
 				bot.ReplyToMessage(message, fmt.Sprintf("unable to get volume: %v", err))
@@ -371,7 +721,7 @@ var volCommand = Command{
 		switch volumeString {
 		case "+":
 			{
-				volume, err = bot.musicPlayer.IncreaseVolume(5)
+				volume, err = bot.player(message).IncreaseVolume(5)
 				if err != nil {
 					bot.ReplyToMessage(message, fmt.Sprintf("unable to increase volume: %s", err))
 					return
@@ -379,7 +729,7 @@ var volCommand = Command{
 			}
 		case "++":
 			{
-				volume, err = bot.musicPlayer.IncreaseVolume(10)
+				volume, err = bot.player(message).IncreaseVolume(10)
 				if err != nil {
 					bot.ReplyToMessage(message, fmt.Sprintf("unable to increase volume: %s", err))
 					return
@@ -387,7 +737,7 @@ var volCommand = Command{
 			}
 		case "+++":
 			{
-				volume, err = bot.musicPlayer.IncreaseVolume(20)
+				volume, err = bot.player(message).IncreaseVolume(20)
 				if err != nil {
 					bot.ReplyToMessage(message, fmt.Sprintf("unable to increase volume: %s", err))
 					return
@@ -395,7 +745,7 @@ var volCommand = Command{
 			}
 		case "-":
 			{
-				volume, err = bot.musicPlayer.DecreaseVolume(5)
+				volume, err = bot.player(message).DecreaseVolume(5)
 				if err != nil {
 					bot.ReplyToMessage(message, fmt.Sprintf("unable to decrease volume: %s", err))
 					return
@@ -403,7 +753,7 @@ var volCommand = Command{
 			}
 		case "--":
 			{
-				volume, err = bot.musicPlayer.DecreaseVolume(10)
+				volume, err = bot.player(message).DecreaseVolume(10)
 				if err != nil {
 					bot.ReplyToMessage(message, fmt.Sprintf("unable to decrease volume: %s", err))
 					return
@@ -411,7 +761,7 @@ var volCommand = Command{
 			}
 		case "---":
 			{
-				volume, err = bot.musicPlayer.DecreaseVolume(20)
+				volume, err = bot.player(message).DecreaseVolume(20)
 				if err != nil {
 					bot.ReplyToMessage(message, fmt.Sprintf("unable to decrease volume: %s", err))
 					return
@@ -426,12 +776,16 @@ var volCommand = Command{
 					return
 				}
 
-				if volume >= 0 && volume <= 100 {
-					_ = bot.musicPlayer.SetVolume(volume)
-				} else {
+				if volume < 0 || volume > 100 {
 					bot.ReplyToMessage(message, fmt.Sprintf("%s is not a valid volume", volumeString))
 					return
 				}
+
+				err = bot.player(message).SetVolume(volume)
+				if err != nil {
+					bot.ReplyToMessage(message, fmt.Sprintf("unable to set volume: %s", err))
+					return
+				}
 			}
 		}
 
@@ -439,7 +793,7 @@ var volCommand = Command{
 			bot.BroadcastMessage(fmt.Sprintf("Volume set to %d by %s", volume, message.Sender.Name))
 		}
 
-		bot.ReplyToMessage(message, fmt.Sprintf("Volume set to %d", volume))
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("Volume set to %d", volume)))
 	},
 }
 
@@ -454,7 +808,7 @@ var addPlaylistCommand = Command{
 			return
 		}
 
-		playlist, err := bot.musicPlayer.AddPlaylist(sanitizeSongURL(parameter))
+		playlist, err := bot.player(message).AddPlaylist(sanitizeSongURL(parameter))
 		if err != nil {
 			bot.ReplyToMessage(message, fmt.Sprintf("error: %v", err))
 			return
@@ -465,6 +819,397 @@ var addPlaylistCommand = Command{
 	},
 }
 
+var scheduleCommand = Command{
+	Name:    "schedule",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError == nil && parameter != "list" {
+			bot.ReplyToMessage(message, "schedule list")
+			return
+		}
+
+		items := bot.zone(message).scheduler.Items()
+		if len(items) == 0 {
+			bot.ReplyToMessage(message, "There are no schedule rules")
+			return
+		}
+
+		bot.SendReply(message, Reply{
+			Title: "Schedule",
+			Items: items,
+		})
+	},
+}
+
+var zonesCommand = Command{
+	Name:    "zones",
+	Aliases: []string{"zone"},
+	Function: func(bot *MusicBot, message Message) {
+		defaultZone := bot.zoneForChannel(message.Target)
+
+		items := make([]ReplyItem, 0, len(bot.zones))
+		for _, zone := range bot.zones {
+			text := string(zone.Player.GetStatus())
+			if song, _ := zone.Player.GetCurrentSong(); song != nil && zone.Player.GetStatus().CanBeSkipped() {
+				text = fmt.Sprintf("%s %s - %s", text, song.Artist, song.Name)
+			}
+
+			bot.groupLock.Lock()
+			if zone.leader != nil {
+				text = "following " + zone.leader.Name
+			}
+			bot.groupLock.Unlock()
+
+			if zone == defaultZone {
+				text += " (default here)"
+			}
+
+			items = append(items, ReplyItem{Title: zone.Name, Text: text})
+		}
+
+		bot.SendReply(message, Reply{
+			Title:  "Zones",
+			Items:  items,
+			Footer: "Prefix a command with @zone to control another zone",
+		})
+	},
+}
+
+var groupCommand = Command{
+	Name:    "group",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		names := strings.Fields(parameter)
+		if cmdParamError != nil || len(names) < 2 {
+			bot.ReplyToMessage(message, "group <leader> <zone> [zone...]")
+			return
+		}
+
+		zones := make([]*Zone, 0, len(names))
+		for _, name := range names {
+			zone, exists := bot.findZone(name)
+			if !exists {
+				bot.ReplyToMessage(message, fmt.Sprintf("Error: unknown zone %s", name))
+				return
+			}
+
+			zones = append(zones, zone)
+		}
+
+		if err := bot.groupZones(zones[0], zones[1:]); err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		reply := fmt.Sprintf("%s now play along with %s", strings.Join(names[1:], ", "), names[0])
+
+		if message.IsPrivate {
+			bot.BroadcastMessage(fmt.Sprintf("%s grouped %s", message.Sender.Name, strings.Join(names, ", ")))
+		}
+
+		bot.SendReply(message, SuccessReply(reply))
+	},
+}
+
+var ungroupCommand = Command{
+	Name:    "ungroup",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError != nil {
+			bot.ReplyToMessage(message, "ungroup <zone>")
+			return
+		}
+
+		zone, exists := bot.findZone(parameter)
+		if !exists {
+			bot.ReplyToMessage(message, fmt.Sprintf("Error: unknown zone %s", parameter))
+			return
+		}
+
+		if err := bot.ungroupZone(zone); err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		if message.IsPrivate {
+			bot.BroadcastMessage(fmt.Sprintf("%s ungrouped %s", message.Sender.Name, zone.Name))
+		}
+
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("%s plays its own queue again", zone.Name)))
+	},
+}
+
+var devicesCommand = Command{
+	Name:    "devices",
+	Aliases: []string{"device"},
+	Function: func(bot *MusicBot, message Message) {
+		devices, err := bot.player(message).GetAudioDevices()
+		if err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError != nil {
+			items := make([]ReplyItem, 0, len(devices))
+			for _, device := range devices {
+				text := device.Description
+				if device.Active {
+					text += " (active)"
+				}
+
+				items = append(items, ReplyItem{
+					Title:  device.Name,
+					Text:   text,
+					Action: &ReplyAction{Label: "Use", Command: "devices", Parameter: device.Name},
+				})
+			}
+
+			bot.SendReply(message, Reply{
+				Title:    "Audio devices",
+				Items:    items,
+				Numbered: true,
+				Footer:   "Use devices <number|name> to switch",
+			})
+			return
+		}
+
+		if !bot.isAdmin(message) {
+			bot.ReplyToMessage(message, "Only admins can switch the audio device")
+			return
+		}
+
+		name := parameter
+		if index, err := strconv.Atoi(parameter); err == nil {
+			if index < 1 || index > len(devices) {
+				bot.ReplyToMessage(message, fmt.Sprintf("There is no device %d", index))
+				return
+			}
+
+			name = devices[index-1].Name
+		}
+
+		if err := bot.player(message).SetAudioDevice(name); err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("unable to switch to %s: %v", name, err))
+			return
+		}
+
+		if message.IsPrivate {
+			bot.BroadcastMessage(fmt.Sprintf("%s switched the audio device to %s", message.Sender.Name, name))
+		}
+
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("Switched the audio device to %s", name)))
+	},
+}
+
+var stopAfterCommand = Command{
+	Name:    "stop-after",
+	Aliases: []string{"stopafter"},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, _ := message.getCommandParameter()
+
+		enabled := true
+		switch strings.ToLower(parameter) {
+		case "", "on":
+		case "off":
+			enabled = false
+		default:
+			bot.ReplyToMessage(message, "stop-after [off]")
+			return
+		}
+
+		if err := bot.player(message).SetStopAfter(enabled); err != nil {
+			bot.ReplyToMessage(message, fmt.Sprintf("Error: %v", err))
+			return
+		}
+
+		reply := "Stopping after the current song, use play to continue"
+		if !enabled {
+			reply = "Continuing after the current song"
+		}
+
+		if message.IsPrivate {
+			bot.BroadcastMessage(fmt.Sprintf("%s: %s", message.Sender.Name, reply))
+		}
+
+		bot.SendReply(message, SuccessReply(reply))
+	},
+}
+
+var sleepCommand = Command{
+	Name:    "sleep",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError != nil {
+			remaining, running := bot.player(message).GetSleepTimer()
+			if !running {
+				bot.ReplyToMessage(message, "The sleep timer is not running. Use sleep <duration, like 45m> to start it")
+				return
+			}
+
+			bot.ReplyToMessage(message, fmt.Sprintf("Pausing in %s", FormatDuration(remaining)))
+			return
+		}
+
+		if strings.ToLower(parameter) == "off" {
+			bot.player(message).Sleep(0)
+			bot.SendReply(message, SuccessReply("Sleep timer cancelled"))
+			return
+		}
+
+		duration, err := time.ParseDuration(parameter)
+		if err != nil || duration <= 0 {
+			bot.ReplyToMessage(message, "sleep <duration, like 45m or 1h30m|off>")
+			return
+		}
+
+		bot.player(message).Sleep(duration)
+
+		if message.IsPrivate {
+			bot.BroadcastMessage(fmt.Sprintf("%s set the sleep timer to %s", message.Sender.Name, FormatDuration(duration)))
+		}
+
+		bot.SendReply(message, SuccessReply(fmt.Sprintf("Pausing in %s", FormatDuration(duration))))
+	},
+}
+
+var atCommand = Command{
+	Name:    "at",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		clock, command, secCmdVarErr := message.getDualCommandParameters()
+		if secCmdVarErr != nil {
+			bot.ReplyToMessage(message, "at <HH:MM> <command>")
+			return
+		}
+
+		at, err := parseClockTime(clock, time.Now())
+		if err != nil {
+			bot.ReplyToMessage(message, err.Error())
+			return
+		}
+
+		bot.scheduleJob(message, at, command)
+	},
+}
+
+var inCommand = Command{
+	Name:    "in",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		durationString, command, secCmdVarErr := message.getDualCommandParameters()
+		if secCmdVarErr != nil {
+			bot.ReplyToMessage(message, "in <duration, like 30m or 1h30m> <command>")
+			return
+		}
+
+		duration, err := time.ParseDuration(durationString)
+		if err != nil || duration <= 0 {
+			bot.ReplyToMessage(message, fmt.Sprintf("invalid duration %s, use something like 30m or 1h30m", durationString))
+			return
+		}
+
+		bot.scheduleJob(message, time.Now().Add(duration), command)
+	},
+}
+
+// scheduleJob schedules the command to be run at the given time on behalf of the sender
+func (bot *MusicBot) scheduleJob(message Message, at time.Time, command string) {
+	command = strings.TrimSpace(command)
+	message.Message = command
+
+	// the job can be for another zone, like @kitchen next
+	check := message
+	if name, zoneCommand, selected := splitZone(command); selected {
+		if _, exists := bot.findZone(name); !exists {
+			bot.ReplyToMessage(message, fmt.Sprintf("Unknown zone @%s. Use %s zones to list the zones", name, bot.config.CommandPrefix))
+			return
+		}
+
+		check.Message = zoneCommand
+	}
+
+	scheduled, err := bot.getCommand(check.getCommandWord())
+	if err != nil || !schedulableCommands[scheduled.Name] {
+		names := make([]string, 0, len(schedulableCommands))
+		for name := range schedulableCommands {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		bot.ReplyToMessage(message, fmt.Sprintf("Only these commands can be scheduled: %s", strings.Join(names, ", ")))
+		return
+	}
+
+	job, err := bot.jobs.Add(at, message)
+	if err != nil {
+		log.Printf("unable to save jobs: %v", err)
+	}
+
+	bot.SendReply(message, SuccessReply(fmt.Sprintf("Scheduled job %d at %s: %s", job.ID, job.At.Format("15:04"), command)))
+}
+
+var jobsCommand = Command{
+	Name:    "jobs",
+	Aliases: []string{},
+	Function: func(bot *MusicBot, message Message) {
+		parameter, cmdParamError := message.getCommandParameter()
+		if cmdParamError == nil {
+			bot.cancelJob(message, parameter)
+			return
+		}
+
+		jobs := bot.jobs.Jobs()
+		if len(jobs) == 0 {
+			bot.ReplyToMessage(message, "There are no scheduled jobs")
+			return
+		}
+
+		items := make([]ReplyItem, 0, len(jobs))
+		for _, job := range jobs {
+			items = append(items, ReplyItem{
+				Title: fmt.Sprintf("%d. %s", job.ID, job.At.Format("Mon 15:04")),
+				Text:  fmt.Sprintf("%s (by %s)", job.Message.Message, job.Message.Sender.Name),
+			})
+		}
+
+		bot.SendReply(message, Reply{
+			Title:  "Scheduled jobs",
+			Items:  items,
+			Footer: "Use jobs cancel <id> to remove a job",
+		})
+	},
+}
+
+func (bot *MusicBot) cancelJob(message Message, parameter string) {
+	words := strings.Fields(parameter)
+	if len(words) != 2 || words[0] != "cancel" {
+		bot.ReplyToMessage(message, "jobs cancel <id>")
+		return
+	}
+
+	id, err := strconv.Atoi(words[1])
+	if err != nil {
+		bot.ReplyToMessage(message, "jobs cancel <id>")
+		return
+	}
+
+	if err := bot.jobs.Cancel(id); err != nil {
+		bot.ReplyToMessage(message, fmt.Sprintf("unable to cancel job %d: %v", id, err))
+		return
+	}
+
+	if message.IsPrivate {
+		bot.BroadcastMessage(fmt.Sprintf("%s cancelled job %d", message.Sender.Name, id))
+	}
+
+	bot.SendReply(message, SuccessReply(fmt.Sprintf("Cancelled job %d", id)))
+}
+
 var aboutCommand = Command{
 	Name: "about",
 	Function: func(bot *MusicBot, message Message) {
@@ -484,9 +1229,14 @@ var aboutCommand = Command{
 			}
 		}
 
-		bot.ReplyToMessage(message, "go-MusicBot by Sven Wiltink: https://github.com/svenwiltink/go-MusicBot")
-		bot.ReplyToMessage(message, fmt.Sprintf("Go: %s", GoVersion))
-		bot.ReplyToMessage(message, fmt.Sprintf("Version: %s", Version))
-		bot.ReplyToMessage(message, fmt.Sprintf("Build date: %s", BuildDate))
+		bot.SendReply(message, Reply{
+			Title: "go-MusicBot by Sven Wiltink",
+			Items: []ReplyItem{
+				{Title: "Source:", Link: "https://github.com/svenwiltink/go-MusicBot"},
+				{Title: "Go:", Text: GoVersion},
+				{Title: "Version:", Text: Version},
+				{Title: "Build date:", Text: BuildDate},
+			},
+		})
 	},
 }
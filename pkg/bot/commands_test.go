@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSeekPosition(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		parameter string
+		position  time.Duration
+		relative  bool
+	}{
+		{"90", 90 * time.Second, false},
+		{"1:30", 90 * time.Second, false},
+		{"1:02:03", time.Hour + 2*time.Minute + 3*time.Second, false},
+		{"+30", 30 * time.Second, true},
+		{"-10", -10 * time.Second, true},
+		{"+1:00", time.Minute, true},
+	}
+
+	for _, test := range tests {
+		position, relative, err := parseSeekPosition(test.parameter)
+		if assert.NoError(t, err, test.parameter) {
+			assert.Equal(t, test.position, position, test.parameter)
+			assert.Equal(t, test.relative, relative, test.parameter)
+		}
+	}
+}
+
+func TestParseSeekPosition_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, parameter := range []string{"", "banaan", "1:2:3:4", "1::30", "+-1"} {
+		_, _, err := parseSeekPosition(parameter)
+		assert.Error(t, err, parameter)
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "swiltink", sanitizeName(" swiltink "))
+	assert.Equal(t, "U123", sanitizeName("<@U123>"))
+	assert.Equal(t, "U123", sanitizeName("<@U123|swiltink>"))
+}
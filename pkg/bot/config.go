@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
@@ -12,19 +13,27 @@ import (
 const (
 	DefaultConfigFileLocation = "config.json"
 	DefaultAllowListFile      = "allowlist.txt"
+	DefaultJobsFile           = "jobs.json"
+	DefaultStateFile          = "state.json"
 	DefaultAdmin              = "swiltink"
 	DefaultCommandPrefix      = "!music"
 	DefaultShortCommandPrefix = "!m"
+	DefaultSlackSlashCommand  = "/music"
+	DefaultZoneName           = "default"
 )
 
 type SlackConfig struct {
 	Token            string `json:"Token"`
 	ApplicationToken string `json:"applicationtoken"`
 	Channel          string `json:"channel"`
+	SlashCommand     string `json:"slashcommand"`
 }
 
 type Config struct {
-	AllowListFile      string           `json:"allowlistFile"`
+	AllowListFile string `json:"allowlistFile"`
+	JobsFile      string `json:"jobsFile"`
+	// StateFile stores the state of the zones, like their repeat mode
+	StateFile          string           `json:"stateFile"`
 	Admin              string           `json:"admin"`
 	Irc                IRCConfig        `json:"irc"`
 	Rocketchat         RocketchatConfig `json:"rocketchat"`
@@ -36,15 +45,139 @@ type Config struct {
 	ShortCommandPrefix string           `json:"shortcommandprefix"`
 	MpvPath            string           `json:"mpvpath"`
 	MpvSocket          string           `json:"mpvsocket"`
+	// MpvArgs are extra command line arguments for mpv
+	MpvArgs []string `json:"mpvargs"`
+	// MpvAudioDevice is the audio output mpv starts with, see mpv --audio-device=help
+	MpvAudioDevice string `json:"mpvaudiodevice"`
+	// MpvProfile is the name of a profile in mpv.conf
+	MpvProfile string `json:"mpvprofile"`
+	// MpvVolume is the volume mpv starts with
+	MpvVolume int `json:"mpvvolume"`
+	// MpvYtdlFormat is the format used for youtube and other ytdl sources, like bestaudio
+	MpvYtdlFormat string `json:"mpvytdlformat"`
+	// Agent is the websocket address of a go-musicbot-agent, like ws://speakers:8100/agent, or
+	// wss:// when the agent serves TLS. The music is played by the agent instead of a local mpv.
+	Agent      string `json:"agent"`
+	AgentToken string `json:"agenttoken"`
+	// Mpd is the address of an MPD server, like localhost:6600. The music is played by MPD
+	// instead of a local mpv.
+	Mpd         string `json:"mpd"`
+	MpdPassword string `json:"mpdpassword"`
+	// FadeOut is the time in milliseconds it takes to fade out a song when it is skipped
+	FadeOut       time.Duration       `json:"fadeout"`
+	Normalization NormalizationConfig `json:"normalization"`
+	Schedule      []ScheduleRule      `json:"schedule"`
+	Stream        StreamConfig        `json:"stream"`
+	Prefetch      PrefetchConfig      `json:"prefetch"`
+	Cache         CacheConfig         `json:"cache"`
+	Metadata      MetadataConfig      `json:"metadata"`
+	// Zones are rooms with their own player and queue. Without zones there is a single zone
+	// using the top level mpv settings.
+	Zones []ZoneConfig `json:"zones"`
+}
+
+// ZoneConfig configures a room with its own mpv instance, queue and volume
+type ZoneConfig struct {
+	Name string `json:"name"`
+	// Channel is the chat channel of the zone, commands from there control this zone by
+	// default. This is the channel name for IRC and the channel id for Slack and Mattermost.
+	Channel   string `json:"channel"`
+	MpvSocket string `json:"mpvsocket"`
+	// MpvAudioDevice and MpvVolume default to the top level settings. MpvVolume is a pointer so
+	// a volume of 0 can be told apart from no volume.
+	MpvAudioDevice string `json:"mpvaudiodevice"`
+	MpvVolume      *int   `json:"mpvvolume"`
+	// Agent plays the music of the zone on another machine, MpvSocket is not used then.
+	// AgentToken defaults to the top level token.
+	Agent      string `json:"agent"`
+	AgentToken string `json:"agenttoken"`
+	// Mpd plays the music of the zone on an MPD server, MpvSocket is not used then.
+	// MpdPassword defaults to the top level password.
+	Mpd         string `json:"mpd"`
+	MpdPassword string `json:"mpdpassword"`
+}
+
+// StreamConfig configures the http stream of the music, for listeners outside of the office.
+// The stream follows the volume and seeking of the first zone by decoding the song again.
+type StreamConfig struct {
+	Enabled bool `json:"enabled"`
+	// Listen is the address the http server listens on, like :8000
+	Listen string `json:"listen"`
+	// Path is the path of the stream, like /stream.mp3
+	Path string `json:"path"`
+	Name string `json:"name"`
+	// Bitrate of the stream in kbit/s
+	Bitrate int `json:"bitrate"`
+}
+
+// PrefetchConfig configures preparing the next songs of the queue with yt-dlp, so they start
+// faster
+type PrefetchConfig struct {
+	Enabled bool `json:"enabled"`
+	// Ahead is the amount of songs in the queue that are prepared
+	Ahead int `json:"ahead"`
+}
+
+// CacheConfig configures the audio cache. The prefetcher downloads the songs to the cache
+// instead of only resolving their url, so it requires the prefetcher. Cached audio only works
+// for zones that play on the machine of the bot.
+type CacheConfig struct {
+	Enabled   bool   `json:"enabled"`
+	Directory string `json:"directory"`
+	// MaxSize is the size of the cache in MB, the least recently played songs are removed first
+	MaxSize int64 `json:"maxsize"`
+	// MaxAge is the time in hours songs that are not played are kept
+	MaxAge time.Duration `json:"maxage"`
+}
+
+// MetadataConfig configures the cache of the metadata of songs and search results, so they
+// don't have to be looked up again. It is kept in memory, and in File when it is set.
+type MetadataConfig struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"`
+	// TTL is the time in hours the metadata of a song is used
+	TTL time.Duration `json:"ttl"`
+	// SearchTTL is the time in minutes the results of a search are used
+	SearchTTL time.Duration `json:"searchttl"`
+}
+
+// ScheduleRule restricts the player during a window of time, like quiet hours after 18:00
+type ScheduleRule struct {
+	Name string `json:"name"`
+	// Cron is a cron expression for the start of the window, like "30 9 * * mon-fri"
+	Cron string `json:"cron"`
+	// Duration is the length of the window in minutes
+	Duration time.Duration `json:"duration"`
+	// MaxVolume caps the volume during the window, 0 means the volume is not capped
+	MaxVolume int `json:"maxvolume"`
+	// Pause pauses the player when the window starts and resumes it when the window ends
+	Pause bool `json:"pause"`
+	// BlockAdds prevents songs from being added during the window
+	BlockAdds bool `json:"blockadds"`
+}
+
+type NormalizationConfig struct {
+	Enabled bool `json:"enabled"`
+	// Filter is the ffmpeg filter used to normalise the loudness, like dynaudnorm or loudnorm
+	Filter string `json:"filter"`
+	// ReplayGain is the ReplayGain mode used for local files: no, track or album
+	ReplayGain string `json:"replaygain"`
 }
 
 type IRCConfig struct {
-	Server   string `json:"server"`
-	Channel  string `json:"channel"`
-	Nick     string `json:"nick"`
-	RealName string `json:"realname"`
-	Pass     string `json:"pass"`
-	Ssl      bool   `json:"ssl"`
+	Server       string `json:"server"`
+	Channel      string `json:"channel"`
+	Nick         string `json:"nick"`
+	RealName     string `json:"realname"`
+	Pass         string `json:"pass"`
+	Ssl          bool   `json:"ssl"`
+	NickServPass string `json:"nickservpass"`
+	SaslUser     string `json:"sasluser"`
+	SaslPass     string `json:"saslpass"`
+	// FloodBurst is the amount of messages that can be sent at once before throttling kicks in
+	FloodBurst int `json:"floodburst"`
+	// FloodDelay is the time between messages in milliseconds once throttled
+	FloodDelay time.Duration `json:"flooddelay"`
 }
 
 type RocketchatConfig struct {
@@ -56,24 +189,55 @@ type RocketchatConfig struct {
 }
 
 type MattermostConfig struct {
-	Server             string        `json:"server"`
-	Teamname           string        `json:"teamname"`
-	PrivateAccessToken string        `json:"privateAccessToken"`
-	Channel            string        `json:"channel"`
-	Ssl                bool          `json:"ssl"`
-	ConnectionTimeout  time.Duration `json:"connectionTimeout"`
+	Server             string `json:"server"`
+	Teamname           string `json:"teamname"`
+	PrivateAccessToken string `json:"privateAccessToken"`
+	// Channel is the primary channel, all broadcasts are sent here
+	Channel string `json:"channel"`
+	// Channels are additional channels the bot listens to
+	Channels          []string      `json:"channels"`
+	Ssl               bool          `json:"ssl"`
+	ConnectionTimeout time.Duration `json:"connectionTimeout"`
+	// CacheTTL is the time in seconds users and channels are cached
+	CacheTTL time.Duration `json:"cacheTTL"`
+	// Reactions replaces confirmation messages by a reaction on the command
+	Reactions bool `json:"reactions"`
 }
 
+// YoutubeConfig configures the youtube api. Without an api key, or when its quota is used up,
+// youtube is searched with yt-dlp.
 type YoutubeConfig struct {
 	APIKey string `json:"apiKey"`
+	// DailyQuota is the amount of quota units the api key may use per day, 0 uses the default
+	// quota of an api key
+	DailyQuota int `json:"dailyquota"`
 }
 
 func (config *Config) applyDefaults() {
 	config.AllowListFile = DefaultAllowListFile
+	config.JobsFile = DefaultJobsFile
+	config.StateFile = DefaultStateFile
 	config.Admin = DefaultAdmin
 	config.CommandPrefix = DefaultCommandPrefix
 	config.ShortCommandPrefix = DefaultShortCommandPrefix
 	config.Mattermost.ConnectionTimeout = 30
+	config.Mattermost.CacheTTL = 300
+	config.Irc.FloodBurst = 4
+	config.Irc.FloodDelay = 1000
+	config.Slack.SlashCommand = DefaultSlackSlashCommand
+	config.MpvVolume = 50
+	config.Stream.Listen = ":8000"
+	config.Stream.Path = "/stream.mp3"
+	config.Stream.Name = "go-musicbot"
+	config.Stream.Bitrate = 128
+	config.Prefetch.Ahead = 3
+	config.Cache.Directory = "cache"
+	config.Cache.MaxSize = 1024
+	config.Cache.MaxAge = 30 * 24
+	config.Metadata.TTL = 7 * 24
+	config.Metadata.SearchTTL = 60
+	config.Normalization.Filter = "dynaudnorm"
+	config.Normalization.ReplayGain = "track"
 }
 
 func (config *Config) CheckForErrors() error {
@@ -81,9 +245,144 @@ func (config *Config) CheckForErrors() error {
 		return errors.Errorf("Mattermost ConnectionTimeout too low %d. Must be >= 10 seconds", config.Mattermost.ConnectionTimeout)
 	}
 
+	names := make(map[string]bool)
+	sockets := make(map[string]bool)
+	for _, zone := range config.Zones {
+		if zone.Name == "" || strings.ContainsAny(zone.Name, "@ ") {
+			return errors.Errorf("Zone name %q must not be empty or contain @ or spaces", zone.Name)
+		}
+
+		if zone.MpvVolume != nil && (*zone.MpvVolume < 0 || *zone.MpvVolume > 100) {
+			return errors.Errorf("Zone %s: MpvVolume must be between 0 and 100, not %d", zone.Name, *zone.MpvVolume)
+		}
+
+		if zone.Agent != "" || zone.Mpd != "" {
+			if names[zone.Name] {
+				return errors.Errorf("Zone %s: the name of zones must be unique", zone.Name)
+			}
+
+			names[zone.Name] = true
+			continue
+		}
+
+		if zone.MpvSocket == "" {
+			return errors.Errorf("Zone %s: MpvSocket, Agent or Mpd is required", zone.Name)
+		}
+
+		if names[zone.Name] || sockets[zone.MpvSocket] {
+			return errors.Errorf("Zone %s: the name and MpvSocket of zones must be unique", zone.Name)
+		}
+
+		names[zone.Name] = true
+		sockets[zone.MpvSocket] = true
+	}
+
+	if config.MpvVolume < 0 || config.MpvVolume > 100 {
+		return errors.Errorf("MpvVolume must be between 0 and 100, not %d", config.MpvVolume)
+	}
+
+	if config.Stream.Enabled && (config.Stream.Bitrate < 32 || config.Stream.Bitrate > 320) {
+		return errors.Errorf("Stream Bitrate must be between 32 and 320 kbit/s, not %d", config.Stream.Bitrate)
+	}
+
+	if config.Prefetch.Enabled && config.Prefetch.Ahead < 1 {
+		return errors.Errorf("Prefetch Ahead must be at least 1, not %d", config.Prefetch.Ahead)
+	}
+
+	if config.Cache.Enabled && !config.Prefetch.Enabled {
+		return errors.Errorf("Cache requires Prefetch to be enabled, the prefetcher fills the cache")
+	}
+
+	if config.Cache.MaxSize < 0 || config.Cache.MaxAge < 0 {
+		return errors.Errorf("Cache MaxSize and MaxAge can not be negative")
+	}
+
+	if config.Youtube.DailyQuota < 0 {
+		return errors.Errorf("Youtube DailyQuota can not be negative")
+	}
+
+	if config.Metadata.TTL < 0 || config.Metadata.SearchTTL < 0 {
+		return errors.Errorf("Metadata TTL and SearchTTL can not be negative")
+	}
+
+	if config.FadeOut < 0 {
+		return errors.Errorf("FadeOut can not be negative")
+	}
+
+	switch config.Normalization.ReplayGain {
+	case "no", "track", "album":
+	default:
+		return errors.Errorf("Normalization ReplayGain must be one of no, track or album, not %s", config.Normalization.ReplayGain)
+	}
+
+	for _, rule := range config.Schedule {
+		if _, err := parseCron(rule.Cron); err != nil {
+			return errors.Errorf("Schedule rule %s: %v", rule.Name, err)
+		}
+
+		if rule.Duration <= 0 {
+			return errors.Errorf("Schedule rule %s: Duration must be > 0 minutes", rule.Name)
+		}
+
+		if rule.MaxVolume < 0 || rule.MaxVolume > 100 {
+			return errors.Errorf("Schedule rule %s: MaxVolume must be between 0 and 100", rule.Name)
+		}
+	}
+
+	if config.Irc.FloodBurst < 1 {
+		return errors.Errorf("IRC FloodBurst too low %d. Must be >= 1", config.Irc.FloodBurst)
+	}
+
+	if config.Irc.FloodDelay < 0 {
+		return errors.Errorf("IRC FloodDelay can not be negative")
+	}
+
 	return nil
 }
 
+// GetZones returns the configured zones with the top level mpv settings as defaults, or a
+// single default zone when no zones are configured
+func (config *Config) GetZones() []ZoneConfig {
+	if len(config.Zones) == 0 {
+		volume := config.MpvVolume
+
+		return []ZoneConfig{{
+			Name:           DefaultZoneName,
+			MpvSocket:      config.MpvSocket,
+			MpvAudioDevice: config.MpvAudioDevice,
+			MpvVolume:      &volume,
+			Agent:          config.Agent,
+			AgentToken:     config.AgentToken,
+			Mpd:            config.Mpd,
+			MpdPassword:    config.MpdPassword,
+		}}
+	}
+
+	zones := make([]ZoneConfig, 0, len(config.Zones))
+	for _, zone := range config.Zones {
+		if zone.MpvAudioDevice == "" {
+			zone.MpvAudioDevice = config.MpvAudioDevice
+		}
+
+		if zone.MpvVolume == nil {
+			volume := config.MpvVolume
+			zone.MpvVolume = &volume
+		}
+
+		if zone.AgentToken == "" {
+			zone.AgentToken = config.AgentToken
+		}
+
+		if zone.MpdPassword == "" {
+			zone.MpdPassword = config.MpdPassword
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones
+}
+
 func LoadConfig(fileLocation string) (*Config, error) {
 	file, err := os.Open(fileLocation)
 
@@ -101,6 +400,9 @@ func LoadConfig(fileLocation string) (*Config, error) {
 		return nil, fmt.Errorf("unable to decode config file: %v", err)
 	}
 
+	// older versions configured slack admins as <@U123>, they are identified by the id now
+	config.Admin = sanitizeName(config.Admin)
+
 	err = config.CheckForErrors()
 	return config, err
 }
@@ -0,0 +1,154 @@
+package bot
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdayNames = map[string]int{
+	"sun": 0,
+	"mon": 1,
+	"tue": 2,
+	"wed": 3,
+	"thu": 4,
+	"fri": 5,
+	"sat": 6,
+}
+
+// cronExpression is a parsed cron expression with the fields minute, hour, day of month, month
+// and day of week. Every field is stored as a bitset of the values it matches.
+type cronExpression struct {
+	minutes  uint64
+	hours    uint64
+	days     uint64
+	months   uint64
+	weekdays uint64
+	// anyDay and anyWeekday are set when the field is *. Like cron, a time matches either the
+	// day of month or the day of week when both are restricted.
+	anyDay     bool
+	anyWeekday bool
+}
+
+// parseCron parses a cron expression like "30 9 * * mon-fri". Fields support *, lists, ranges
+// and steps. Days of the week can be given as a number, where both 0 and 7 are sunday, or by name.
+func parseCron(expression string) (cronExpression, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return cronExpression{}, fmt.Errorf("cron expression %q must have 5 fields", expression)
+	}
+
+	var cron cronExpression
+	var err error
+
+	if cron.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return cronExpression{}, fmt.Errorf("invalid minute in %q: %v", expression, err)
+	}
+
+	if cron.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return cronExpression{}, fmt.Errorf("invalid hour in %q: %v", expression, err)
+	}
+
+	if cron.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return cronExpression{}, fmt.Errorf("invalid day of month in %q: %v", expression, err)
+	}
+
+	if cron.months, err = parseCronField(fields[3], 1, 12, nil); err != nil {
+		return cronExpression{}, fmt.Errorf("invalid month in %q: %v", expression, err)
+	}
+
+	if cron.weekdays, err = parseCronField(fields[4], 0, 7, weekdayNames); err != nil {
+		return cronExpression{}, fmt.Errorf("invalid day of week in %q: %v", expression, err)
+	}
+
+	// 7 is sunday as well
+	if cron.weekdays&(1<<7) != 0 {
+		cron.weekdays |= 1
+	}
+
+	cron.anyDay = fields[2] == "*"
+	cron.anyWeekday = fields[4] == "*"
+
+	return cron, nil
+}
+
+func parseCronField(field string, min int, max int, names map[string]int) (uint64, error) {
+	var bits uint64
+
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		if index := strings.Index(part, "/"); index != -1 {
+			var err error
+			step, err = strconv.Atoi(part[index+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step %q", part[index+1:])
+			}
+
+			part = part[:index]
+		}
+
+		start, end := min, max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+
+			var err error
+			start, err = parseCronValue(bounds[0], names)
+			if err != nil {
+				return 0, err
+			}
+
+			end = start
+			if len(bounds) == 2 {
+				end, err = parseCronValue(bounds[1], names)
+				if err != nil {
+					return 0, err
+				}
+			} else if step > 1 {
+				// like cron, a single value with a step runs until the maximum
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("%q is not within %d-%d", part, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+
+	return bits, nil
+}
+
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if number, exists := names[strings.ToLower(value)]; exists {
+		return number, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+
+	return number, nil
+}
+
+// matches returns whether the expression matches the minute of the given time
+func (cron cronExpression) matches(t time.Time) bool {
+	if cron.minutes&(1<<uint(t.Minute())) == 0 ||
+		cron.hours&(1<<uint(t.Hour())) == 0 ||
+		cron.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	day := cron.days&(1<<uint(t.Day())) != 0
+	weekday := cron.weekdays&(1<<uint(t.Weekday())) != 0
+
+	if cron.anyDay || cron.anyWeekday {
+		return day && weekday
+	}
+
+	return day || weekday
+}
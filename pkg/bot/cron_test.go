@@ -0,0 +1,54 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCron(t *testing.T) {
+	t.Parallel()
+
+	// 2021-06-07 is a monday
+	monday := time.Date(2021, time.June, 7, 9, 30, 0, 0, time.Local)
+	sunday := time.Date(2021, time.June, 6, 9, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		expression string
+		time       time.Time
+		matches    bool
+	}{
+		{"* * * * *", monday, true},
+		{"30 9 * * *", monday, true},
+		{"31 9 * * *", monday, false},
+		{"*/15 9 * * *", monday, true},
+		{"*/20 9 * * *", monday, false},
+		{"0,30 8-10 * * *", monday, true},
+		{"30 9 * * mon-fri", monday, true},
+		{"30 9 * * mon-fri", sunday, false},
+		{"30 9 * * 7", sunday, true},
+		{"30 9 * * 0", sunday, true},
+		{"30 9 7 * *", monday, true},
+		{"30 9 * 7 *", monday, false},
+		// like cron, a restricted day of month or day of week matches
+		{"30 9 6 * mon", monday, true},
+		{"30 9 6 * tue", monday, false},
+	}
+
+	for _, test := range tests {
+		cron, err := parseCron(test.expression)
+		if assert.NoError(t, err, test.expression) {
+			assert.Equal(t, test.matches, cron.matches(test.time), test.expression)
+		}
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	t.Parallel()
+
+	for _, expression := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * * foo", "5-1 * * * *", "*/0 * * * *"} {
+		_, err := parseCron(expression)
+		assert.Error(t, err, expression)
+	}
+}
@@ -0,0 +1,219 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// missedJobGrace is how late a job may still run, for example when the bot was restarted
+const missedJobGrace = 5 * time.Minute
+
+var errJobNotFound = errors.New("job not found")
+
+// schedulableCommands are the commands that can be run by a job
+var schedulableCommands = map[string]bool{
+	addCommand.Name:    true,
+	pausedCommand.Name: true,
+	playCommand.Name:   true,
+	nextCommand.Name:   true,
+	flushCommand.Name:  true,
+	volCommand.Name:    true,
+}
+
+// Job runs a command at a later time on behalf of the sender of the message
+type Job struct {
+	ID int       `json:"id"`
+	At time.Time `json:"at"`
+	// Message is the message that scheduled the job, with the command to run as its text
+	Message Message `json:"message"`
+}
+
+// JobList keeps track of the scheduled jobs and stores them on disk so they survive a restart
+type JobList struct {
+	path   string
+	jobs   map[int]*Job
+	timers map[int]*time.Timer
+	nextID int
+	run    func(job Job)
+	lock   sync.Mutex
+}
+
+func LoadJobList(path string) (*JobList, error) {
+	instance := &JobList{
+		path:   path,
+		jobs:   make(map[int]*Job),
+		timers: make(map[int]*time.Timer),
+		nextID: 1,
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return instance, nil
+	}
+
+	if err != nil {
+		return instance, fmt.Errorf("unable to open file %s: %v", path, err)
+	}
+
+	var jobs []*Job
+	if err := json.Unmarshal(data, &jobs); err != nil {
+		return instance, fmt.Errorf("unable to decode jobs in %s: %v", path, err)
+	}
+
+	for _, job := range jobs {
+		instance.jobs[job.ID] = job
+		if job.ID >= instance.nextID {
+			instance.nextID = job.ID + 1
+		}
+	}
+
+	return instance, nil
+}
+
+// Start schedules the loaded jobs. Jobs are passed to run when they are due.
+func (list *JobList) Start(run func(job Job)) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	list.run = run
+
+	for _, job := range list.jobs {
+		if time.Since(job.At) > missedJobGrace {
+			log.Printf("Jobs: skipping job %d, it should have run at %s", job.ID, job.At)
+			delete(list.jobs, job.ID)
+			continue
+		}
+
+		list.schedule(job)
+	}
+
+	if err := list.write(); err != nil {
+		log.Printf("Jobs: unable to save jobs: %v", err)
+	}
+}
+
+// Add schedules the command in the message to run at the given time
+func (list *JobList) Add(at time.Time, message Message) (Job, error) {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	job := &Job{
+		ID:      list.nextID,
+		At:      at,
+		Message: message,
+	}
+
+	list.nextID++
+	list.jobs[job.ID] = job
+
+	if list.run != nil {
+		list.schedule(job)
+	}
+
+	return *job, list.write()
+}
+
+// Cancel removes the job so it won't run
+func (list *JobList) Cancel(id int) error {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	if _, exists := list.jobs[id]; !exists {
+		return errJobNotFound
+	}
+
+	if timer, exists := list.timers[id]; exists {
+		timer.Stop()
+		delete(list.timers, id)
+	}
+
+	delete(list.jobs, id)
+
+	return list.write()
+}
+
+// Jobs returns the scheduled jobs, the first one to run first
+func (list *JobList) Jobs() []Job {
+	list.lock.Lock()
+	defer list.lock.Unlock()
+
+	jobs := make([]Job, 0, len(list.jobs))
+	for _, job := range list.jobs {
+		jobs = append(jobs, *job)
+	}
+
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].At.Before(jobs[j].At)
+	})
+
+	return jobs
+}
+
+func (list *JobList) schedule(job *Job) {
+	list.timers[job.ID] = time.AfterFunc(time.Until(job.At), func() {
+		list.lock.Lock()
+		_, exists := list.jobs[job.ID]
+		delete(list.jobs, job.ID)
+		delete(list.timers, job.ID)
+
+		if err := list.write(); err != nil {
+			log.Printf("Jobs: unable to save jobs: %v", err)
+		}
+		list.lock.Unlock()
+
+		// the job was cancelled while the timer fired
+		if !exists {
+			return
+		}
+
+		log.Printf("Jobs: running job %d: %s", job.ID, job.Message.Message)
+		list.run(*job)
+	})
+}
+
+func (list *JobList) write() error {
+	jobs := make([]*Job, 0, len(list.jobs))
+	for _, job := range list.jobs {
+		jobs = append(jobs, job)
+	}
+
+	data, err := json.MarshalIndent(jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(list.path, data, 0666)
+}
+
+// parseClockTime parses a time like 17:00 and returns the next moment it is that time
+func parseClockTime(value string, now time.Time) (time.Time, error) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return time.Time{}, fmt.Errorf("invalid time %s, use HH:MM", value)
+	}
+
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 23 {
+		return time.Time{}, fmt.Errorf("invalid hour in %s", value)
+	}
+
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid minute in %s", value)
+	}
+
+	at := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+
+	return at, nil
+}
@@ -0,0 +1,89 @@
+package bot
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseClockTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2021, time.June, 7, 16, 30, 0, 0, time.Local)
+
+	at, err := parseClockTime("17:00", now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2021, time.June, 7, 17, 0, 0, 0, time.Local), at)
+	}
+
+	// times that already passed today are tomorrow
+	at, err = parseClockTime("9:15", now)
+	if assert.NoError(t, err) {
+		assert.Equal(t, time.Date(2021, time.June, 8, 9, 15, 0, 0, time.Local), at)
+	}
+
+	for _, value := range []string{"17", "24:00", "17:60", "aa:bb", ""} {
+		_, err := parseClockTime(value, now)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestJobList_Persist(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "jobs.json")
+
+	list, err := LoadJobList(path)
+	assert.NoError(t, err)
+
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	first, err := list.Add(at, Message{Message: "pause", Sender: Sender{Name: "sven"}})
+	assert.NoError(t, err)
+	second, err := list.Add(at.Add(-time.Minute), Message{Message: "flush"})
+	assert.NoError(t, err)
+
+	assert.NoError(t, list.Cancel(second.ID))
+	assert.Equal(t, errJobNotFound, list.Cancel(second.ID))
+
+	loaded, err := LoadJobList(path)
+	assert.NoError(t, err)
+
+	jobs := loaded.Jobs()
+	if assert.Len(t, jobs, 1) {
+		assert.Equal(t, first.ID, jobs[0].ID)
+		assert.True(t, at.Equal(jobs[0].At))
+		assert.Equal(t, "pause", jobs[0].Message.Message)
+		assert.Equal(t, "sven", jobs[0].Message.Sender.Name)
+	}
+
+	// ids of loaded jobs are not reused after a restart
+	third, err := loaded.Add(at, Message{Message: "play"})
+	assert.NoError(t, err)
+	assert.Greater(t, third.ID, first.ID)
+}
+
+func TestJobList_Run(t *testing.T) {
+	t.Parallel()
+
+	list, err := LoadJobList(filepath.Join(t.TempDir(), "jobs.json"))
+	assert.NoError(t, err)
+
+	ran := make(chan Job, 1)
+	list.Start(func(job Job) {
+		ran <- job
+	})
+
+	_, err = list.Add(time.Now().Add(10*time.Millisecond), Message{Message: "next"})
+	assert.NoError(t, err)
+
+	select {
+	case job := <-ran:
+		assert.Equal(t, "next", job.Message.Message)
+	case <-time.After(time.Second):
+		t.Fatal("job did not run")
+	}
+
+	assert.Empty(t, list.Jobs())
+}
@@ -5,15 +5,32 @@ import (
 )
 
 type Sender struct {
+	// ID is a stable identifier of the sender, if the chat platform has one
+	ID       string
 	Name     string
 	NickName string
 }
 
+// Identity returns the identifier used for the admin and allowlist checks
+func (sender Sender) Identity() string {
+	if sender.ID != "" {
+		return sender.ID
+	}
+
+	return sender.Name
+}
+
 type Message struct {
 	Message   string
 	Sender    Sender
 	Target    string
 	IsPrivate bool
+	// ID is the identifier of the message on the chat platform, if it has one
+	ID string
+	// Thread is the thread the message was posted in, if any
+	Thread string
+	// Zone is the name of the zone the command is for, it is set when the command is handled
+	Zone string
 }
 
 func (message Message) getCommandWord() string {
@@ -2,7 +2,19 @@ package bot
 
 type MessageProvider interface {
 	GetMessageChannel() chan Message
-	SendReplyToMessage(message Message, reply string) error
-	BroadcastMessage(message string) error
+	SendReplyToMessage(message Message, reply Reply) error
+	BroadcastMessage(message Reply) error
 	Start() error
 }
+
+// DirectMessenger is implemented by message providers that can message users privately
+type DirectMessenger interface {
+	// SendDirectMessage sends the reply privately to the user with the identity
+	SendDirectMessage(identity string, reply Reply) error
+}
+
+// Mentioner is implemented by message providers that mention users in a special way
+type Mentioner interface {
+	// Mention returns the text that mentions the user with the identity
+	Mention(identity string) string
+}
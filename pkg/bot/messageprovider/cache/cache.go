@@ -0,0 +1,50 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry[T any] struct {
+	value   T
+	expires time.Time
+}
+
+// TTLCache is a small cache for chat API lookups, entries expire after the ttl
+type TTLCache[T any] struct {
+	ttl     time.Duration
+	lock    sync.Mutex
+	entries map[string]entry[T]
+}
+
+func NewTTLCache[T any](ttl time.Duration) *TTLCache[T] {
+	return &TTLCache[T]{
+		ttl:     ttl,
+		entries: make(map[string]entry[T]),
+	}
+}
+
+func (cache *TTLCache[T]) Get(key string) (T, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cached, exists := cache.entries[key]
+	if !exists || time.Now().After(cached.expires) {
+		delete(cache.entries, key)
+
+		var empty T
+		return empty, false
+	}
+
+	return cached.value, true
+}
+
+func (cache *TTLCache[T]) Set(key string, value T) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries[key] = entry[T]{
+		value:   value,
+		expires: time.Now().Add(cache.ttl),
+	}
+}
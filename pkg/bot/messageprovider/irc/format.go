@@ -0,0 +1,32 @@
+package irc
+
+import (
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/bot"
+)
+
+// IRC formatting control codes
+const (
+	formatBold  = "\x02"
+	formatColor = "\x03"
+	colorBlue   = "12"
+	colorGrey   = "14"
+)
+
+func color(color string, text string) string {
+	return formatColor + color + text + formatColor
+}
+
+var ircStyle = bot.LineStyle{
+	Text:     func(text string) string { return text },
+	Emphasis: func(text string) string { return formatBold + text + formatBold },
+	Link: func(text string, link string) string {
+		if text == "" {
+			return color(colorBlue, link)
+		}
+		return text + " " + color(colorBlue, link)
+	},
+	Duration: func(duration time.Duration) string { return color(colorGrey, "("+bot.FormatDuration(duration)+")") },
+	Muted:    func(text string) string { return color(colorGrey, text) },
+}
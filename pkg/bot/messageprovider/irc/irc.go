@@ -2,19 +2,44 @@ package irc
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 	"time"
 
 	ircclient "github.com/fluffle/goirc/client"
 	"github.com/svenwiltink/go-musicbot/pkg/bot"
 )
 
+const (
+	outgoingQueueSize   = 100
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 5 * time.Minute
+)
+
+var errQueueFull = errors.New("outgoing message queue is full")
+
+type outgoingMessage struct {
+	target string
+	text   string
+}
+
 type MessageProvider struct {
 	Config         *bot.Config
 	MessageChannel chan bot.Message
 	IrcConnection  *ircclient.Conn
+
+	outgoing chan outgoingMessage
+
+	lock sync.Mutex
+	// registered is closed once the server accepted the connection, it is replaced when the
+	// connection is lost
+	registered   chan struct{}
+	reconnecting bool
+	// authenticated tells whether SASL succeeded on the current connection
+	authenticated bool
 }
 
 func (irc *MessageProvider) Start() error {
@@ -23,16 +48,54 @@ func (irc *MessageProvider) Start() error {
 	ircConfig.Pass = irc.Config.Irc.Pass
 	ircConfig.Timeout = time.Second * 5
 
-	log.Printf("%+v", irc.Config.Irc)
+	// flood control and line splitting are done by the outgoing queue
+	ircConfig.Flood = true
+	ircConfig.SplitLen = maxLineBytes
+
 	if irc.Config.Irc.Ssl {
 		ircConfig.SSL = true
 		ircConfig.SSLConfig = &tls.Config{ServerName: strings.Split(irc.Config.Irc.Server, ":")[0]}
 	}
 
 	irc.IrcConnection = ircclient.Client(ircConfig)
+
+	if irc.Config.Irc.SaslUser != "" {
+		irc.registerSaslHandlers()
+	}
+
 	irc.IrcConnection.HandleFunc(ircclient.CONNECTED, func(conn *ircclient.Conn, line *ircclient.Line) {
+		irc.identify(conn)
+
 		log.Println("joining channel")
 		conn.Join(irc.Config.Irc.Channel)
+
+		irc.lock.Lock()
+		select {
+		case <-irc.registered:
+		default:
+			close(irc.registered)
+		}
+		irc.lock.Unlock()
+	})
+
+	irc.IrcConnection.HandleFunc(ircclient.DISCONNECTED, func(conn *ircclient.Conn, line *ircclient.Line) {
+		log.Println("disconnected from IRC")
+
+		irc.lock.Lock()
+		select {
+		case <-irc.registered:
+			irc.registered = make(chan struct{})
+		default:
+		}
+
+		// a reconnect loop that is still running keeps going
+		start := !irc.reconnecting
+		irc.reconnecting = true
+		irc.lock.Unlock()
+
+		if start {
+			go irc.reconnect()
+		}
 	})
 
 	irc.IrcConnection.HandleFunc(ircclient.PRIVMSG, func(conn *ircclient.Conn, line *ircclient.Line) {
@@ -64,16 +127,139 @@ func (irc *MessageProvider) Start() error {
 
 	log.Printf("connected")
 
+	go irc.sendLoop()
+
 	return nil
 }
 
-func (irc *MessageProvider) SendReplyToMessage(message bot.Message, reply string) error {
-	irc.IrcConnection.Privmsg(message.Target, reply)
-	return nil
+// identify identifies with NickServ when SASL is not used, or when the server completed the
+// registration before SASL was done
+func (irc *MessageProvider) identify(conn *ircclient.Conn) {
+	switch {
+	case irc.Config.Irc.SaslUser == "":
+		if irc.Config.Irc.NickServPass != "" {
+			log.Println("identifying with NickServ")
+			conn.Privmsg("NickServ", "IDENTIFY "+irc.Config.Irc.NickServPass)
+		}
+	case !irc.isAuthenticated():
+		log.Println("SASL did not complete before the registration, identifying with NickServ")
+		conn.Privmsg("NickServ", "IDENTIFY "+irc.Config.Irc.SaslUser+" "+irc.Config.Irc.SaslPass)
+	}
+}
+
+// reconnect keeps trying to connect to the server with an exponential backoff. Only one
+// reconnect loop runs at a time.
+func (irc *MessageProvider) reconnect() {
+	backoff := reconnectMinBackoff
+
+	for {
+		log.Printf("Trying to reconnect to server %s in %s", irc.Config.Irc.Server, backoff)
+		time.Sleep(backoff)
+
+		err := irc.IrcConnection.Connect()
+		if err == nil {
+			log.Printf("reconnected")
+		}
+
+		// the connection can be lost again before this loop ends, the disconnect does not
+		// start another loop until reconnecting is reset
+		irc.lock.Lock()
+		if irc.IrcConnection.Connected() {
+			irc.reconnecting = false
+			irc.lock.Unlock()
+			return
+		}
+		irc.lock.Unlock()
+
+		if err != nil {
+			log.Printf("unable to reconnect: %v", err)
+		}
+
+		backoff *= 2
+		if backoff > reconnectMaxBackoff {
+			backoff = reconnectMaxBackoff
+		}
+	}
+}
+
+// sendLoop sends the outgoing messages. The first FloodBurst messages are sent immediately,
+// after that a message is sent every FloodDelay milliseconds.
+func (irc *MessageProvider) sendLoop() {
+	burst := irc.Config.Irc.FloodBurst
+	delay := irc.Config.Irc.FloodDelay * time.Millisecond
+	if delay <= 0 {
+		delay = time.Millisecond
+	}
+
+	tokens := burst
+	ticker := time.NewTicker(delay)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if tokens < burst {
+				tokens++
+			}
+		case message := <-irc.outgoing:
+			for tokens == 0 {
+				<-ticker.C
+				tokens++
+			}
+
+			irc.waitRegistered()
+
+			tokens--
+			irc.IrcConnection.Privmsg(message.target, message.text)
+		}
+	}
 }
 
-func (irc *MessageProvider) BroadcastMessage(message string) error {
-	irc.IrcConnection.Privmsg(irc.Config.Irc.Channel, message)
+// waitRegistered blocks until the server has accepted the connection
+func (irc *MessageProvider) waitRegistered() {
+	irc.lock.Lock()
+	registered := irc.registered
+	irc.lock.Unlock()
+
+	<-registered
+}
+
+// maxMessageBytes calculates the maximum size of a message to the target. The server prefixes
+// the line with our full hostmask when relaying it, so that has to fit in the line as well.
+func (irc *MessageProvider) maxMessageBytes(target string) int {
+	me := irc.IrcConnection.Me()
+
+	hostLength := len(me.Host)
+	if hostLength == 0 {
+		hostLength = maxHostBytes
+	}
+
+	prefix := len(":"+me.Nick+"!"+me.Ident+"@"+" PRIVMSG "+target+" :") + hostLength
+	return maxLineBytes - prefix
+}
+
+func (irc *MessageProvider) SendReplyToMessage(message bot.Message, reply bot.Reply) error {
+	return irc.sendReply(message.Target, reply)
+}
+
+func (irc *MessageProvider) BroadcastMessage(message bot.Reply) error {
+	return irc.sendReply(irc.Config.Irc.Channel, message)
+}
+
+// sendReply queues every line of the reply as a separate message, splitting lines that are too long
+func (irc *MessageProvider) sendReply(target string, reply bot.Reply) error {
+	limit := irc.maxMessageBytes(target)
+
+	for _, line := range reply.Lines(ircStyle) {
+		for _, part := range splitLine(line, limit) {
+			select {
+			case irc.outgoing <- outgoingMessage{target: target, text: part}:
+			default:
+				return errQueueFull
+			}
+		}
+	}
+
 	return nil
 }
 
@@ -85,5 +271,7 @@ func New(config *bot.Config) *MessageProvider {
 	return &MessageProvider{
 		MessageChannel: make(chan bot.Message),
 		Config:         config,
+		outgoing:       make(chan outgoingMessage, outgoingQueueSize),
+		registered:     make(chan struct{}),
 	}
 }
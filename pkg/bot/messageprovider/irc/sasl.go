@@ -0,0 +1,100 @@
+package irc
+
+import (
+	"encoding/base64"
+	"log"
+	"strings"
+
+	ircclient "github.com/fluffle/goirc/client"
+)
+
+// saslChunkSize is the maximum size of a single AUTHENTICATE payload
+const saslChunkSize = 400
+
+// registerSaslHandlers authenticates using SASL PLAIN. goirc sends NICK and USER as soon as it
+// is connected, the capability is requested right after that. Servers hold the registration
+// back once they get the request, as long as they have not completed it yet. Every outcome ends
+// the negotiation so the registration can continue.
+func (irc *MessageProvider) registerSaslHandlers() {
+	irc.IrcConnection.HandleFunc(ircclient.REGISTER, func(conn *ircclient.Conn, line *ircclient.Line) {
+		irc.setAuthenticated(false)
+		conn.Cap("REQ", "sasl")
+	})
+
+	irc.IrcConnection.HandleFunc(ircclient.CAP, func(conn *ircclient.Conn, line *ircclient.Line) {
+		if len(line.Args) < 3 || strings.TrimSpace(line.Args[2]) != "sasl" {
+			return
+		}
+
+		switch line.Args[1] {
+		case "ACK":
+			conn.Raw("AUTHENTICATE PLAIN")
+		case "NAK":
+			log.Println("server does not support SASL")
+			conn.Cap("END")
+		}
+	})
+
+	// servers without capability negotiation don't know the CAP command
+	irc.IrcConnection.HandleFunc("421", func(conn *ircclient.Conn, line *ircclient.Line) {
+		if len(line.Args) > 1 && strings.EqualFold(line.Args[1], "CAP") {
+			log.Println("server does not support SASL")
+			conn.Cap("END")
+		}
+	})
+
+	irc.IrcConnection.HandleFunc("AUTHENTICATE", func(conn *ircclient.Conn, line *ircclient.Line) {
+		if len(line.Args) == 0 || line.Args[0] != "+" {
+			return
+		}
+
+		for _, payload := range saslPayload(irc.Config.Irc.SaslUser, irc.Config.Irc.SaslPass) {
+			conn.Raw("AUTHENTICATE " + payload)
+		}
+	})
+
+	irc.IrcConnection.HandleFunc("903", func(conn *ircclient.Conn, line *ircclient.Line) {
+		log.Println("SASL authentication successful")
+		irc.setAuthenticated(true)
+		conn.Cap("END")
+	})
+
+	for _, numeric := range []string{"902", "904", "905", "906", "907"} {
+		irc.IrcConnection.HandleFunc(numeric, func(conn *ircclient.Conn, line *ircclient.Line) {
+			log.Printf("SASL authentication failed: %s", line.Text())
+			conn.Cap("END")
+		})
+	}
+}
+
+// saslPayload returns the AUTHENTICATE payloads of SASL PLAIN for the user
+func saslPayload(user string, password string) []string {
+	payload := base64.StdEncoding.EncodeToString([]byte(user + "\x00" + user + "\x00" + password))
+	payloads := make([]string, 0, len(payload)/saslChunkSize+1)
+
+	for len(payload) >= saslChunkSize {
+		payloads = append(payloads, payload[:saslChunkSize])
+		payload = payload[saslChunkSize:]
+	}
+
+	// an empty last chunk is sent as +
+	if payload == "" {
+		payload = "+"
+	}
+
+	return append(payloads, payload)
+}
+
+func (irc *MessageProvider) setAuthenticated(authenticated bool) {
+	irc.lock.Lock()
+	defer irc.lock.Unlock()
+
+	irc.authenticated = authenticated
+}
+
+func (irc *MessageProvider) isAuthenticated() bool {
+	irc.lock.Lock()
+	defer irc.lock.Unlock()
+
+	return irc.authenticated
+}
@@ -0,0 +1,116 @@
+package irc
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/bot"
+)
+
+// fakeServer is the connection of the provider to a fake irc server
+type fakeServer struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func startProvider(t *testing.T) (*MessageProvider, *fakeServer) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	config := &bot.Config{}
+	config.Irc = bot.IRCConfig{
+		Server:     listener.Addr().String(),
+		Channel:    "#music",
+		Nick:       "musicbot",
+		SaslUser:   "musicbot",
+		SaslPass:   "secret",
+		FloodBurst: 4,
+		FloodDelay: 1000,
+	}
+
+	provider := New(config)
+	assert.NoError(t, provider.Start())
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return provider, &fakeServer{t: t, conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// expect reads lines until it gets the line, it fails when it does not arrive in time
+func (server *fakeServer) expect(expected string) {
+	_ = server.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+
+	for {
+		line, err := server.reader.ReadString('\n')
+		if err != nil {
+			server.t.Fatalf("%s was not sent: %v", expected, err)
+		}
+
+		if strings.TrimRight(line, "\r\n") == expected {
+			return
+		}
+	}
+}
+
+func (server *fakeServer) send(line string) {
+	_, err := server.conn.Write([]byte(line + "\r\n"))
+	assert.NoError(server.t, err)
+}
+
+func TestMessageProvider_Sasl(t *testing.T) {
+	t.Parallel()
+
+	provider, server := startProvider(t)
+
+	// messages are held back until the registration is done
+	assert.NoError(t, provider.BroadcastMessage(bot.TextReply("hello")))
+
+	server.expect("NICK musicbot")
+	server.expect("CAP REQ :sasl")
+	server.send(":server CAP * ACK :sasl")
+	server.expect("AUTHENTICATE PLAIN")
+	server.send("AUTHENTICATE +")
+	server.expect("AUTHENTICATE " + base64.StdEncoding.EncodeToString([]byte("musicbot\x00musicbot\x00secret")))
+	server.send(":server 903 musicbot :SASL authentication successful")
+	server.expect("CAP END")
+	server.send(":server 001 musicbot :Welcome musicbot!bot@example.com")
+	server.expect("JOIN #music")
+	server.expect("PRIVMSG #music :hello")
+
+	assert.True(t, provider.isAuthenticated())
+}
+
+func TestMessageProvider_SaslAfterRegistration(t *testing.T) {
+	t.Parallel()
+
+	provider, server := startProvider(t)
+
+	// the server completed the registration before it got the request
+	server.expect("CAP REQ :sasl")
+	server.send(":server 001 musicbot :Welcome musicbot!bot@example.com")
+	server.expect("PRIVMSG NickServ :IDENTIFY musicbot secret")
+	server.expect("JOIN #music")
+
+	assert.False(t, provider.isAuthenticated())
+}
+
+func TestSaslPayload(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{base64.StdEncoding.EncodeToString([]byte("user\x00user\x00pass"))}, saslPayload("user", "pass"))
+
+	// a payload of exactly one chunk is followed by an empty chunk
+	payloads := saslPayload("user", strings.Repeat("a", 288))
+	assert.Len(t, payloads, 2)
+	assert.Len(t, payloads[0], saslChunkSize)
+	assert.Equal(t, "+", payloads[1])
+}
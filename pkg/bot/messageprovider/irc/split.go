@@ -0,0 +1,43 @@
+package irc
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxLineBytes is the maximum length of an IRC line excluding the trailing CRLF
+	maxLineBytes = 510
+	// maxHostBytes is assumed as the length of our hostname when the server has not told us yet
+	maxHostBytes = 63
+)
+
+// splitLine splits a line into parts of at most limit bytes. It prefers to split on spaces
+// and never splits in the middle of a UTF-8 encoded character.
+func splitLine(line string, limit int) []string {
+	if limit < utf8.UTFMax {
+		limit = utf8.UTFMax
+	}
+
+	parts := make([]string, 0, len(line)/limit+1)
+
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+
+		if space := strings.LastIndex(line[:cut], " "); space > 0 {
+			cut = space
+		}
+
+		parts = append(parts, line[:cut])
+		line = strings.TrimLeft(line[cut:], " ")
+	}
+
+	if line != "" || len(parts) == 0 {
+		parts = append(parts, line)
+	}
+
+	return parts
+}
@@ -0,0 +1,35 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitLine_Short(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"banaan"}, splitLine("banaan", 10))
+	assert.Equal(t, []string{""}, splitLine("", 10))
+}
+
+func TestSplitLine_Spaces(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"banaan", "appel peer"}, splitLine("banaan appel peer", 10))
+}
+
+func TestSplitLine_NoSpaces(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, []string{"aaaaa", "aaaaa", "aa"}, splitLine(strings.Repeat("a", 12), 5))
+}
+
+func TestSplitLine_Multibyte(t *testing.T) {
+	t.Parallel()
+
+	parts := splitLine(strings.Repeat("é", 5), 5)
+
+	assert.Equal(t, []string{"éé", "éé", "é"}, parts)
+}
@@ -0,0 +1,107 @@
+package mattermost
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/bot"
+)
+
+// markdownEscaper escapes the characters that would format song titles. | is escaped as well,
+// so titles don't break tables.
+var markdownEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"`", "\\`",
+	"*", "\\*",
+	"_", "\\_",
+	"~", "\\~",
+	"#", "\\#",
+	"[", "\\[",
+	"]", "\\]",
+	"(", "\\(",
+	")", "\\)",
+	"<", "\\<",
+	">", "\\>",
+	"|", "\\|",
+)
+
+// linkEscaper keeps urls from ending the link early
+var linkEscaper = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29")
+
+var tableCellEscaper = strings.NewReplacer("\n", " ")
+
+func escape(text string) string {
+	return markdownEscaper.Replace(text)
+}
+
+var markdownStyle = bot.LineStyle{
+	Text:     escape,
+	Emphasis: func(text string) string { return "**" + escape(text) + "**" },
+	Link: func(text string, link string) string {
+		if text == "" {
+			return linkEscaper.Replace(link)
+		}
+		return fmt.Sprintf("[%s](%s)", escape(text), linkEscaper.Replace(link))
+	},
+	Duration: func(duration time.Duration) string { return "(" + bot.FormatDuration(duration) + ")" },
+	Muted:    func(text string) string { return "_" + escape(text) + "_" },
+}
+
+// renderReply renders the reply as markdown. Lists of songs are rendered as a table
+func renderReply(reply bot.Reply) string {
+	if len(reply.Items) <= 1 || !hasDurations(reply.Items) {
+		return strings.Join(reply.Lines(markdownStyle), "\n")
+	}
+
+	var builder strings.Builder
+
+	if reply.Title != "" {
+		builder.WriteString(markdownStyle.Emphasis(reply.Title) + "\n")
+	}
+
+	if reply.Text != "" {
+		builder.WriteString(markdownStyle.Text(reply.Text) + "\n")
+	}
+
+	// tables need an empty line before them
+	builder.WriteString("\n")
+
+	if reply.Numbered {
+		builder.WriteString("| # ")
+	}
+	builder.WriteString("| Title | Duration |\n")
+
+	if reply.Numbered {
+		builder.WriteString("|--:")
+	}
+	builder.WriteString("|:--|--:|\n")
+
+	for index, item := range reply.Items {
+		if reply.Numbered {
+			builder.WriteString(fmt.Sprintf("| %d ", index+1))
+		}
+
+		// render the item without its duration, that has its own column
+		duration := item.Duration
+		item.Duration = 0
+
+		builder.WriteString(fmt.Sprintf("| %s | %s |\n", tableCellEscaper.Replace(item.Render(markdownStyle)), bot.FormatDuration(duration)))
+	}
+
+	if reply.Footer != "" {
+		builder.WriteString("\n" + markdownStyle.Muted(reply.Footer))
+	}
+
+	return builder.String()
+}
+
+func hasDurations(items []bot.ReplyItem) bool {
+	for _, item := range items {
+		if item.Duration > 0 {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,35 @@
+package mattermost
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/bot"
+)
+
+func TestRenderReply_Escape(t *testing.T) {
+	t.Parallel()
+
+	reply := bot.Reply{
+		Title: "Current song",
+		Items: []bot.ReplyItem{{Title: "*NSYNC", Text: "Bye Bye Bye [Official Video]", Link: "https://example.com/watch?v=(1)"}},
+	}
+
+	assert.Equal(t, "**Current song**: **\\*NSYNC** [Bye Bye Bye \\[Official Video\\]](https://example.com/watch?v=%281%29)", renderReply(reply))
+}
+
+func TestRenderReply_Table(t *testing.T) {
+	t.Parallel()
+
+	reply := bot.Reply{
+		Title:    "Search results",
+		Numbered: true,
+		Items: []bot.ReplyItem{
+			{Title: "artist", Text: "a | b", Duration: 3 * time.Minute},
+			{Title: "other_artist", Text: "c", Duration: time.Minute},
+		},
+	}
+
+	assert.Equal(t, "**Search results**\n\n| # | Title | Duration |\n|--:|:--|--:|\n| 1 | **artist** a \\| b | 3:00 |\n| 2 | **other\\_artist** c | 1:00 |\n", renderReply(reply))
+}
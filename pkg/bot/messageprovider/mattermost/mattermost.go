@@ -9,6 +9,7 @@ import (
 	"github.com/gorilla/websocket"
 	mattermost "github.com/mattermost/mattermost-server/v5/model"
 	"github.com/svenwiltink/go-musicbot/pkg/bot"
+	"github.com/svenwiltink/go-musicbot/pkg/bot/messageprovider/cache"
 )
 
 type MessageProvider struct {
@@ -17,6 +18,13 @@ type MessageProvider struct {
 
 	team    *mattermost.Team
 	channel *mattermost.Channel
+	me      *mattermost.User
+
+	// channelIDs contains the ids of all the channels the bot listens to
+	channelIDs map[string]struct{}
+
+	channelCache *cache.TTLCache[*mattermost.Channel]
+	userCache    *cache.TTLCache[*mattermost.User]
 
 	client          *mattermost.Client4
 	websocketClient *mattermost.WebSocketClient
@@ -39,12 +47,31 @@ func (provider *MessageProvider) Start() error {
 
 	provider.team = team
 
+	me, response := provider.client.GetMe("")
+	if response.Error != nil {
+		return fmt.Errorf("unable to get the bot user: %+v", response.Error)
+	}
+
+	provider.me = me
+
 	channel, response := provider.client.GetChannelByName(provider.Config.Mattermost.Channel, team.Id, "")
 	if response.Error != nil {
-		return fmt.Errorf("unable to get channel by name %s: %+v", provider.Config.Mattermost.Teamname, response.Error)
+		return fmt.Errorf("unable to get channel by name %s: %+v", provider.Config.Mattermost.Channel, response.Error)
 	}
 
 	provider.channel = channel
+	provider.channelIDs[channel.Id] = struct{}{}
+	provider.channelCache.Set(channel.Id, channel)
+
+	for _, name := range provider.Config.Mattermost.Channels {
+		channel, response := provider.client.GetChannelByName(name, team.Id, "")
+		if response.Error != nil {
+			return fmt.Errorf("unable to get channel by name %s: %+v", name, response.Error)
+		}
+
+		provider.channelIDs[channel.Id] = struct{}{}
+		provider.channelCache.Set(channel.Id, channel)
+	}
 
 	err := provider.connect()
 	if err != nil {
@@ -57,10 +84,15 @@ func (provider *MessageProvider) Start() error {
 	return nil
 }
 
-func (provider *MessageProvider) SendReplyToMessage(message bot.Message, reply string) error {
+func (provider *MessageProvider) SendReplyToMessage(message bot.Message, reply bot.Reply) error {
+	if provider.Config.Mattermost.Reactions && reply.Reaction != bot.ReactionNone && message.ID != "" {
+		return provider.react(message, reply.Reaction)
+	}
+
 	post := &mattermost.Post{
 		ChannelId: message.Target,
-		Message:   reply,
+		RootId:    message.Thread,
+		Message:   renderReply(reply),
 	}
 
 	_, response := provider.client.CreatePost(post)
@@ -72,10 +104,10 @@ func (provider *MessageProvider) SendReplyToMessage(message bot.Message, reply s
 	return nil
 }
 
-func (provider *MessageProvider) BroadcastMessage(message string) error {
+func (provider *MessageProvider) BroadcastMessage(message bot.Reply) error {
 	post := &mattermost.Post{
 		ChannelId: provider.channel.Id,
-		Message:   message,
+		Message:   renderReply(message),
 	}
 
 	_, response := provider.client.CreatePost(post)
@@ -87,6 +119,50 @@ func (provider *MessageProvider) BroadcastMessage(message string) error {
 	return nil
 }
 
+// SendDirectMessage sends the reply in the direct channel with the user with the username
+func (provider *MessageProvider) SendDirectMessage(identity string, reply bot.Reply) error {
+	user, response := provider.client.GetUserByUsername(identity, "")
+	if response.Error != nil {
+		return fmt.Errorf("unable to get user %s: %+v", identity, response.Error)
+	}
+
+	channel, response := provider.client.CreateDirectChannel(provider.me.Id, user.Id)
+	if response.Error != nil {
+		return fmt.Errorf("unable to create a direct channel with %s: %+v", identity, response.Error)
+	}
+
+	post := &mattermost.Post{
+		ChannelId: channel.Id,
+		Message:   renderReply(reply),
+	}
+
+	_, response = provider.client.CreatePost(post)
+	if response.Error != nil {
+		return fmt.Errorf("unable to post message %+v: %+v", post, response)
+	}
+
+	return nil
+}
+
+func (provider *MessageProvider) react(message bot.Message, reaction bot.Reaction) error {
+	_, response := provider.client.SaveReaction(&mattermost.Reaction{
+		UserId:    provider.me.Id,
+		PostId:    message.ID,
+		EmojiName: string(reaction),
+	})
+
+	if response.Error != nil {
+		return fmt.Errorf("unable to react to post %s: %+v", message.ID, response.Error)
+	}
+
+	return nil
+}
+
+// Mention mentions the user with the username
+func (provider *MessageProvider) Mention(identity string) string {
+	return "@" + identity
+}
+
 func (provider *MessageProvider) GetMessageChannel() chan bot.Message {
 	return provider.MessageChannel
 }
@@ -158,28 +234,38 @@ func (provider *MessageProvider) startReadLoop() {
 }
 
 func (provider *MessageProvider) handleMessage(post *mattermost.Post) {
-	channel, response := provider.client.GetChannel(post.ChannelId, "")
-	if response.Error != nil {
-		log.Printf("unable to get channel by id %s: %+v", post.ChannelId, response)
+	// ignore our own messages
+	if post.UserId == provider.me.Id {
 		return
 	}
 
-	// ignore all messaged not from the channel or direct
-	if channel.Name != provider.Config.Mattermost.Channel && channel.Type != mattermost.CHANNEL_DIRECT {
+	channel, err := provider.getChannel(post.ChannelId)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	private := channel.Type == mattermost.CHANNEL_DIRECT || channel.Type == mattermost.CHANNEL_GROUP
+
+	// ignore all messaged not from the channels or direct
+	_, listening := provider.channelIDs[channel.Id]
+	if !listening && !private {
 		log.Printf("ignoring message from channel %s", channel.Name)
 		return
 	}
 
-	author, response := provider.client.GetUser(post.UserId, "")
-	if response.Error != nil {
-		log.Printf("unable to get user by id %s: %+v", post.ChannelId, response)
+	author, err := provider.getUser(post.UserId)
+	if err != nil {
+		log.Println(err)
 		return
 	}
 
 	msg := bot.Message{
+		ID:        post.Id,
+		Thread:    post.RootId,
 		Target:    post.ChannelId,
 		Message:   post.Message,
-		IsPrivate: channel.Type == mattermost.CHANNEL_DIRECT,
+		IsPrivate: private,
 		Sender: bot.Sender{
 			Name:     author.Username,
 			NickName: author.Nickname,
@@ -189,6 +275,34 @@ func (provider *MessageProvider) handleMessage(post *mattermost.Post) {
 	provider.MessageChannel <- msg
 }
 
+func (provider *MessageProvider) getChannel(id string) (*mattermost.Channel, error) {
+	if channel, exists := provider.channelCache.Get(id); exists {
+		return channel, nil
+	}
+
+	channel, response := provider.client.GetChannel(id, "")
+	if response.Error != nil {
+		return nil, fmt.Errorf("unable to get channel by id %s: %+v", id, response)
+	}
+
+	provider.channelCache.Set(id, channel)
+	return channel, nil
+}
+
+func (provider *MessageProvider) getUser(id string) (*mattermost.User, error) {
+	if user, exists := provider.userCache.Get(id); exists {
+		return user, nil
+	}
+
+	user, response := provider.client.GetUser(id, "")
+	if response.Error != nil {
+		return nil, fmt.Errorf("unable to get user by id %s: %+v", id, response)
+	}
+
+	provider.userCache.Set(id, user)
+	return user, nil
+}
+
 func (provider *MessageProvider) pingLoop() {
 	ticker := time.NewTicker(10 * time.Second)
 
@@ -213,8 +327,13 @@ func (provider *MessageProvider) pingLoop() {
 }
 
 func New(config *bot.Config) *MessageProvider {
+	cacheTTL := config.Mattermost.CacheTTL * time.Second
+
 	return &MessageProvider{
 		MessageChannel: make(chan bot.Message),
 		Config:         config,
+		channelIDs:     make(map[string]struct{}),
+		channelCache:   cache.NewTTLCache[*mattermost.Channel](cacheTTL),
+		userCache:      cache.NewTTLCache[*mattermost.User](cacheTTL),
 	}
 }
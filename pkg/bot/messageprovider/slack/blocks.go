@@ -0,0 +1,110 @@
+package slack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/svenwiltink/go-musicbot/pkg/bot"
+)
+
+// actionPrefix is prepended to the action id of every button. The remainder of the action id
+// is the name of the bot command that should be executed when the button is clicked.
+const actionPrefix = "musicbot-"
+
+var mrkdwnEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escape(text string) string {
+	return mrkdwnEscaper.Replace(text)
+}
+
+var mrkdwnStyle = bot.LineStyle{
+	Text:     escape,
+	Emphasis: func(text string) string { return "*" + escape(text) + "*" },
+	Link: func(text string, link string) string {
+		if text == "" {
+			return "<" + link + ">"
+		}
+		return fmt.Sprintf("<%s|%s>", link, escape(text))
+	},
+	Duration: func(duration time.Duration) string { return "(" + bot.FormatDuration(duration) + ")" },
+	Muted:    func(text string) string { return "_" + escape(text) + "_" },
+}
+
+func actionButton(action bot.ReplyAction) *slack.ButtonBlockElement {
+	return slack.NewButtonBlockElement(
+		actionPrefix+action.Command,
+		action.Parameter,
+		slack.NewTextBlockObject(slack.PlainTextType, action.Label, false, false),
+	)
+}
+
+func markdownSection(text string, accessory *slack.Accessory) *slack.SectionBlock {
+	return slack.NewSectionBlock(slack.NewTextBlockObject(slack.MarkdownType, text, false, false), nil, accessory)
+}
+
+// renderBlocks renders a reply as Block Kit blocks. Items with an action get their own section
+// with a button, the actions of the reply are rendered as a row of buttons.
+func renderBlocks(reply bot.Reply) []slack.Block {
+	if !hasItemActions(reply.Items) {
+		blocks := []slack.Block{markdownSection(strings.Join(reply.Lines(mrkdwnStyle), "\n"), nil)}
+		return append(blocks, actionBlocks(reply.Actions)...)
+	}
+
+	blocks := make([]slack.Block, 0, len(reply.Items)+3)
+
+	header := make([]string, 0, 2)
+	if reply.Title != "" {
+		header = append(header, mrkdwnStyle.Emphasis(reply.Title))
+	}
+	if reply.Text != "" {
+		header = append(header, mrkdwnStyle.Text(reply.Text))
+	}
+	if len(header) > 0 {
+		blocks = append(blocks, markdownSection(strings.Join(header, "\n"), nil))
+	}
+
+	for index, item := range reply.Items {
+		text := item.Render(mrkdwnStyle)
+		if reply.Numbered {
+			text = fmt.Sprintf("%d. %s", index+1, text)
+		}
+
+		var accessory *slack.Accessory
+		if item.Action != nil {
+			accessory = slack.NewAccessory(actionButton(*item.Action))
+		}
+
+		blocks = append(blocks, markdownSection(text, accessory))
+	}
+
+	if reply.Footer != "" {
+		blocks = append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, mrkdwnStyle.Muted(reply.Footer), false, false)))
+	}
+
+	return append(blocks, actionBlocks(reply.Actions)...)
+}
+
+func actionBlocks(actions []bot.ReplyAction) []slack.Block {
+	if len(actions) == 0 {
+		return nil
+	}
+
+	elements := make([]slack.BlockElement, 0, len(actions))
+	for _, action := range actions {
+		elements = append(elements, actionButton(action))
+	}
+
+	return []slack.Block{slack.NewActionBlock("", elements...)}
+}
+
+func hasItemActions(items []bot.ReplyItem) bool {
+	for _, item := range items {
+		if item.Action != nil {
+			return true
+		}
+	}
+
+	return false
+}
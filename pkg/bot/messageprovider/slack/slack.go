@@ -4,24 +4,39 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/slack-go/slack"
 	"github.com/slack-go/slack/slackevents"
 	"github.com/slack-go/slack/socketmode"
 	"github.com/svenwiltink/go-musicbot/pkg/bot"
+	"github.com/svenwiltink/go-musicbot/pkg/bot/messageprovider/cache"
 )
 
+const userCacheTTL = time.Hour
+
 type MessageProvider struct {
 	Config         *bot.Config
 	MessageChannel chan bot.Message
 
 	rtm *socketmode.Client
 	api *slack.Client
+
+	botUserID string
+	userCache *cache.TTLCache[*slack.User]
 }
 
 func (provider *MessageProvider) Start() error {
 	provider.api = slack.New(provider.Config.Slack.Token, slack.OptionAppLevelToken(provider.Config.Slack.ApplicationToken), slack.OptionDebug(true), slack.OptionLog(log.New(os.Stderr, "slack-bot", log.Lshortfile|log.LstdFlags)))
 
+	auth, err := provider.api.AuthTest()
+	if err != nil {
+		return fmt.Errorf("unable to get the bot user: %v", err)
+	}
+
+	provider.botUserID = auth.UserID
+
 	provider.rtm = socketmode.New(provider.api)
 	go func() {
 		err := provider.rtm.Run()
@@ -35,17 +50,34 @@ func (provider *MessageProvider) Start() error {
 	return nil
 }
 
-func (provider *MessageProvider) SendReplyToMessage(message bot.Message, reply string) error {
-	parameters := slack.NewPostMessageParameters()
-	parameters.LinkNames = 1
-	_, _, _, err := provider.api.SendMessage(message.Target, slack.MsgOptionPostMessageParameters(parameters), slack.MsgOptionText(reply, false))
-	return err
+func (provider *MessageProvider) SendReplyToMessage(message bot.Message, reply bot.Reply) error {
+	return provider.sendReply(message.Target, reply)
 }
 
-func (provider *MessageProvider) BroadcastMessage(message string) error {
+func (provider *MessageProvider) BroadcastMessage(message bot.Reply) error {
+	return provider.sendReply(provider.Config.Slack.Channel, message)
+}
+
+// SendDirectMessage sends the reply in a direct conversation with the user with the id
+func (provider *MessageProvider) SendDirectMessage(identity string, reply bot.Reply) error {
+	channel, _, _, err := provider.api.OpenConversation(&slack.OpenConversationParameters{Users: []string{identity}})
+	if err != nil {
+		return fmt.Errorf("unable to open a conversation with %s: %v", identity, err)
+	}
+
+	return provider.sendReply(channel.ID, reply)
+}
+
+// sendReply sends the reply as Block Kit message. The plain text version is used in notifications
+func (provider *MessageProvider) sendReply(channel string, reply bot.Reply) error {
 	parameters := slack.NewPostMessageParameters()
 	parameters.LinkNames = 1
-	_, _, _, err := provider.api.SendMessage(provider.Config.Slack.Channel, slack.MsgOptionPostMessageParameters(parameters), slack.MsgOptionText(message, false))
+	_, _, _, err := provider.api.SendMessage(
+		channel,
+		slack.MsgOptionPostMessageParameters(parameters),
+		slack.MsgOptionText(reply.String(), false),
+		slack.MsgOptionBlocks(renderBlocks(reply)...),
+	)
 	return err
 }
 
@@ -65,28 +97,142 @@ func (provider *MessageProvider) handleMessages() {
 				innerEvent := event.InnerEvent
 				switch ev := innerEvent.Data.(type) {
 				case *slackevents.MessageEvent:
-					usermention := fmt.Sprintf("<@%s>", ev.User)
-
-					message := bot.Message{
-						Message: ev.Text,
-						Sender: bot.Sender{
-							Name:     usermention,
-							NickName: usermention,
-						},
-						Target:    ev.Channel,
-						IsPrivate: ev.Channel != provider.Config.Slack.Channel,
+					// ignore edits, deletes, bot messages and our own messages
+					if ev.SubType != "" || ev.BotID != "" || ev.User == provider.botUserID {
+						continue
+					}
+
+					provider.sendMessage(ev.Text, ev.User, ev.Channel)
+				case *slackevents.AppMentionEvent:
+					if ev.BotID != "" || ev.User == provider.botUserID {
+						continue
 					}
 
-					provider.MessageChannel <- message
+					provider.handleMention(ev)
 				}
 			}
+		case socketmode.EventTypeSlashCommand:
+			provider.rtm.Ack(*msg.Request)
+			command, ok := msg.Data.(slack.SlashCommand)
+			if !ok {
+				log.Printf("invalid slash command data %+v", msg.Data)
+				continue
+			}
+
+			provider.handleSlashCommand(command)
+		case socketmode.EventTypeInteractive:
+			provider.rtm.Ack(*msg.Request)
+			callback, ok := msg.Data.(slack.InteractionCallback)
+			if !ok {
+				log.Printf("invalid interaction data %+v", msg.Data)
+				continue
+			}
+
+			provider.handleInteraction(callback)
+		}
+	}
+}
+
+// handleSlashCommand turns `/music add <url>` into `<CommandPrefix> add <url>`
+func (provider *MessageProvider) handleSlashCommand(command slack.SlashCommand) {
+	if command.Command != provider.Config.Slack.SlashCommand {
+		log.Printf("ignoring unknown slash command %s", command.Command)
+		return
+	}
+
+	text := strings.TrimSpace(command.Text)
+	if text == "" {
+		text = "help"
+	}
+
+	provider.sendMessage(provider.Config.CommandPrefix+" "+text, command.UserID, command.ChannelID)
+}
+
+// handleMention handles `@musicbot add <url>` as if it was `<CommandPrefix> add <url>`.
+// Message events for mentions are never commands because they start with the mention.
+func (provider *MessageProvider) handleMention(event *slackevents.AppMentionEvent) {
+	text := strings.TrimSpace(strings.Replace(event.Text, fmt.Sprintf("<@%s>", provider.botUserID), "", 1))
+
+	if text == "" {
+		text = "help"
+	}
+
+	// mentions may contain a regular command as well
+	if !strings.HasPrefix(text, provider.Config.CommandPrefix) && !strings.HasPrefix(text, provider.Config.ShortCommandPrefix) {
+		text = provider.Config.CommandPrefix + " " + text
+	}
+
+	provider.sendMessage(text, event.User, event.Channel)
+}
+
+// handleInteraction maps the buttons rendered by this provider back onto bot commands
+func (provider *MessageProvider) handleInteraction(callback slack.InteractionCallback) {
+	if callback.Type != slack.InteractionTypeBlockActions {
+		return
+	}
+
+	for _, action := range callback.ActionCallback.BlockActions {
+		if !strings.HasPrefix(action.ActionID, actionPrefix) {
+			continue
+		}
+
+		text := provider.Config.CommandPrefix + " " + strings.TrimPrefix(action.ActionID, actionPrefix)
+		if action.Value != "" {
+			text += " " + action.Value
+		}
+
+		provider.sendMessage(text, callback.User.ID, callback.Channel.ID)
+	}
+}
+
+func (provider *MessageProvider) sendMessage(text string, user string, channel string) {
+	provider.MessageChannel <- bot.Message{
+		Message:   text,
+		Sender:    provider.getSender(user),
+		Target:    channel,
+		IsPrivate: channel != provider.Config.Slack.Channel,
+	}
+}
+
+// getSender resolves the user id to a sender. The id is kept for permission checks,
+// the user name is used in replies.
+func (provider *MessageProvider) getSender(userID string) bot.Sender {
+	sender := bot.Sender{
+		ID:       userID,
+		Name:     fmt.Sprintf("<@%s>", userID),
+		NickName: fmt.Sprintf("<@%s>", userID),
+	}
+
+	user, exists := provider.userCache.Get(userID)
+	if !exists {
+		var err error
+		user, err = provider.api.GetUserInfo(userID)
+		if err != nil {
+			log.Printf("unable to get user info for %s: %v", userID, err)
+			return sender
 		}
+
+		provider.userCache.Set(userID, user)
+	}
+
+	sender.Name = user.Name
+	sender.NickName = user.Profile.DisplayName
+	if sender.NickName == "" {
+		sender.NickName = user.RealName
 	}
+
+	return sender
+}
+
+// Mention mentions the user with the id
+func (provider *MessageProvider) Mention(identity string) string {
+	return fmt.Sprintf("<@%s>", identity)
 }
 
 func New(config *bot.Config) *MessageProvider {
 	return &MessageProvider{
 		MessageChannel: make(chan bot.Message),
 		Config:         config,
+		userCache:      cache.NewTTLCache[*slack.User](userCacheTTL),
 	}
 }
@@ -16,12 +16,12 @@ func (messageProvider *MessageProvider) GetMessageChannel() chan bot.Message {
 	return messageProvider.channel
 }
 
-func (messageProvider *MessageProvider) SendReplyToMessage(message bot.Message, reply string) error {
+func (messageProvider *MessageProvider) SendReplyToMessage(message bot.Message, reply bot.Reply) error {
 	log.Printf("%s", reply)
 	return nil
 }
 
-func (messageProvider *MessageProvider) BroadcastMessage(message string) error {
+func (messageProvider *MessageProvider) BroadcastMessage(message bot.Reply) error {
 	log.Printf("%s", message)
 	return nil
 }
@@ -0,0 +1,161 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Reply is a structured message that every MessageProvider renders in its native format
+type Reply struct {
+	Title string
+	Text  string
+	Items []ReplyItem
+	// Numbered renders the items as a numbered list
+	Numbered bool
+	Footer   string
+	Actions  []ReplyAction
+	// Reaction can be used instead of the text of the reply by providers that support reactions
+	Reaction Reaction
+}
+
+// Reaction is the name of an emoji used to react to a message
+type Reaction string
+
+const (
+	ReactionNone    Reaction = ""
+	ReactionSuccess Reaction = "white_check_mark"
+)
+
+// ReplyItem is a single entry in the list of a Reply
+type ReplyItem struct {
+	// Title is the emphasised part of the item, like the artist of a song
+	Title    string
+	Text     string
+	Link     string
+	Duration time.Duration
+	// Action is an optional action for this specific item
+	Action *ReplyAction
+}
+
+// ReplyAction is a command that can be executed by interacting with a reply, if the
+// MessageProvider supports it
+type ReplyAction struct {
+	Label     string
+	Command   string
+	Parameter string
+}
+
+// LineStyle decorates the parts of a Reply for line based renderers
+type LineStyle struct {
+	Text     func(text string) string
+	Emphasis func(text string) string
+	Link     func(text string, link string) string
+	Duration func(duration time.Duration) string
+	Muted    func(text string) string
+}
+
+// PlainStyle renders a Reply without any formatting
+var PlainStyle = LineStyle{
+	Text:     func(text string) string { return text },
+	Emphasis: func(text string) string { return text },
+	Link: func(text string, link string) string {
+		if text == "" {
+			return link
+		}
+		return fmt.Sprintf("%s <%s>", text, link)
+	},
+	Duration: func(duration time.Duration) string { return "(" + FormatDuration(duration) + ")" },
+	Muted:    func(text string) string { return text },
+}
+
+// TextReply creates a Reply that only contains text
+func TextReply(text string) Reply {
+	return Reply{Text: text}
+}
+
+// SuccessReply creates a text Reply that can be replaced by a success reaction
+func SuccessReply(text string) Reply {
+	return Reply{Text: text, Reaction: ReactionSuccess}
+}
+
+// Lines renders the reply as separate lines using the given style
+func (reply Reply) Lines(style LineStyle) []string {
+	lines := make([]string, 0, len(reply.Items)+3)
+
+	// a title with a single item is rendered as one line, like "Started playing: artist song"
+	if reply.Title != "" && reply.Text == "" && len(reply.Items) == 1 && !reply.Numbered {
+		lines = append(lines, style.Emphasis(reply.Title)+": "+reply.Items[0].Render(style))
+	} else {
+		if reply.Title != "" {
+			lines = append(lines, style.Emphasis(reply.Title))
+		}
+
+		if reply.Text != "" {
+			for _, line := range strings.Split(reply.Text, "\n") {
+				lines = append(lines, style.Text(line))
+			}
+		}
+
+		for index, item := range reply.Items {
+			line := item.Render(style)
+			if reply.Numbered {
+				line = fmt.Sprintf("%d. %s", index+1, line)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	if reply.Footer != "" {
+		lines = append(lines, style.Muted(reply.Footer))
+	}
+
+	return lines
+}
+
+// String renders the reply as plain text
+func (reply Reply) String() string {
+	return strings.Join(reply.Lines(PlainStyle), "\n")
+}
+
+// Render renders a single item on one line using the given style
+func (item ReplyItem) Render(style LineStyle) string {
+	parts := make([]string, 0, 3)
+
+	if item.Title != "" {
+		parts = append(parts, style.Emphasis(item.Title))
+	}
+
+	if item.Link != "" {
+		parts = append(parts, style.Link(item.Text, item.Link))
+	} else if item.Text != "" {
+		parts = append(parts, style.Text(item.Text))
+	}
+
+	if item.Duration > 0 {
+		parts = append(parts, style.Duration(item.Duration))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// FormatDuration formats a duration like a music player would: 3:07 or 1:02:03
+func FormatDuration(duration time.Duration) string {
+	duration = duration.Round(time.Second)
+
+	sign := ""
+	if duration < 0 {
+		sign = "-"
+		duration = -duration
+	}
+
+	hours := int(duration / time.Hour)
+	minutes := int(duration/time.Minute) % 60
+	seconds := int(duration/time.Second) % 60
+
+	if hours > 0 {
+		return fmt.Sprintf("%s%d:%02d:%02d", sign, hours, minutes, seconds)
+	}
+
+	return fmt.Sprintf("%s%d:%02d", sign, minutes, seconds)
+}
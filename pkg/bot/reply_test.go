@@ -0,0 +1,50 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatDuration(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "0:00", FormatDuration(0))
+	assert.Equal(t, "3:07", FormatDuration(3*time.Minute+7*time.Second))
+	assert.Equal(t, "1:02:03", FormatDuration(time.Hour+2*time.Minute+3*time.Second))
+	assert.Equal(t, "-0:10", FormatDuration(-10*time.Second))
+}
+
+func TestReply_String(t *testing.T) {
+	t.Parallel()
+
+	reply := Reply{
+		Title:    "Search results",
+		Numbered: true,
+		Items: []ReplyItem{
+			{Title: "artist1", Text: "song1", Duration: time.Minute},
+			{Title: "artist2", Text: "song2", Link: "https://example.com"},
+		},
+		Footer: "footer",
+	}
+
+	assert.Equal(t, "Search results\n1. artist1 song1 (1:00)\n2. artist2 song2 <https://example.com>\nfooter", reply.String())
+}
+
+func TestReply_String_SingleItem(t *testing.T) {
+	t.Parallel()
+
+	reply := Reply{
+		Title: "Started playing",
+		Items: []ReplyItem{{Title: "artist", Text: "song", Duration: time.Minute}},
+	}
+
+	assert.Equal(t, "Started playing: artist song (1:00)", reply.String())
+}
+
+func TestTextReply(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "line1\nline2", TextReply("line1\nline2").String())
+}
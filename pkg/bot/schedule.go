@@ -0,0 +1,232 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// scheduleInterval is how often the scheduler checks whether a window started or ended
+const scheduleInterval = 10 * time.Second
+
+type scheduledRule struct {
+	ScheduleRule
+	cron     cronExpression
+	duration time.Duration
+}
+
+// activeRule is a rule of which the window contains the current time
+type activeRule struct {
+	*scheduledRule
+	until time.Time
+}
+
+// Scheduler enforces the schedule rules. It is the music.Policy of the player, which
+// enforces the volume caps and blocked adds. Pausing is done by the scheduler itself.
+type Scheduler struct {
+	rules  []*scheduledRule
+	player music.Player
+	now    func() time.Time
+
+	// paused is set when the scheduler paused the player, so it can resume it afterwards
+	paused      bool
+	pauseWindow bool
+	// restoreVolume is the volume before it was capped, 0 when the volume is not capped
+	restoreVolume int
+}
+
+func NewScheduler(rules []ScheduleRule, player music.Player) (*Scheduler, error) {
+	scheduler := &Scheduler{
+		rules:  make([]*scheduledRule, 0, len(rules)),
+		player: player,
+		now:    time.Now,
+	}
+
+	for _, rule := range rules {
+		cron, err := parseCron(rule.Cron)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule rule %s: %v", rule.Name, err)
+		}
+
+		scheduler.rules = append(scheduler.rules, &scheduledRule{
+			ScheduleRule: rule,
+			cron:         cron,
+			duration:     rule.Duration * time.Minute,
+		})
+	}
+
+	return scheduler, nil
+}
+
+// Start checks the schedule periodically
+func (scheduler *Scheduler) Start() {
+	if len(scheduler.rules) == 0 {
+		return
+	}
+
+	go func() {
+		for {
+			scheduler.check()
+			time.Sleep(scheduleInterval)
+		}
+	}()
+}
+
+// activeAt returns whether the window of the rule contains the given time, and when it ends
+func (rule *scheduledRule) activeAt(t time.Time) (time.Time, bool) {
+	start := t.Truncate(time.Minute)
+
+	for offset := time.Duration(0); offset < rule.duration; offset += time.Minute {
+		if rule.cron.matches(start.Add(-offset)) {
+			return start.Add(-offset).Add(rule.duration), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func (scheduler *Scheduler) activeRules() []activeRule {
+	now := scheduler.now()
+	active := make([]activeRule, 0)
+
+	for _, rule := range scheduler.rules {
+		if until, isActive := rule.activeAt(now); isActive {
+			active = append(active, activeRule{scheduledRule: rule, until: until})
+		}
+	}
+
+	return active
+}
+
+// MaxVolume returns the lowest volume cap of the active rules
+func (scheduler *Scheduler) MaxVolume() int {
+	maxVolume := 100
+
+	for _, rule := range scheduler.activeRules() {
+		if rule.MaxVolume > 0 && rule.MaxVolume < maxVolume {
+			maxVolume = rule.MaxVolume
+		}
+	}
+
+	return maxVolume
+}
+
+// CanAdd returns an error when one of the active rules blocks adding songs
+func (scheduler *Scheduler) CanAdd() error {
+	for _, rule := range scheduler.activeRules() {
+		if rule.BlockAdds {
+			return fmt.Errorf("adding songs is not allowed during %s, until %s", rule.Name, rule.until.Format("15:04"))
+		}
+	}
+
+	return nil
+}
+
+// check pauses or resumes the player and lowers or restores the volume when a window starts or ends
+func (scheduler *Scheduler) check() {
+	pauseWindow := false
+	for _, rule := range scheduler.activeRules() {
+		if rule.Pause {
+			pauseWindow = true
+		}
+	}
+
+	if pauseWindow && !scheduler.pauseWindow {
+		if scheduler.player.GetStatus() == music.PlayerStatusPlaying {
+			log.Println("Schedule: pausing the player")
+			if err := scheduler.player.Pause(); err != nil {
+				log.Printf("Schedule: unable to pause: %v", err)
+			} else {
+				scheduler.paused = true
+			}
+		}
+	}
+
+	if !pauseWindow && scheduler.pauseWindow && scheduler.paused {
+		scheduler.paused = false
+		if scheduler.player.GetStatus() == music.PlayerStatusPaused {
+			log.Println("Schedule: resuming the player")
+			if err := scheduler.player.Play(); err != nil {
+				log.Printf("Schedule: unable to resume: %v", err)
+			}
+		}
+	}
+
+	scheduler.pauseWindow = pauseWindow
+
+	volume, err := scheduler.player.GetVolume()
+	if err != nil {
+		// nothing is playing, try again on the next check
+		return
+	}
+
+	maxVolume := scheduler.MaxVolume()
+
+	if volume > maxVolume {
+		log.Printf("Schedule: lowering the volume from %d to %d", volume, maxVolume)
+		if err := scheduler.player.SetVolume(maxVolume); err != nil {
+			log.Printf("Schedule: unable to lower the volume: %v", err)
+			return
+		}
+
+		if scheduler.restoreVolume == 0 {
+			scheduler.restoreVolume = volume
+		}
+	}
+
+	if maxVolume == 100 && scheduler.restoreVolume > 0 {
+		log.Printf("Schedule: restoring the volume to %d", scheduler.restoreVolume)
+		if err := scheduler.player.SetVolume(scheduler.restoreVolume); err != nil {
+			log.Printf("Schedule: unable to restore the volume: %v", err)
+			return
+		}
+
+		scheduler.restoreVolume = 0
+	}
+}
+
+// describe renders the restrictions of the rule, like "max volume 20, paused, no adds"
+func (rule *scheduledRule) describe() string {
+	restrictions := make([]string, 0, 3)
+
+	if rule.MaxVolume > 0 {
+		restrictions = append(restrictions, fmt.Sprintf("max volume %d", rule.MaxVolume))
+	}
+
+	if rule.Pause {
+		restrictions = append(restrictions, "paused")
+	}
+
+	if rule.BlockAdds {
+		restrictions = append(restrictions, "no adds")
+	}
+
+	if len(restrictions) == 0 {
+		restrictions = append(restrictions, "no restrictions")
+	}
+
+	return fmt.Sprintf("%s for %d minutes: %s", rule.Cron, rule.Duration, strings.Join(restrictions, ", "))
+}
+
+// Items renders the rules of the schedule, marking the active ones
+func (scheduler *Scheduler) Items() []ReplyItem {
+	active := make(map[*scheduledRule]time.Time)
+	for _, rule := range scheduler.activeRules() {
+		active[rule.scheduledRule] = rule.until
+	}
+
+	items := make([]ReplyItem, 0, len(scheduler.rules))
+	for _, rule := range scheduler.rules {
+		text := rule.describe()
+		if until, isActive := active[rule]; isActive {
+			text += fmt.Sprintf(" (active until %s)", until.Format("15:04"))
+		}
+
+		items = append(items, ReplyItem{Title: rule.Name, Text: text})
+	}
+
+	return items
+}
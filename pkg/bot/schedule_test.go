@@ -0,0 +1,101 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+type fakePlayer struct {
+	music.Player
+	status music.PlayerStatus
+	volume int
+}
+
+func (player *fakePlayer) GetStatus() music.PlayerStatus { return player.status }
+
+func (player *fakePlayer) Pause() error {
+	player.status = music.PlayerStatusPaused
+	return nil
+}
+
+func (player *fakePlayer) Play() error {
+	player.status = music.PlayerStatusPlaying
+	return nil
+}
+
+func (player *fakePlayer) GetVolume() (int, error) { return player.volume, nil }
+
+func (player *fakePlayer) SetVolume(percentage int) error {
+	player.volume = percentage
+	return nil
+}
+
+func newTestScheduler(t *testing.T, player music.Player, now *time.Time) *Scheduler {
+	scheduler, err := NewScheduler([]ScheduleRule{
+		{Name: "standup", Cron: "30 9 * * mon-fri", Duration: 15, MaxVolume: 20},
+		{Name: "after hours", Cron: "0 18 * * *", Duration: 900, Pause: true, BlockAdds: true},
+	}, player)
+
+	assert.NoError(t, err)
+	scheduler.now = func() time.Time { return *now }
+
+	return scheduler
+}
+
+func TestScheduler_Policy(t *testing.T) {
+	t.Parallel()
+
+	// 2021-06-07 is a monday
+	now := time.Date(2021, time.June, 7, 9, 29, 0, 0, time.Local)
+	scheduler := newTestScheduler(t, nil, &now)
+
+	assert.Equal(t, 100, scheduler.MaxVolume())
+	assert.NoError(t, scheduler.CanAdd())
+
+	now = time.Date(2021, time.June, 7, 9, 44, 59, 0, time.Local)
+	assert.Equal(t, 20, scheduler.MaxVolume())
+	assert.NoError(t, scheduler.CanAdd())
+
+	now = time.Date(2021, time.June, 7, 9, 45, 0, 0, time.Local)
+	assert.Equal(t, 100, scheduler.MaxVolume())
+
+	// the after hours window continues past midnight
+	now = time.Date(2021, time.June, 8, 8, 59, 0, 0, time.Local)
+	assert.EqualError(t, scheduler.CanAdd(), "adding songs is not allowed during after hours, until 09:00")
+
+	now = time.Date(2021, time.June, 8, 9, 0, 0, 0, time.Local)
+	assert.NoError(t, scheduler.CanAdd())
+}
+
+func TestScheduler_Check(t *testing.T) {
+	t.Parallel()
+
+	player := &fakePlayer{status: music.PlayerStatusPlaying, volume: 60}
+	now := time.Date(2021, time.June, 7, 9, 30, 0, 0, time.Local)
+	scheduler := newTestScheduler(t, player, &now)
+
+	scheduler.check()
+	assert.Equal(t, 20, player.volume)
+
+	now = time.Date(2021, time.June, 7, 9, 45, 0, 0, time.Local)
+	scheduler.check()
+	assert.Equal(t, 60, player.volume)
+
+	now = time.Date(2021, time.June, 7, 18, 0, 0, 0, time.Local)
+	scheduler.check()
+	assert.Equal(t, music.PlayerStatusPaused, player.status)
+
+	// the player is only paused when the window starts, so it can still be resumed manually
+	player.status = music.PlayerStatusPlaying
+	now = time.Date(2021, time.June, 7, 18, 1, 0, 0, time.Local)
+	scheduler.check()
+	assert.Equal(t, music.PlayerStatusPlaying, player.status)
+
+	player.status = music.PlayerStatusPaused
+	now = time.Date(2021, time.June, 8, 9, 0, 0, 0, time.Local)
+	scheduler.check()
+	assert.Equal(t, music.PlayerStatusPlaying, player.status)
+}
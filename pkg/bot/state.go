@@ -0,0 +1,73 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// ZoneState is the part of the state of a zone that is kept when the bot restarts
+type ZoneState struct {
+	RepeatMode music.RepeatMode `json:"repeatMode,omitempty"`
+}
+
+// State stores the state of the zones on disk so it survives a restart
+type State struct {
+	path  string
+	zones map[string]ZoneState
+	lock  sync.Mutex
+}
+
+func LoadState(path string) (*State, error) {
+	instance := &State{
+		path:  path,
+		zones: make(map[string]ZoneState),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return instance, nil
+	}
+
+	if err != nil {
+		return instance, fmt.Errorf("unable to open file %s: %v", path, err)
+	}
+
+	if err := json.Unmarshal(data, &instance.zones); err != nil {
+		return instance, fmt.Errorf("unable to decode state in %s: %v", path, err)
+	}
+
+	return instance, nil
+}
+
+// Zone returns the stored state of the zone
+func (state *State) Zone(name string) ZoneState {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	return state.zones[name]
+}
+
+// SetRepeatMode stores the repeat mode of the zone
+func (state *State) SetRepeatMode(zone string, mode music.RepeatMode) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+
+	zoneState := state.zones[zone]
+	zoneState.RepeatMode = mode
+	state.zones[zone] = zoneState
+
+	return state.write()
+}
+
+func (state *State) write() error {
+	data, err := json.MarshalIndent(state.zones, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(state.path, data, 0666)
+}
@@ -0,0 +1,57 @@
+package bot
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+type repeatPlayer struct {
+	music.Player
+	mode music.RepeatMode
+}
+
+func (player *repeatPlayer) SetRepeatMode(mode music.RepeatMode) error {
+	player.mode = mode
+	return nil
+}
+
+func (player *repeatPlayer) GetRepeatMode() music.RepeatMode { return player.mode }
+
+func TestState_Persist(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := LoadState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, ZoneState{}, state.Zone("kitchen"))
+
+	assert.NoError(t, state.SetRepeatMode("kitchen", music.RepeatModeAll))
+
+	state, err = LoadState(path)
+	assert.NoError(t, err)
+	assert.Equal(t, music.RepeatModeAll, state.Zone("kitchen").RepeatMode)
+	assert.Equal(t, ZoneState{}, state.Zone("floor2"))
+}
+
+func TestMusicBot_LoadState(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := LoadState(path)
+	assert.NoError(t, err)
+	assert.NoError(t, state.SetRepeatMode("floor2", music.RepeatModeOne))
+
+	kitchen := &Zone{Name: "kitchen", Player: &repeatPlayer{mode: music.RepeatModeOff}}
+	floor2 := &Zone{Name: "floor2", Player: &repeatPlayer{mode: music.RepeatModeOff}}
+	bot := &MusicBot{config: &Config{StateFile: path}, zones: []*Zone{kitchen, floor2}}
+
+	// the repeat mode is restored when the bot starts
+	bot.loadState()
+	assert.Equal(t, music.RepeatModeOff, kitchen.Player.GetRepeatMode())
+	assert.Equal(t, music.RepeatModeOne, floor2.Player.GetRepeatMode())
+}
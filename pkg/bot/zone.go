@@ -0,0 +1,271 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+	"github.com/svenwiltink/go-musicbot/pkg/music/player"
+	"github.com/svenwiltink/go-musicbot/pkg/music/provider/mpd"
+	"github.com/svenwiltink/go-musicbot/pkg/music/provider/mpv"
+	"github.com/svenwiltink/go-musicbot/pkg/music/provider/remote"
+)
+
+// Zone is a room with its own player, queue and volume
+type Zone struct {
+	Name string
+	// Channel is the chat channel of the zone, announcements of the zone are sent there
+	Channel   string
+	Player    music.Player
+	scheduler *Scheduler
+	// provider plays the music of the zone, it plays along with the leader when grouped
+	provider music.Provider
+
+	// group keeps the zones that follow this zone in sync
+	group *player.Group
+	// leader is the zone this zone plays along with
+	leader *Zone
+}
+
+// newZone starts the mpv instance or connects to the agent or MPD of the zone and creates its
+// player. The mirrors play along with the zone, the preparer prepares its songs when set.
+func newZone(config *Config, zoneConfig ZoneConfig, dataProviders []music.DataProvider, mirrors []music.Provider, preparer music.Preparer) (*Zone, error) {
+	provider, err := newZoneProvider(config, zoneConfig)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start music player: %v", err)
+	}
+
+	musicPlayer := player.NewMusicPlayer([]music.Provider{provider}, dataProviders)
+	musicPlayer.SetFadeOut(config.FadeOut * time.Millisecond)
+
+	if preparer != nil {
+		musicPlayer.SetPreparer(preparer, config.Prefetch.Ahead)
+	}
+
+	for _, mirror := range mirrors {
+		musicPlayer.AddMirror(mirror)
+	}
+
+	scheduler, err := NewScheduler(config.Schedule, musicPlayer)
+	if err != nil {
+		return nil, fmt.Errorf("unable to start the scheduler: %v", err)
+	}
+
+	musicPlayer.SetPolicy(scheduler)
+
+	return &Zone{
+		Name:      zoneConfig.Name,
+		Channel:   zoneConfig.Channel,
+		Player:    musicPlayer,
+		scheduler: scheduler,
+		provider:  provider,
+	}, nil
+}
+
+// newZoneProvider starts the provider that plays the music of the zone
+func newZoneProvider(config *Config, zoneConfig ZoneConfig) (music.Provider, error) {
+	if zoneConfig.Agent != "" {
+		agent := remote.New(zoneConfig.Agent, zoneConfig.AgentToken)
+		return agent, agent.Start()
+	}
+
+	if zoneConfig.Mpd != "" {
+		mpdPlayer := mpd.NewPlayer(zoneConfig.Mpd, zoneConfig.MpdPassword)
+		return mpdPlayer, mpdPlayer.Start()
+	}
+
+	mpvPlayer := mpv.NewPlayer(config.MpvPath, zoneConfig.MpvSocket)
+	mpvPlayer.Configure(mpv.Options{
+		Args:        config.MpvArgs,
+		AudioDevice: zoneConfig.MpvAudioDevice,
+		Profile:     config.MpvProfile,
+		Volume:      zoneConfig.MpvVolume,
+		YtdlFormat:  config.MpvYtdlFormat,
+	})
+	mpvPlayer.ConfigureNormalization(config.Normalization.Filter, config.Normalization.ReplayGain, config.Normalization.Enabled)
+
+	return mpvPlayer, mpvPlayer.Start()
+}
+
+// findZone returns the zone with the given name
+func (bot *MusicBot) findZone(name string) (*Zone, bool) {
+	for _, zone := range bot.zones {
+		if zone.Name == name {
+			return zone, true
+		}
+	}
+
+	return nil, false
+}
+
+// zoneForChannel returns the zone of the chat channel. The first zone is the default.
+func (bot *MusicBot) zoneForChannel(channel string) *Zone {
+	for _, zone := range bot.zones {
+		if zone.Channel != "" && zone.Channel == channel {
+			return zone
+		}
+	}
+
+	return bot.zones[0]
+}
+
+// zone returns the zone the message is for. A zone that is grouped is controlled by the leader
+// of the group.
+func (bot *MusicBot) zone(message Message) *Zone {
+	zone, exists := bot.findZone(message.Zone)
+	if !exists {
+		zone = bot.zoneForChannel(message.Target)
+	}
+
+	bot.groupLock.Lock()
+	defer bot.groupLock.Unlock()
+
+	if zone.leader != nil {
+		return zone.leader
+	}
+
+	return zone
+}
+
+// player returns the player of the zone the message is for
+func (bot *MusicBot) player(message Message) music.Player {
+	return bot.zone(message).Player
+}
+
+// broadcastZone announces the reply in the channel of the zone, or in the main channel when the
+// zone has no channel of its own
+func (bot *MusicBot) broadcastZone(zone *Zone, reply Reply) {
+	if len(bot.zones) > 1 {
+		if reply.Title != "" {
+			reply.Title = fmt.Sprintf("%s in %s", reply.Title, zone.Name)
+		} else {
+			reply.Text = fmt.Sprintf("[%s] %s", zone.Name, reply.Text)
+		}
+
+		// the actions should control this zone, wherever they are used
+		actions := make([]ReplyAction, 0, len(reply.Actions))
+		for _, action := range reply.Actions {
+			action.Command = "@" + zone.Name + " " + action.Command
+			actions = append(actions, action)
+		}
+		reply.Actions = actions
+	}
+
+	if zone.Channel != "" {
+		bot.SendReply(Message{Target: zone.Channel}, reply)
+		return
+	}
+
+	bot.BroadcastReply(reply)
+}
+
+// splitZone splits a command like @kitchen next into the name of the zone and the command
+func splitZone(text string) (zone string, command string, selected bool) {
+	if !strings.HasPrefix(text, "@") {
+		return "", text, false
+	}
+
+	words := strings.SplitN(text, " ", 2)
+	if len(words) == 2 {
+		command = strings.TrimSpace(words[1])
+	}
+
+	return strings.TrimPrefix(words[0], "@"), command, true
+}
+
+// groupZones lets the followers play the music of the leader in sync
+func (bot *MusicBot) groupZones(leader *Zone, followers []*Zone) error {
+	bot.groupLock.Lock()
+	defer bot.groupLock.Unlock()
+
+	if leader.leader != nil {
+		return fmt.Errorf("%s follows %s, it can not lead a group", leader.Name, leader.leader.Name)
+	}
+
+	for _, follower := range followers {
+		if follower == leader {
+			return errors.New("a zone can not follow itself")
+		}
+
+		if follower.group != nil {
+			return fmt.Errorf("%s leads a group, ungroup it first", follower.Name)
+		}
+	}
+
+	if leader.group == nil {
+		leader.group = player.NewGroup(leader.Player)
+		leader.group.Start()
+	}
+
+	for _, follower := range followers {
+		if follower.leader == leader {
+			continue
+		}
+
+		if follower.leader != nil {
+			bot.leaveGroup(follower)
+		}
+
+		// the zone stops playing its own queue, the queue continues when it leaves the group
+		if follower.Player.GetStatus().CanBeSkipped() {
+			if err := follower.Player.SetStopAfter(true); err != nil {
+				log.Printf("Zones: unable to stop %s: %v", follower.Name, err)
+			}
+
+			if err := follower.Player.Next(); err != nil {
+				log.Printf("Zones: unable to stop %s: %v", follower.Name, err)
+			}
+		}
+
+		follower.leader = leader
+		leader.group.Add(follower.provider)
+	}
+
+	return nil
+}
+
+// ungroupZone makes the zone play its own queue again. When the zone leads a group the group
+// is dissolved.
+func (bot *MusicBot) ungroupZone(zone *Zone) error {
+	bot.groupLock.Lock()
+	defer bot.groupLock.Unlock()
+
+	if zone.leader != nil {
+		bot.leaveGroup(zone)
+		return nil
+	}
+
+	if zone.group == nil {
+		return fmt.Errorf("%s is not grouped", zone.Name)
+	}
+
+	for _, follower := range bot.zones {
+		if follower.leader == zone {
+			bot.leaveGroup(follower)
+		}
+	}
+
+	return nil
+}
+
+// leaveGroup removes the follower from the group of its leader. The group is stopped when it
+// has no followers left. The groupLock must be held.
+func (bot *MusicBot) leaveGroup(follower *Zone) {
+	leader := follower.leader
+	leader.group.Remove(follower.provider)
+	follower.leader = nil
+
+	if len(leader.group.Followers()) == 0 {
+		leader.group.Stop()
+		leader.group = nil
+	}
+
+	if follower.Player.GetStatus() == music.PlayerStatusStopped {
+		if err := follower.Player.Play(); err != nil {
+			log.Printf("Zones: unable to resume %s: %v", follower.Name, err)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+func TestMusicBot_Zone(t *testing.T) {
+	t.Parallel()
+
+	kitchen := &Zone{Name: "kitchen"}
+	floor2 := &Zone{Name: "floor2", Channel: "#floor2"}
+	bot := &MusicBot{zones: []*Zone{kitchen, floor2}}
+
+	// the first zone is the default
+	assert.Equal(t, kitchen, bot.zone(Message{Target: "#music"}))
+	assert.Equal(t, floor2, bot.zone(Message{Target: "#floor2"}))
+
+	// a selected zone wins over the zone of the channel
+	assert.Equal(t, kitchen, bot.zone(Message{Target: "#floor2", Zone: "kitchen"}))
+
+	_, exists := bot.findZone("attic")
+	assert.False(t, exists)
+}
+
+func TestMusicBot_ZoneGrouped(t *testing.T) {
+	t.Parallel()
+
+	kitchen := &Zone{Name: "kitchen"}
+	floor2 := &Zone{Name: "floor2", Channel: "#floor2", leader: kitchen}
+	bot := &MusicBot{zones: []*Zone{kitchen, floor2}}
+
+	// a grouped zone is controlled by its leader
+	assert.Equal(t, kitchen, bot.zone(Message{Target: "#floor2"}))
+	assert.Equal(t, kitchen, bot.zone(Message{Target: "#music", Zone: "floor2"}))
+
+	assert.Error(t, bot.groupZones(floor2, []*Zone{kitchen}))
+	assert.Error(t, bot.groupZones(kitchen, []*Zone{kitchen}))
+}
+
+// zonePlayer is a stopped player that counts how often it was resumed
+type zonePlayer struct {
+	music.Player
+	mirrors []music.Provider
+	resumed int
+}
+
+func (player *zonePlayer) GetStatus() music.PlayerStatus { return music.PlayerStatusStopped }
+
+func (player *zonePlayer) GetCurrentSong() (*music.Song, time.Duration) { return nil, 0 }
+
+func (player *zonePlayer) Play() error {
+	player.resumed++
+	return nil
+}
+
+func (player *zonePlayer) AddMirror(provider music.Provider) {
+	player.mirrors = append(player.mirrors, provider)
+}
+
+func (player *zonePlayer) RemoveMirror(provider music.Provider) {
+	for index, mirror := range player.mirrors {
+		if mirror == provider {
+			player.mirrors = append(player.mirrors[:index], player.mirrors[index+1:]...)
+			return
+		}
+	}
+}
+
+// zoneProvider counts how often it was skipped
+type zoneProvider struct {
+	music.Provider
+	skipped int
+}
+
+func (provider *zoneProvider) Skip() error {
+	provider.skipped++
+	return nil
+}
+
+func TestMusicBot_LeaveGroup(t *testing.T) {
+	t.Parallel()
+
+	kitchenPlayer := &zonePlayer{}
+	kitchen := &Zone{Name: "kitchen", Player: kitchenPlayer}
+
+	floor2Player, floor2Provider := &zonePlayer{}, &zoneProvider{}
+	floor2 := &Zone{Name: "floor2", Player: floor2Player, provider: floor2Provider}
+
+	atticPlayer, atticProvider := &zonePlayer{}, &zoneProvider{}
+	attic := &Zone{Name: "attic", Player: atticPlayer, provider: atticProvider}
+
+	bot := &MusicBot{zones: []*Zone{kitchen, floor2, attic}}
+
+	assert.NoError(t, bot.groupZones(kitchen, []*Zone{floor2, attic}))
+	assert.Len(t, kitchenPlayer.mirrors, 2)
+	assert.Equal(t, kitchen, floor2.leader)
+
+	// a follower leaving plays its own queue again, the group stays for the other follower
+	assert.NoError(t, bot.ungroupZone(floor2))
+	assert.Nil(t, floor2.leader)
+	assert.Equal(t, 1, floor2Provider.skipped)
+	assert.Equal(t, 1, floor2Player.resumed)
+	assert.NotNil(t, kitchen.group)
+	assert.Equal(t, []music.Provider{atticProvider}, kitchenPlayer.mirrors)
+
+	// the group is dissolved with its last follower
+	assert.NoError(t, bot.ungroupZone(attic))
+	assert.Nil(t, kitchen.group)
+	assert.Equal(t, 1, atticPlayer.resumed)
+
+	assert.Error(t, bot.ungroupZone(kitchen))
+}
+
+func TestConfig_GetZones(t *testing.T) {
+	t.Parallel()
+
+	volume := func(percentage int) *int {
+		return &percentage
+	}
+
+	config := &Config{MpvSocket: "/tmp/mpv", MpvVolume: 40, MpvAudioDevice: "auto"}
+	assert.Equal(t, []ZoneConfig{{Name: DefaultZoneName, MpvSocket: "/tmp/mpv", MpvAudioDevice: "auto", MpvVolume: volume(40)}}, config.GetZones())
+
+	// a zone can start muted
+	config.Zones = []ZoneConfig{
+		{Name: "kitchen", MpvSocket: "/tmp/kitchen"},
+		{Name: "floor2", MpvSocket: "/tmp/floor2", MpvVolume: volume(70), MpvAudioDevice: "pulse/floor2"},
+		{Name: "attic", MpvSocket: "/tmp/attic", MpvVolume: volume(0)},
+	}
+
+	assert.Equal(t, []ZoneConfig{
+		{Name: "kitchen", MpvSocket: "/tmp/kitchen", MpvAudioDevice: "auto", MpvVolume: volume(40)},
+		{Name: "floor2", MpvSocket: "/tmp/floor2", MpvAudioDevice: "pulse/floor2", MpvVolume: volume(70)},
+		{Name: "attic", MpvSocket: "/tmp/attic", MpvAudioDevice: "auto", MpvVolume: volume(0)},
+	}, config.GetZones())
+
+	config.Mattermost.ConnectionTimeout = 30
+	config.Irc.FloodBurst = 1
+	config.Normalization.ReplayGain = "track"
+	assert.NoError(t, config.CheckForErrors())
+
+	config.Zones[2].MpvVolume = volume(101)
+	assert.Error(t, config.CheckForErrors())
+	config.Zones[2].MpvVolume = volume(0)
+
+	config.Zones = append(config.Zones, ZoneConfig{Name: "kitchen", MpvSocket: "/tmp/other"})
+	assert.Error(t, config.CheckForErrors())
+
+	// zones played by an agent don't need a socket and share the token
+	config.AgentToken = "secret"
+	config.Zones = []ZoneConfig{{Name: "attic", Agent: "ws://attic:8100/agent"}}
+	assert.NoError(t, config.CheckForErrors())
+	assert.Equal(t, "secret", config.GetZones()[0].AgentToken)
+
+	config.Zones = []ZoneConfig{{Name: "office", Mpd: "localhost:6600"}}
+	assert.NoError(t, config.CheckForErrors())
+}
+
+func TestSplitZone(t *testing.T) {
+	t.Parallel()
+
+	zone, command, selected := splitZone("@kitchen vol 40")
+	assert.True(t, selected)
+	assert.Equal(t, "kitchen", zone)
+	assert.Equal(t, "vol 40", command)
+
+	zone, command, selected = splitZone("@kitchen")
+	assert.True(t, selected)
+	assert.Equal(t, "kitchen", zone)
+	assert.Equal(t, "", command)
+
+	_, command, selected = splitZone("next")
+	assert.False(t, selected)
+	assert.Equal(t, "next", command)
+}
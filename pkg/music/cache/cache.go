@@ -0,0 +1,374 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	indexFile = "index.json"
+	// saveInterval is how often changes to the index are written
+	saveInterval = time.Minute
+)
+
+// Config configures the cache
+type Config struct {
+	Directory string
+	// MaxSize is the size in bytes the audio may take up, 0 is unlimited
+	MaxSize int64
+	// MaxAge is how long audio that is not played is kept, 0 is forever
+	MaxAge time.Duration
+}
+
+// Entry is the audio and metadata of a song
+type Entry struct {
+	Key  music.SongKey `json:"key"`
+	Song music.Song    `json:"song"`
+	// File is the name of the audio in the directory of the cache
+	File     string    `json:"file"`
+	Size     int64     `json:"size"`
+	Added    time.Time `json:"added"`
+	LastUsed time.Time `json:"lastUsed"`
+	Plays    int       `json:"plays"`
+}
+
+// Stats describes the contents and use of the cache
+type Stats struct {
+	Songs   int
+	Size    int64
+	MaxSize int64
+	// Hits and Misses count the started songs that were and were not cached since the bot started
+	Hits   int
+	Misses int
+}
+
+// Cache stores the audio of songs on disk, so songs that are played often don't have to be
+// downloaded every time. Songs are stored by their key, so the different urls of a song share
+// the audio. The least recently used songs are removed when the cache gets too big.
+type Cache struct {
+	config      Config
+	identifiers []music.Identifier
+
+	lock    sync.Mutex
+	entries map[music.SongKey]*Entry
+	dirty   bool
+	hits    int
+	misses  int
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// Open opens the cache in the directory. The identifiers tell which song a url refers to.
+func Open(config Config, identifiers []music.Identifier) (*Cache, error) {
+	if err := os.MkdirAll(config.Directory, 0755); err != nil {
+		return nil, fmt.Errorf("unable to create %s: %v", config.Directory, err)
+	}
+
+	cache := &Cache{
+		config:      config,
+		identifiers: identifiers,
+		entries:     make(map[music.SongKey]*Entry),
+		stop:        make(chan struct{}),
+	}
+
+	data, err := os.ReadFile(cache.path(indexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read the cache index: %v", err)
+	}
+
+	if err == nil {
+		var entries []*Entry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, fmt.Errorf("unable to decode the cache index: %v", err)
+		}
+
+		for _, entry := range entries {
+			if _, err := os.Stat(cache.path(entry.File)); err == nil {
+				cache.entries[entry.Key] = entry
+			}
+		}
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.evict()
+
+	return cache, nil
+}
+
+func (cache *Cache) path(file string) string {
+	return filepath.Join(cache.config.Directory, file)
+}
+
+// Key returns the key of the song, songs without a key can not be cached
+func (cache *Cache) Key(song music.Song) (music.SongKey, bool) {
+	for _, identifier := range cache.identifiers {
+		if key, ok := identifier.Identify(song); ok {
+			return key, true
+		}
+	}
+
+	return music.SongKey{}, false
+}
+
+// Start periodically writes the changes to the index
+func (cache *Cache) Start() {
+	go func() {
+		ticker := time.NewTicker(saveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cache.stop:
+				return
+			case <-ticker.C:
+				cache.Save()
+			}
+		}
+	}()
+}
+
+// Stop stops writing the changes and writes the remaining ones
+func (cache *Cache) Stop() {
+	cache.once.Do(func() {
+		close(cache.stop)
+	})
+
+	cache.Save()
+}
+
+// Audio returns the location of the audio of the song when it is cached
+func (cache *Cache) Audio(song music.Song) (string, bool) {
+	key, ok := cache.Key(song)
+	if !ok {
+		return "", false
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, exists := cache.entries[key]
+	if !exists {
+		return "", false
+	}
+
+	if _, err := os.Stat(cache.path(entry.File)); err != nil {
+		delete(cache.entries, key)
+		cache.dirty = true
+		return "", false
+	}
+
+	return cache.path(entry.File), true
+}
+
+// Played marks the song as used when it started playing, so songs that are played often are
+// kept the longest
+func (cache *Cache) Played(song music.Song) {
+	key, ok := cache.Key(song)
+	if !ok {
+		return
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, exists := cache.entries[key]
+	if !exists {
+		cache.misses++
+		return
+	}
+
+	cache.hits++
+	entry.LastUsed = time.Now()
+	entry.Plays++
+	cache.dirty = true
+}
+
+// Metadata returns the metadata of the song when it is cached
+func (cache *Cache) Metadata(song music.Song) (music.Song, bool) {
+	key, ok := cache.Key(song)
+	if !ok {
+		return music.Song{}, false
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, exists := cache.entries[key]
+	if !exists {
+		return music.Song{}, false
+	}
+
+	return entry.Song, true
+}
+
+// Store adds the audio of the song to the cache. download writes the audio to the given file.
+func (cache *Cache) Store(song music.Song, download func(file string) error) (string, error) {
+	key, ok := cache.Key(song)
+	if !ok {
+		return "", fmt.Errorf("%s can not be cached", song.Path)
+	}
+
+	name := fileName(key)
+	file := cache.path(name)
+
+	if err := download(file); err != nil {
+		return "", err
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", fmt.Errorf("the audio was not downloaded: %v", err)
+	}
+
+	now := time.Now()
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries[key] = &Entry{
+		Key:      key,
+		Song:     song,
+		File:     name,
+		Size:     info.Size(),
+		Added:    now,
+		LastUsed: now,
+	}
+
+	cache.evict()
+	cache.save()
+
+	if _, exists := cache.entries[key]; !exists {
+		return "", fmt.Errorf("%s does not fit in the cache", song.Path)
+	}
+
+	return file, nil
+}
+
+// Stats returns the size of the cache and how often it was used
+func (cache *Cache) Stats() Stats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	stats := Stats{
+		Songs:   len(cache.entries),
+		MaxSize: cache.config.MaxSize,
+		Hits:    cache.hits,
+		Misses:  cache.misses,
+	}
+
+	for _, entry := range cache.entries {
+		stats.Size += entry.Size
+	}
+
+	return stats
+}
+
+// Clear removes all songs from the cache
+func (cache *Cache) Clear() error {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for key, entry := range cache.entries {
+		if err := os.Remove(cache.path(entry.File)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		delete(cache.entries, key)
+	}
+
+	cache.save()
+
+	return nil
+}
+
+// evict removes the songs that have not been played for too long, and the least recently used
+// songs until the cache is small enough. The lock must be held.
+func (cache *Cache) evict() {
+	entries := make([]*Entry, 0, len(cache.entries))
+	for _, entry := range cache.entries {
+		entries = append(entries, entry)
+	}
+
+	for _, entry := range evictable(entries, cache.config.MaxSize, cache.config.MaxAge, time.Now()) {
+		log.Printf("Cache: removing %s - %s", entry.Song.Artist, entry.Song.Name)
+
+		if err := os.Remove(cache.path(entry.File)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Cache: unable to remove %s: %v", entry.File, err)
+			continue
+		}
+
+		delete(cache.entries, entry.Key)
+		cache.dirty = true
+	}
+}
+
+// evictable returns the entries that should be removed: those not used for longer than maxAge,
+// and the least recently used ones until the rest fits in maxSize
+func evictable(entries []*Entry, maxSize int64, maxAge time.Duration, now time.Time) []*Entry {
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].LastUsed.After(entries[j].LastUsed)
+	})
+
+	remove := make([]*Entry, 0)
+	var size int64
+
+	for _, entry := range entries {
+		size += entry.Size
+
+		if (maxAge > 0 && now.Sub(entry.LastUsed) > maxAge) || (maxSize > 0 && size > maxSize) {
+			remove = append(remove, entry)
+			size -= entry.Size
+		}
+	}
+
+	return remove
+}
+
+// Save writes the index of the cache when it changed
+func (cache *Cache) Save() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if cache.dirty {
+		cache.save()
+	}
+}
+
+// save writes the index of the cache. The lock must be held.
+func (cache *Cache) save() {
+	entries := make([]*Entry, 0, len(cache.entries))
+	for _, entry := range cache.entries {
+		entries = append(entries, entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err == nil {
+		err = os.WriteFile(cache.path(indexFile), data, 0644)
+	}
+
+	if err != nil {
+		log.Printf("Cache: unable to save the index: %v", err)
+		return
+	}
+
+	cache.dirty = false
+}
+
+// fileName returns the name of the audio of the song with the key
+func fileName(key music.SongKey) string {
+	hash := sha256.Sum256([]byte(key.Provider + "\x00" + key.Identifier))
+	return hex.EncodeToString(hash[:])
+}
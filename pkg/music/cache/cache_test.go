@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// fakeIdentifier uses the part of the path after the last = as the identifier
+type fakeIdentifier struct{}
+
+func (fakeIdentifier) Identify(song music.Song) (music.SongKey, bool) {
+	index := strings.LastIndex(song.Path, "=")
+	if index == -1 {
+		return music.SongKey{}, false
+	}
+
+	return music.SongKey{Provider: "fake", Identifier: song.Path[index+1:]}, true
+}
+
+func writeAudio(size int) func(file string) error {
+	return func(file string) error {
+		return os.WriteFile(file, make([]byte, size), 0644)
+	}
+}
+
+func TestCache(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+	cache, err := Open(Config{Directory: directory, MaxSize: 100}, []music.Identifier{fakeIdentifier{}})
+	assert.NoError(t, err)
+
+	song := music.Song{Name: "song", Artist: "artist", Path: "https://example.com/watch?v=abc"}
+
+	_, cached := cache.Audio(song)
+	assert.False(t, cached)
+
+	file, err := cache.Store(song, writeAudio(60))
+	assert.NoError(t, err)
+
+	// another url of the same song uses the same audio
+	other, cached := cache.Audio(music.Song{Path: "https://short.example.com/?v=abc"})
+	assert.True(t, cached)
+	assert.Equal(t, file, other)
+
+	metadata, cached := cache.Metadata(music.Song{Path: "?v=abc"})
+	assert.True(t, cached)
+	assert.Equal(t, "song", metadata.Name)
+
+	_, err = cache.Store(music.Song{Path: "https://example.com/no-identifier"}, writeAudio(1))
+	assert.Error(t, err)
+
+	// the index survives a restart
+	cache, err = Open(Config{Directory: directory, MaxSize: 100}, []music.Identifier{fakeIdentifier{}})
+	assert.NoError(t, err)
+	assert.Equal(t, Stats{Songs: 1, Size: 60, MaxSize: 100}, cache.Stats())
+
+	// the least recently used song makes room
+	_, err = cache.Store(music.Song{Path: "?v=def"}, writeAudio(50))
+	assert.NoError(t, err)
+	_, cached = cache.Audio(song)
+	assert.False(t, cached)
+	_, err = os.Stat(file)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NoError(t, cache.Clear())
+	assert.Equal(t, 0, cache.Stats().Songs)
+}
+
+func TestEvictable(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	old := &Entry{Size: 10, LastUsed: now.Add(-48 * time.Hour)}
+	recent := &Entry{Size: 60, LastUsed: now.Add(-time.Minute)}
+	earlier := &Entry{Size: 50, LastUsed: now.Add(-time.Hour)}
+	small := &Entry{Size: 30, LastUsed: now.Add(-2 * time.Hour)}
+
+	// the least recently used entries go first, smaller ones that still fit are kept
+	assert.Equal(t, []*Entry{earlier, old}, evictable([]*Entry{old, recent, earlier, small}, 100, 24*time.Hour, now))
+	assert.Empty(t, evictable([]*Entry{old, recent, earlier, small}, 0, 0, now))
+}
+
+func TestCache_Played(t *testing.T) {
+	t.Parallel()
+
+	directory := t.TempDir()
+	cache, err := Open(Config{Directory: directory, MaxSize: 100}, []music.Identifier{fakeIdentifier{}})
+	assert.NoError(t, err)
+
+	first := music.Song{Path: "?v=first"}
+	second := music.Song{Path: "?v=second"}
+
+	_, err = cache.Store(first, writeAudio(40))
+	assert.NoError(t, err)
+	_, err = cache.Store(second, writeAudio(40))
+	assert.NoError(t, err)
+
+	// looking up the audio is not a play
+	_, cached := cache.Audio(first)
+	assert.True(t, cached)
+	assert.Equal(t, 0, cache.Stats().Hits)
+
+	cache.Played(first)
+	cache.Played(music.Song{Path: "?v=other"})
+	assert.Equal(t, 1, cache.Stats().Hits)
+	assert.Equal(t, 1, cache.Stats().Misses)
+
+	// the plays are written with the next save
+	reopened, err := Open(Config{Directory: directory, MaxSize: 100}, []music.Identifier{fakeIdentifier{}})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, reopened.entries[music.SongKey{Provider: "fake", Identifier: "first"}].Plays)
+
+	cache.Save()
+	reopened, err = Open(Config{Directory: directory, MaxSize: 100}, []music.Identifier{fakeIdentifier{}})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, reopened.entries[music.SongKey{Provider: "fake", Identifier: "first"}].Plays)
+
+	// the song that was played last is kept
+	_, err = reopened.Store(music.Song{Path: "?v=third"}, writeAudio(40))
+	assert.NoError(t, err)
+	_, cached = reopened.Audio(first)
+	assert.True(t, cached)
+	_, cached = reopened.Audio(second)
+	assert.False(t, cached)
+}
@@ -0,0 +1,63 @@
+package cache
+
+import "github.com/svenwiltink/go-musicbot/pkg/music"
+
+// DataProvider provides the data of cached songs from the cache, and asks the data provider it
+// wraps for the other songs
+type DataProvider struct {
+	music.DataProvider
+	cache *Cache
+}
+
+// Wrap lets the data provider use the metadata of the cached songs
+func (cache *Cache) Wrap(provider music.DataProvider) *DataProvider {
+	return &DataProvider{
+		DataProvider: provider,
+		cache:        cache,
+	}
+}
+
+func (provider *DataProvider) ProvideData(song *music.Song) error {
+	if cached, ok := provider.cache.Metadata(*song); ok {
+		song.Name = cached.Name
+		song.Artist = cached.Artist
+		song.Duration = cached.Duration
+		song.SongType = cached.SongType
+
+		// the cached song might have been added with another url or start time
+		if path, ok := provider.CanonicalPath(*song); ok {
+			song.Path = path
+		}
+
+		return nil
+	}
+
+	return provider.DataProvider.ProvideData(song)
+}
+
+func (provider *DataProvider) Identify(song music.Song) (music.SongKey, bool) {
+	identifier, ok := provider.DataProvider.(music.Identifier)
+	if !ok {
+		return music.SongKey{}, false
+	}
+
+	return identifier.Identify(song)
+}
+
+func (provider *DataProvider) CanonicalPath(song music.Song) (string, bool) {
+	canonicalizer, ok := provider.DataProvider.(music.Canonicalizer)
+	if !ok {
+		return "", false
+	}
+
+	return canonicalizer.CanonicalPath(song)
+}
+
+func (provider *DataProvider) Alternatives(song music.Song) ([]music.Song, error) {
+	alternativeProvider, ok := provider.DataProvider.(music.AlternativeProvider)
+	if !ok {
+		return nil, nil
+	}
+
+	return alternativeProvider.Alternatives(song)
+}
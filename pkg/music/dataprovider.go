@@ -7,3 +7,29 @@ type DataProvider interface {
 	ProvideData(song *Song) error
 	AddPlaylist(string) (*Playlist, error)
 }
+
+// SongKey identifies a song at a provider regardless of the url that was used to add it, like
+// the id of a youtube video
+type SongKey struct {
+	Provider   string `json:"provider"`
+	Identifier string `json:"identifier"`
+}
+
+// Identifier is implemented by data providers that can tell which song a url refers to
+type Identifier interface {
+	Identify(song Song) (SongKey, bool)
+}
+
+// Canonicalizer is implemented by data providers that give songs a canonical url in ProvideData,
+// so songs that are answered from a cache get the same url
+type Canonicalizer interface {
+	// CanonicalPath returns the url ProvideData would give the song
+	CanonicalPath(song Song) (string, bool)
+}
+
+// AlternativeProvider is implemented by data providers that can find other sources for a song
+// that could not be played
+type AlternativeProvider interface {
+	// Alternatives returns the other sources of the song, the best one first
+	Alternatives(song Song) ([]Song, error)
+}
@@ -30,6 +30,16 @@ func (DataProvider) ProvideData(song *music.Song) error {
 	return nil
 }
 
+// Identify returns the user and track of the url
+func (DataProvider) Identify(song music.Song) (music.SongKey, bool) {
+	matches := soundCloudRegex.FindStringSubmatch(song.Path)
+	if matches == nil {
+		return music.SongKey{}, false
+	}
+
+	return music.SongKey{Provider: "soundcloud", Identifier: matches[1] + "/" + matches[2]}, true
+}
+
 func (DataProvider) Search(name string) ([]music.Song, error) {
 	return nil, nil
 }
@@ -0,0 +1,77 @@
+package youtube
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	ytdlpTimeout = 30 * time.Second
+	// maxAlternatives is the amount of other videos tried when a video can not be played
+	maxAlternatives = 2
+)
+
+// Alternatives returns the audio of the video as resolved by yt-dlp, which works when the player
+// fails to resolve it itself, followed by other videos with the same title
+func (provider *DataProvider) Alternatives(song music.Song) ([]music.Song, error) {
+	identifier, _, err := provider.getIdentifierAndStartTimeForSong(&song)
+	if err != nil {
+		return nil, err
+	}
+
+	alternatives := make([]music.Song, 0, maxAlternatives+1)
+
+	audioURL, err := resolveAudioURL(song.Path)
+	if err != nil {
+		log.Printf("YoutubeAPI: unable to resolve %s with yt-dlp: %v", song.Path, err)
+	} else {
+		alternative := song
+		alternative.Path = audioURL
+		alternatives = append(alternatives, alternative)
+	}
+
+	if song.Name == "" {
+		return alternatives, nil
+	}
+
+	results, err := provider.Search(song.Name)
+	if err != nil {
+		return alternatives, err
+	}
+
+	found := 0
+	for _, result := range results {
+		resultIdentifier, _, err := provider.getIdentifierAndStartTimeForSong(&result)
+		if err != nil || resultIdentifier == identifier {
+			continue
+		}
+
+		alternatives = append(alternatives, result)
+
+		found++
+		if found == maxAlternatives {
+			break
+		}
+	}
+
+	return alternatives, nil
+}
+
+// resolveAudioURL asks yt-dlp for the url of the audio of the video
+func resolveAudioURL(videoURL string) (string, error) {
+	output, err := runYtdlp("--no-playlist", "--format", "bestaudio/best", "--get-url", videoURL)
+	if err != nil {
+		return "", err
+	}
+
+	audioURL := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+	if audioURL == "" {
+		return "", errors.New("yt-dlp did not return a url")
+	}
+
+	return audioURL, nil
+}
@@ -0,0 +1,176 @@
+package youtube
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"google.golang.org/api/googleapi"
+)
+
+const (
+	// DefaultDailyQuota is the amount of units an api key may use per day
+	DefaultDailyQuota = 10000
+	// costList is the cost of looking up videos or playlists, regardless of how many
+	costList = 1
+	// costSearch is the cost of a search
+	costSearch = 100
+	// quotaWarning is the percentage of the quota after which the listener is warned
+	quotaWarning = 80
+)
+
+// errUnavailable is returned when the api can not be used, the data is looked up with yt-dlp
+// instead
+var errUnavailable = errors.New("the youtube api is not available")
+
+// quotaReset is the timezone in which the quota resets at midnight
+var quotaReset = pacificTime()
+
+// QuotaStats describes the use of the api today. The usage is an estimate, the real usage can
+// be found in the google cloud console.
+type QuotaStats struct {
+	// Enabled is false when no api key is configured
+	Enabled bool
+	Used    int
+	Limit   int
+	// Searches and Lookups count the calls to the api
+	Searches int
+	Lookups  int
+	// Fallbacks counts the lookups that were done with yt-dlp
+	Fallbacks int
+	// Exhausted is true when the api refused a call because the quota was used up
+	Exhausted bool
+	Reset     time.Time
+}
+
+// quota estimates the use of the daily quota of the api key
+type quota struct {
+	lock     sync.Mutex
+	stats    QuotaStats
+	warned   bool
+	listener func(QuotaStats)
+}
+
+func newQuota(enabled bool, limit int, now time.Time) *quota {
+	return &quota{
+		stats: QuotaStats{
+			Enabled: enabled,
+			Limit:   limit,
+			Reset:   nextReset(now),
+		},
+	}
+}
+
+// spend reserves the cost of a call, it returns false when the call would exceed the quota
+func (quota *quota) spend(cost int, now time.Time) bool {
+	quota.lock.Lock()
+	quota.resetIfNewDay(now)
+
+	if !quota.stats.Enabled || quota.stats.Exhausted || quota.stats.Used+cost > quota.stats.Limit {
+		quota.lock.Unlock()
+		return false
+	}
+
+	quota.stats.Used += cost
+	if cost == costSearch {
+		quota.stats.Searches++
+	} else {
+		quota.stats.Lookups++
+	}
+
+	warn := !quota.warned && quota.stats.Used*100 >= quota.stats.Limit*quotaWarning
+	if warn {
+		quota.warned = true
+	}
+
+	stats, listener := quota.stats, quota.listener
+	quota.lock.Unlock()
+
+	if warn && listener != nil {
+		listener(stats)
+	}
+
+	return true
+}
+
+// exhaust marks the quota as used up until it resets
+func (quota *quota) exhaust(now time.Time) {
+	quota.lock.Lock()
+	quota.resetIfNewDay(now)
+
+	if quota.stats.Exhausted {
+		quota.lock.Unlock()
+		return
+	}
+
+	quota.stats.Exhausted = true
+	quota.warned = true
+
+	stats, listener := quota.stats, quota.listener
+	quota.lock.Unlock()
+
+	if listener != nil {
+		listener(stats)
+	}
+}
+
+func (quota *quota) fallback() {
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+
+	quota.stats.Fallbacks++
+}
+
+func (quota *quota) get(now time.Time) QuotaStats {
+	quota.lock.Lock()
+	defer quota.lock.Unlock()
+
+	quota.resetIfNewDay(now)
+
+	return quota.stats
+}
+
+// resetIfNewDay starts counting again when the quota was reset. The lock must be held.
+func (quota *quota) resetIfNewDay(now time.Time) {
+	if now.Before(quota.stats.Reset) {
+		return
+	}
+
+	quota.stats = QuotaStats{
+		Enabled: quota.stats.Enabled,
+		Limit:   quota.stats.Limit,
+		Reset:   nextReset(now),
+	}
+	quota.warned = false
+}
+
+// nextReset returns the next midnight in pacific time, when the quota resets
+func nextReset(now time.Time) time.Time {
+	local := now.In(quotaReset)
+	return time.Date(local.Year(), local.Month(), local.Day()+1, 0, 0, 0, 0, quotaReset)
+}
+
+func pacificTime() *time.Location {
+	location, err := time.LoadLocation("America/Los_Angeles")
+	if err != nil {
+		return time.FixedZone("PST", -8*60*60)
+	}
+
+	return location
+}
+
+// isQuotaExceeded tells whether the api refused a call because the quota is used up
+func isQuotaExceeded(err error) bool {
+	var apiError *googleapi.Error
+	if !errors.As(err, &apiError) {
+		return false
+	}
+
+	for _, item := range apiError.Errors {
+		if item.Reason == "quotaExceeded" || item.Reason == "dailyLimitExceeded" {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,115 @@
+package youtube
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+	"google.golang.org/api/googleapi"
+)
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, quotaReset)
+	quota := newQuota(true, 250, now)
+
+	warnings := make([]QuotaStats, 0)
+	quota.listener = func(stats QuotaStats) {
+		warnings = append(warnings, stats)
+	}
+
+	assert.True(t, quota.spend(costSearch, now))
+	assert.True(t, quota.spend(costList, now))
+	assert.Empty(t, warnings)
+
+	// crossing 80% warns once
+	assert.True(t, quota.spend(costSearch, now))
+	assert.True(t, quota.spend(costList, now))
+	assert.Len(t, warnings, 1)
+	assert.Equal(t, 201, warnings[0].Used)
+
+	// a search does not fit anymore, a lookup does
+	assert.False(t, quota.spend(costSearch, now))
+	assert.True(t, quota.spend(costList, now))
+
+	quota.exhaust(now)
+	quota.exhaust(now)
+	assert.Len(t, warnings, 2)
+	assert.True(t, warnings[1].Exhausted)
+	assert.False(t, quota.spend(costList, now))
+
+	stats := quota.get(now)
+	assert.Equal(t, 2, stats.Searches)
+	assert.Equal(t, 3, stats.Lookups)
+
+	// the quota resets at midnight pacific time
+	tomorrow := time.Date(2024, 3, 2, 0, 0, 0, 0, quotaReset)
+	assert.Equal(t, tomorrow, stats.Reset)
+	assert.True(t, quota.spend(costSearch, tomorrow))
+	assert.Equal(t, 100, quota.get(tomorrow).Used)
+}
+
+func TestNewDataProvider_DefaultQuota(t *testing.T) {
+	t.Parallel()
+
+	provider, err := NewDataProvider("", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultDailyQuota, provider.Quota().Limit)
+
+	provider, err = NewDataProvider("", 500)
+	assert.NoError(t, err)
+	assert.Equal(t, 500, provider.Quota().Limit)
+}
+
+func TestIsQuotaExceeded(t *testing.T) {
+	t.Parallel()
+
+	exceeded := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}}
+	forbidden := &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}}
+
+	assert.True(t, isQuotaExceeded(exceeded))
+	assert.True(t, isQuotaExceeded(fmt.Errorf("wrapped: %w", exceeded)))
+	assert.False(t, isQuotaExceeded(forbidden))
+	assert.False(t, isQuotaExceeded(errors.New("other")))
+	assert.False(t, isQuotaExceeded(nil))
+}
+
+func TestDataProvider_Ytdlp(t *testing.T) {
+	t.Parallel()
+
+	calls := make([][]string, 0)
+	provider := &DataProvider{
+		quota: newQuota(false, DefaultDailyQuota, time.Now()),
+		ytdlp: func(arguments ...string) ([]byte, error) {
+			calls = append(calls, arguments)
+
+			if arguments[len(arguments)-1] == "ytsearch5:query" {
+				return []byte(`{"entries": [{"id": "abc", "title": "song", "channel": "artist", "duration": 61}]}`), nil
+			}
+
+			return []byte(`{"id": "xyz", "title": "other", "uploader": "uploader", "duration": 30.5}`), nil
+		},
+	}
+
+	songs, err := provider.Search("query")
+	assert.NoError(t, err)
+	assert.Equal(t, []music.Song{{
+		Name:     "song",
+		Artist:   "artist",
+		Duration: 61 * time.Second,
+		Path:     "https://www.youtube.com/watch?v=abc&t=0",
+	}}, songs)
+
+	song := music.Song{Path: "https://youtu.be/xyz?t=10"}
+	assert.NoError(t, provider.ProvideData(&song))
+	assert.Equal(t, "other", song.Name)
+	assert.Equal(t, "uploader", song.Artist)
+	assert.Equal(t, "https://www.youtube.com/watch?v=xyz&t=10", song.Path)
+
+	assert.Len(t, calls, 2)
+	assert.Equal(t, 2, provider.Quota().Fallbacks)
+}
@@ -4,10 +4,12 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log"
 	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	isoduration "github.com/channelmeter/iso8601duration"
 
@@ -19,19 +21,40 @@ import (
 const (
 	youTubeVideoURL = "https://www.youtube.com/watch?v=%s&t=%d"
 	MaxYoutubeItems = 500
+	// maxVideosPerCall is the amount of videos that can be looked up at once
+	maxVideosPerCall = 50
+	maxSearchResults = 5
+	maxPlaylistSongs = 350
 )
 
 var youtubeURLRegex = regexp.MustCompile(`^(https?:\/\/)?(www\.)?(youtube\.com|youtu\.?be)\/.+$`)
 var youtubePlaylistUrlRegex = regexp.MustCompile(`^(https?:\/\/)?(www\.)?(youtube\.com|youtu\.?be)\/(watch|playlist)\?(v=.+&)?list=.+$`)
 
+// DataProvider looks up videos with the youtube api. When no api key is configured or its
+// quota is used up, yt-dlp is used instead.
 type DataProvider struct {
 	apiKey  string
 	service *youtube.Service
+	quota   *quota
+	ytdlp   func(arguments ...string) ([]byte, error)
 }
 
-func NewDataProvider(apiKey string) (*DataProvider, error) {
+// NewDataProvider creates the data provider, dailyQuota is the amount of units the api key may
+// use per day, DefaultDailyQuota when it is not positive
+func NewDataProvider(apiKey string, dailyQuota int) (*DataProvider, error) {
+	if dailyQuota <= 0 {
+		dailyQuota = DefaultDailyQuota
+	}
+
 	instance := &DataProvider{
 		apiKey: apiKey,
+		quota:  newQuota(apiKey != "", dailyQuota, time.Now()),
+		ytdlp:  runYtdlp,
+	}
+
+	if apiKey == "" {
+		log.Printf("YoutubeAPI: no api key configured, using yt-dlp")
+		return instance, nil
 	}
 
 	err := instance.initAPIClient()
@@ -43,6 +66,36 @@ func NewDataProvider(apiKey string) (*DataProvider, error) {
 	return instance, nil
 }
 
+// Quota returns the estimated use of the quota of the api key today
+func (provider *DataProvider) Quota() QuotaStats {
+	return provider.quota.get(time.Now())
+}
+
+// SetQuotaListener sets the function that is called when the use of the quota gets close to
+// the limit, and when the quota is used up
+func (provider *DataProvider) SetQuotaListener(listener func(QuotaStats)) {
+	provider.quota.lock.Lock()
+	defer provider.quota.lock.Unlock()
+
+	provider.quota.listener = listener
+}
+
+// call calls the api when the quota allows it, errUnavailable is returned when it does not
+func (provider *DataProvider) call(cost int, do func() error) error {
+	if provider.service == nil || !provider.quota.spend(cost, time.Now()) {
+		return errUnavailable
+	}
+
+	err := do()
+	if isQuotaExceeded(err) {
+		log.Printf("YoutubeAPI: the quota is used up, using yt-dlp: %v", err)
+		provider.quota.exhaust(time.Now())
+		return errUnavailable
+	}
+
+	return err
+}
+
 func (provider *DataProvider) initAPIClient() error {
 	service, err := youtube.NewService(context.Background(), option.WithAPIKey(provider.apiKey))
 	if err != nil {
@@ -64,39 +117,130 @@ func (provider *DataProvider) ProvideData(song *music.Song) error {
 		return err
 	}
 
-	return provider.provideDataForIdentifierAndStartTime(identifier, startTime, song)
+	err = provider.provideDataForIdentifierAndStartTime(identifier, startTime, song)
+	if errors.Is(err, errUnavailable) {
+		return provider.provideDataWithYtdlp(identifier, startTime, song)
+	}
+
+	return err
 }
 
 func (provider *DataProvider) provideDataForIdentifierAndStartTime(identifier string, startTime int, song *music.Song) error {
-	call := provider.service.Videos.List([]string{"snippet", "contentDetails"}).Id(identifier)
-	response, err := call.Do()
+	var response *youtube.VideoListResponse
+	err := provider.call(costList, func() (err error) {
+		response, err = provider.service.Videos.List([]string{"snippet", "contentDetails"}).Id(identifier).Do()
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("could not get data for url: %v", err)
+		return fmt.Errorf("could not get data for url: %w", err)
 	}
 
 	for _, item := range response.Items {
 		if item.Id == identifier && item.Kind == "youtube#video" {
-			if item.Snippet == nil {
-				return errors.New("snippet not found")
+			found, err := songForVideo(item, startTime)
+			if err != nil {
+				return err
 			}
 
-			song.Name = item.Snippet.Title
-			song.Artist = item.Snippet.ChannelTitle
+			*song = found
+			return nil
+		}
+	}
+
+	return fmt.Errorf("playable not found for: %s", identifier)
+}
 
-			duration, err := isoduration.FromString(item.ContentDetails.Duration)
+// provideDataForIdentifiers looks up the videos in batches, which costs a single api call per
+// batch. The songs are in the order of the identifiers, videos that are not found are left out.
+func (provider *DataProvider) provideDataForIdentifiers(identifiers []string) ([]music.Song, error) {
+	songs := make([]music.Song, 0, len(identifiers))
 
-			if err != nil {
-				return err
+	for start := 0; start < len(identifiers); start += maxVideosPerCall {
+		end := start + maxVideosPerCall
+		if end > len(identifiers) {
+			end = len(identifiers)
+		}
+
+		batch := identifiers[start:end]
+
+		var response *youtube.VideoListResponse
+		err := provider.call(costList, func() (err error) {
+			response, err = provider.service.Videos.List([]string{"snippet", "contentDetails"}).Id(batch...).Do()
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("could not get data for videos: %w", err)
+		}
+
+		videos := make(map[string]*youtube.Video, len(response.Items))
+		for _, item := range response.Items {
+			if item.Kind == "youtube#video" {
+				videos[item.Id] = item
 			}
+		}
 
-			song.Duration = duration.ToDuration()
+		for _, identifier := range batch {
+			video, exists := videos[identifier]
+			if !exists {
+				continue
+			}
 
-			song.Path = fmt.Sprintf(youTubeVideoURL, identifier, startTime)
-			return nil
+			song, err := songForVideo(video, 0)
+			if err != nil {
+				continue
+			}
+
+			songs = append(songs, song)
 		}
 	}
 
-	return fmt.Errorf("playable not found for: %s", identifier)
+	return songs, nil
+}
+
+func songForVideo(item *youtube.Video, startTime int) (music.Song, error) {
+	if item.Snippet == nil {
+		return music.Song{}, errors.New("snippet not found")
+	}
+
+	duration, err := isoduration.FromString(item.ContentDetails.Duration)
+	if err != nil {
+		return music.Song{}, err
+	}
+
+	return music.Song{
+		Name:     item.Snippet.Title,
+		Artist:   item.Snippet.ChannelTitle,
+		Duration: duration.ToDuration(),
+		Path:     fmt.Sprintf(youTubeVideoURL, item.Id, startTime),
+	}, nil
+}
+
+// Identify returns the id of the video
+func (provider *DataProvider) Identify(song music.Song) (music.SongKey, bool) {
+	if !provider.CanProvideData(song) {
+		return music.SongKey{}, false
+	}
+
+	identifier, _, err := provider.getIdentifierAndStartTimeForSong(&song)
+	if err != nil {
+		return music.SongKey{}, false
+	}
+
+	return music.SongKey{Provider: "youtube", Identifier: identifier}, true
+}
+
+// CanonicalPath returns the url of the video ProvideData gives the song, keeping the start time
+func (provider *DataProvider) CanonicalPath(song music.Song) (string, bool) {
+	if !provider.CanProvideData(song) {
+		return "", false
+	}
+
+	identifier, startTime, err := provider.getIdentifierAndStartTimeForSong(&song)
+	if err != nil {
+		return "", false
+	}
+
+	return fmt.Sprintf(youTubeVideoURL, identifier, startTime), true
 }
 
 func (provider *DataProvider) getIdentifierAndStartTimeForSong(song *music.Song) (string, int, error) {
@@ -125,32 +269,44 @@ func (provider *DataProvider) getIdentifierAndStartTimeForSong(song *music.Song)
 }
 
 func (provider *DataProvider) Search(searchString string) ([]music.Song, error) {
-	searchTypeStr := "video"
+	songs, err := provider.searchWithAPI(searchString)
+	if errors.Is(err, errUnavailable) {
+		return provider.searchWithYtdlp(searchString)
+	}
+
+	return songs, err
+}
 
-	call := provider.service.Search.List([]string{"id", "snippet"}).
-		Q(searchString).
-		Type(searchTypeStr).
-		MaxResults(int64(5))
+func (provider *DataProvider) searchWithAPI(searchString string) ([]music.Song, error) {
+	searchTypeStr := "video"
 
-	response, err := call.Do()
+	var response *youtube.SearchListResponse
+	err := provider.call(costSearch, func() (err error) {
+		response, err = provider.service.Search.List([]string{"id", "snippet"}).
+			Q(searchString).
+			Type(searchTypeStr).
+			MaxResults(int64(maxSearchResults)).
+			Do()
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("YoutubeApi: error searching %s: %v", searchString, err)
+		return nil, fmt.Errorf("YoutubeApi: error searching %s: %w", searchString, err)
 	}
 
-	songs := make([]music.Song, 0)
+	identifiers := make([]string, 0, len(response.Items))
 
 	for _, item := range response.Items {
 		switch item.Id.Kind {
 		case "youtube#video":
-			song := &music.Song{}
-			err = provider.provideDataForIdentifierAndStartTime(item.Id.VideoId, 0, song)
-			if err != nil {
-				return nil, fmt.Errorf("error finding data: %v", err)
-			}
-
-			songs = append(songs, *song)
+			identifiers = append(identifiers, item.Id.VideoId)
 		}
 	}
+
+	songs, err := provider.provideDataForIdentifiers(identifiers)
+	if err != nil {
+		return nil, fmt.Errorf("error finding data: %w", err)
+	}
+
 	return songs, nil
 }
 
@@ -166,14 +322,27 @@ func (provider *DataProvider) AddPlaylist(ytUrl string) (*music.Playlist, error)
 
 	identifier := playlistUrl.Query().Get("list")
 
+	playlist, err := provider.addPlaylistWithAPI(identifier)
+	if errors.Is(err, errUnavailable) {
+		return provider.addPlaylistWithYtdlp(identifier)
+	}
+
+	return playlist, err
+}
+
+func (provider *DataProvider) addPlaylistWithAPI(identifier string) (*music.Playlist, error) {
 	var playlist music.Playlist
-	callPlaylist := provider.service.Playlists.List([]string{"snippet"}).
-		Id(identifier).
-		MaxResults(1)
 
-	responsePlaylist, err := callPlaylist.Do()
+	var responsePlaylist *youtube.PlaylistListResponse
+	err := provider.call(costList, func() (err error) {
+		responsePlaylist, err = provider.service.Playlists.List([]string{"snippet"}).
+			Id(identifier).
+			MaxResults(1).
+			Do()
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("YoutubeApi: error finding playlist with id '%s': %v", identifier, err)
+		return nil, fmt.Errorf("YoutubeApi: error finding playlist with id '%s': %w", identifier, err)
 	}
 
 	for _, item := range responsePlaylist.Items {
@@ -185,30 +354,37 @@ func (provider *DataProvider) AddPlaylist(ytUrl string) (*music.Playlist, error)
 
 	nextPageToken := ""
 	for {
-		if playlist.Length() >= 350 {
+		if playlist.Length() >= maxPlaylistSongs {
 			break
 		}
 
-		call := provider.service.PlaylistItems.List([]string{"contentDetails", "snippet"}).
-			PlaylistId(identifier).
-			MaxResults(50).
-			PageToken(nextPageToken)
-
-		response, err := call.Do()
+		var response *youtube.PlaylistItemListResponse
+		err := provider.call(costList, func() (err error) {
+			response, err = provider.service.PlaylistItems.List([]string{"contentDetails", "snippet"}).
+				PlaylistId(identifier).
+				MaxResults(50).
+				PageToken(nextPageToken).
+				Do()
+			return err
+		})
 		if err != nil {
-			return nil, fmt.Errorf("YoutubeApi: error finding playlist with id '%s': %v", identifier, err)
+			return nil, fmt.Errorf("YoutubeApi: error finding playlist with id '%s': %w", identifier, err)
 		}
 
+		identifiers := make([]string, 0, len(response.Items))
 		for _, item := range response.Items {
 			if item.Kind != "youtube#playlistItem" {
 				continue
 			}
-			var song music.Song
-			err := provider.provideDataForIdentifierAndStartTime(item.ContentDetails.VideoId, 0, &song)
-			if err != nil {
-				continue
-			}
+			identifiers = append(identifiers, item.ContentDetails.VideoId)
+		}
+
+		songs, err := provider.provideDataForIdentifiers(identifiers)
+		if err != nil {
+			return nil, fmt.Errorf("YoutubeApi: error finding the videos of playlist '%s': %w", identifier, err)
+		}
 
+		for _, song := range songs {
 			playlist.AddSong(song)
 		}
 		nextPageToken = response.NextPageToken
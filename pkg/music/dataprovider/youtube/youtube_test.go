@@ -0,0 +1,26 @@
+package youtube
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+func TestDataProvider_CanonicalPath(t *testing.T) {
+	t.Parallel()
+
+	provider, err := NewDataProvider("", 0)
+	assert.NoError(t, err)
+
+	path, ok := provider.CanonicalPath(music.Song{Path: "https://youtu.be/dQw4w9WgXcQ?t=42s"})
+	assert.True(t, ok)
+	assert.Equal(t, "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=42", path)
+
+	path, ok = provider.CanonicalPath(music.Song{Path: "https://www.youtube.com/watch?v=dQw4w9WgXcQ&list=abc"})
+	assert.True(t, ok)
+	assert.Equal(t, "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=0", path)
+
+	_, ok = provider.CanonicalPath(music.Song{Path: "https://soundcloud.com/artist/track"})
+	assert.False(t, ok)
+}
@@ -0,0 +1,128 @@
+package youtube
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// ytdlpVideo is the part of the info of a video that yt-dlp returns that is used
+type ytdlpVideo struct {
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	Channel  string  `json:"channel"`
+	Uploader string  `json:"uploader"`
+	Duration float64 `json:"duration"`
+}
+
+// ytdlpPlaylist is the info of a playlist or search results
+type ytdlpPlaylist struct {
+	Title   string       `json:"title"`
+	Entries []ytdlpVideo `json:"entries"`
+}
+
+func (video ytdlpVideo) song(startTime int) music.Song {
+	artist := video.Channel
+	if artist == "" {
+		artist = video.Uploader
+	}
+
+	return music.Song{
+		Name:     video.Title,
+		Artist:   artist,
+		Duration: time.Duration(video.Duration * float64(time.Second)),
+		Path:     fmt.Sprintf(youTubeVideoURL, video.ID, startTime),
+	}
+}
+
+// runYtdlp runs yt-dlp and returns what it writes to stdout
+func runYtdlp(arguments ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ytdlpTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "yt-dlp", arguments...).Output()
+	if err != nil {
+		return nil, fmt.Errorf("yt-dlp failed: %v", err)
+	}
+
+	return output, nil
+}
+
+// ytdlpJSON runs yt-dlp with the arguments and decodes the info it prints
+func (provider *DataProvider) ytdlpJSON(value interface{}, arguments ...string) error {
+	provider.quota.fallback()
+
+	output, err := provider.ytdlp(append([]string{"--dump-single-json", "--skip-download"}, arguments...)...)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(output, value); err != nil {
+		return fmt.Errorf("unable to decode the output of yt-dlp: %v", err)
+	}
+
+	return nil
+}
+
+func (provider *DataProvider) provideDataWithYtdlp(identifier string, startTime int, song *music.Song) error {
+	var video ytdlpVideo
+
+	err := provider.ytdlpJSON(&video, "--no-playlist", fmt.Sprintf(youTubeVideoURL, identifier, 0))
+	if err != nil {
+		return fmt.Errorf("could not get data for url: %v", err)
+	}
+
+	if video.ID == "" {
+		return fmt.Errorf("playable not found for: %s", identifier)
+	}
+
+	*song = video.song(startTime)
+
+	return nil
+}
+
+func (provider *DataProvider) searchWithYtdlp(searchString string) ([]music.Song, error) {
+	var results ytdlpPlaylist
+
+	err := provider.ytdlpJSON(&results, "--flat-playlist", "ytsearch"+strconv.Itoa(maxSearchResults)+":"+searchString)
+	if err != nil {
+		return nil, fmt.Errorf("error searching %s: %v", searchString, err)
+	}
+
+	songs := make([]music.Song, 0, len(results.Entries))
+	for _, entry := range results.Entries {
+		if entry.ID != "" {
+			songs = append(songs, entry.song(0))
+		}
+	}
+
+	return songs, nil
+}
+
+func (provider *DataProvider) addPlaylistWithYtdlp(identifier string) (*music.Playlist, error) {
+	var info ytdlpPlaylist
+
+	err := provider.ytdlpJSON(&info, "--flat-playlist", "--playlist-end", strconv.Itoa(maxPlaylistSongs),
+		"https://www.youtube.com/playlist?list="+identifier)
+	if err != nil {
+		return nil, fmt.Errorf("error finding playlist with id '%s': %v", identifier, err)
+	}
+
+	playlist := music.Playlist{Title: info.Title}
+	for _, entry := range info.Entries {
+		if entry.ID != "" {
+			playlist.AddSong(entry.song(0))
+		}
+	}
+
+	if playlist.Length() == 0 {
+		return nil, fmt.Errorf("error finding any video's in this playlist")
+	}
+
+	return &playlist, nil
+}
@@ -0,0 +1,23 @@
+package music
+
+import "errors"
+
+// TemporaryError is returned by providers when trying again might work, like when the provider
+// did not answer in time
+type TemporaryError struct {
+	Err error
+}
+
+func (err TemporaryError) Error() string {
+	return err.Err.Error()
+}
+
+func (err TemporaryError) Unwrap() error {
+	return err.Err
+}
+
+// IsTemporary returns whether the error or one of the errors it wraps is temporary
+func IsTemporary(err error) bool {
+	var temporary TemporaryError
+	return errors.As(err, &temporary)
+}
@@ -0,0 +1,126 @@
+package metadata
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// DataProvider answers lookups of songs and searches from the cache, and stores the answers of
+// the data provider it wraps
+type DataProvider struct {
+	music.DataProvider
+	cache *Cache
+	// name separates the searches of the different data providers
+	name string
+}
+
+// Wrap caches the metadata the data provider looks up
+func (cache *Cache) Wrap(provider music.DataProvider) *DataProvider {
+	return &DataProvider{
+		DataProvider: provider,
+		cache:        cache,
+		name:         fmt.Sprintf("%T", provider),
+	}
+}
+
+func (provider *DataProvider) ProvideData(song *music.Song) error {
+	key := provider.key(*song)
+
+	if cached, ok := provider.cache.Get(key); ok {
+		song.Name = cached.Name
+		song.Artist = cached.Artist
+		song.Duration = cached.Duration
+		song.SongType = cached.SongType
+
+		// the cached song might have been added with another url or start time
+		if path, ok := provider.CanonicalPath(*song); ok {
+			song.Path = path
+		}
+
+		return nil
+	}
+
+	err := provider.DataProvider.ProvideData(song)
+	if err != nil {
+		return err
+	}
+
+	provider.cache.Put(key, *song)
+
+	return nil
+}
+
+func (provider *DataProvider) Search(query string) ([]music.Song, error) {
+	key := "search:" + provider.name + ":" + strings.ToLower(strings.TrimSpace(query))
+
+	if results, ok := provider.cache.Results(key); ok {
+		return results, nil
+	}
+
+	results, err := provider.DataProvider.Search(query)
+	if err != nil {
+		return nil, err
+	}
+
+	provider.cache.PutResults(key, results)
+	provider.putSongs(results)
+
+	return results, nil
+}
+
+// AddPlaylist always asks the data provider because playlists change, the songs are cached
+func (provider *DataProvider) AddPlaylist(identifier string) (*music.Playlist, error) {
+	playlist, err := provider.DataProvider.AddPlaylist(identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	provider.putSongs(playlist.Songs)
+
+	return playlist, nil
+}
+
+func (provider *DataProvider) Identify(song music.Song) (music.SongKey, bool) {
+	identifier, ok := provider.DataProvider.(music.Identifier)
+	if !ok {
+		return music.SongKey{}, false
+	}
+
+	return identifier.Identify(song)
+}
+
+func (provider *DataProvider) CanonicalPath(song music.Song) (string, bool) {
+	canonicalizer, ok := provider.DataProvider.(music.Canonicalizer)
+	if !ok {
+		return "", false
+	}
+
+	return canonicalizer.CanonicalPath(song)
+}
+
+func (provider *DataProvider) Alternatives(song music.Song) ([]music.Song, error) {
+	alternativeProvider, ok := provider.DataProvider.(music.AlternativeProvider)
+	if !ok {
+		return nil, nil
+	}
+
+	return alternativeProvider.Alternatives(song)
+}
+
+func (provider *DataProvider) putSongs(songs []music.Song) {
+	for _, song := range songs {
+		provider.cache.Put(provider.key(song), song)
+	}
+}
+
+// key returns the key of the song, so the different urls of a song share the metadata when the
+// data provider can identify them
+func (provider *DataProvider) key(song music.Song) string {
+	if key, ok := provider.Identify(song); ok {
+		return "song:" + key.Provider + ":" + key.Identifier
+	}
+
+	return "url:" + song.Path
+}
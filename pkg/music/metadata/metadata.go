@@ -0,0 +1,264 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	// maxEntries is the amount of songs and searches that are kept, the oldest are removed first
+	maxEntries = 10000
+	// saveInterval is how often changes are written to the file
+	saveInterval = time.Minute
+)
+
+// Config configures the cache
+type Config struct {
+	// File is where the cache is persisted, the cache is only kept in memory when it is empty
+	File string
+	// TTL is how long the metadata of a song is used before it is looked up again
+	TTL time.Duration
+	// SearchTTL is how long the results of a search are used
+	SearchTTL time.Duration
+}
+
+// Entry is the metadata of a song, or the results of a search
+type Entry struct {
+	Song    music.Song   `json:"song,omitempty"`
+	Results []music.Song `json:"results,omitempty"`
+	Fetched time.Time    `json:"fetched"`
+}
+
+// Stats describes the contents and use of the cache
+type Stats struct {
+	Entries int
+	// Hits and Misses count the lookups since the bot started
+	Hits   int
+	Misses int
+}
+
+// Cache keeps the metadata of songs that were looked up, so adding a song again or adding a
+// song from the search results does not have to ask the data provider again
+type Cache struct {
+	config Config
+
+	lock    sync.Mutex
+	entries map[string]*Entry
+	dirty   bool
+	hits    int
+	misses  int
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// Open creates the cache and loads the file of the config when it exists
+func Open(config Config) (*Cache, error) {
+	cache := &Cache{
+		config:  config,
+		entries: make(map[string]*Entry),
+		stop:    make(chan struct{}),
+	}
+
+	if config.File == "" {
+		return cache, nil
+	}
+
+	data, err := os.ReadFile(config.File)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read the metadata cache: %v", err)
+	}
+
+	if err == nil {
+		if err := json.Unmarshal(data, &cache.entries); err != nil {
+			return nil, fmt.Errorf("unable to decode the metadata cache: %v", err)
+		}
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.evict(time.Now())
+
+	return cache, nil
+}
+
+// Start periodically writes the changes to the file
+func (cache *Cache) Start() {
+	if cache.config.File == "" {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(saveInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-cache.stop:
+				return
+			case <-ticker.C:
+				if err := cache.Save(); err != nil {
+					log.Printf("Metadata: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop stops writing the changes and writes the remaining ones
+func (cache *Cache) Stop() {
+	cache.once.Do(func() {
+		close(cache.stop)
+	})
+
+	if err := cache.Save(); err != nil {
+		log.Printf("Metadata: %v", err)
+	}
+}
+
+// Get returns the metadata of the song with the key
+func (cache *Cache) Get(key string) (music.Song, bool) {
+	entry, ok := cache.get(key, cache.config.TTL)
+	if !ok {
+		return music.Song{}, false
+	}
+
+	return entry.Song, true
+}
+
+// Put stores the metadata of the song with the key
+func (cache *Cache) Put(key string, song music.Song) {
+	cache.put(key, &Entry{Song: song, Fetched: time.Now()})
+}
+
+// Results returns the results of the search with the key
+func (cache *Cache) Results(key string) ([]music.Song, bool) {
+	entry, ok := cache.get(key, cache.config.SearchTTL)
+	if !ok {
+		return nil, false
+	}
+
+	return append([]music.Song(nil), entry.Results...), true
+}
+
+// PutResults stores the results of the search with the key
+func (cache *Cache) PutResults(key string, results []music.Song) {
+	cache.put(key, &Entry{Results: append([]music.Song(nil), results...), Fetched: time.Now()})
+}
+
+// Stats returns the size of the cache and how often it was used
+func (cache *Cache) Stats() Stats {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	return Stats{
+		Entries: len(cache.entries),
+		Hits:    cache.hits,
+		Misses:  cache.misses,
+	}
+}
+
+// Clear removes all metadata from the cache
+func (cache *Cache) Clear() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries = make(map[string]*Entry)
+	cache.dirty = true
+}
+
+// Save writes the cache to the file when it changed
+func (cache *Cache) Save() error {
+	if cache.config.File == "" {
+		return nil
+	}
+
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	if !cache.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(cache.entries)
+	if err != nil {
+		return fmt.Errorf("unable to encode the metadata cache: %v", err)
+	}
+
+	if err := os.WriteFile(cache.config.File, data, 0644); err != nil {
+		return fmt.Errorf("unable to save the metadata cache: %v", err)
+	}
+
+	cache.dirty = false
+
+	return nil
+}
+
+func (cache *Cache) get(key string, ttl time.Duration) (*Entry, bool) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, exists := cache.entries[key]
+	if !exists || (ttl > 0 && time.Since(entry.Fetched) > ttl) {
+		cache.misses++
+		return nil, false
+	}
+
+	cache.hits++
+
+	return entry, true
+}
+
+func (cache *Cache) put(key string, entry *Entry) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	cache.entries[key] = entry
+	cache.dirty = true
+
+	if len(cache.entries) > maxEntries {
+		cache.evict(time.Now())
+	}
+}
+
+// evict removes the expired entries, and the oldest ones until there are at most maxEntries.
+// The lock must be held.
+func (cache *Cache) evict(now time.Time) {
+	keys := make([]string, 0, len(cache.entries))
+	for key, entry := range cache.entries {
+		ttl := cache.config.TTL
+		if entry.Results != nil {
+			ttl = cache.config.SearchTTL
+		}
+
+		if ttl > 0 && now.Sub(entry.Fetched) > ttl {
+			delete(cache.entries, key)
+			cache.dirty = true
+			continue
+		}
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) <= maxEntries {
+		return
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return cache.entries[keys[i]].Fetched.Before(cache.entries[keys[j]].Fetched)
+	})
+
+	for _, key := range keys[:len(keys)-maxEntries] {
+		delete(cache.entries, key)
+	}
+
+	cache.dirty = true
+}
@@ -0,0 +1,168 @@
+package metadata
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// fakeProvider counts the lookups, and uses the part of the path after the last = as the
+// identifier of a song
+type fakeProvider struct {
+	lookups  int
+	searches int
+}
+
+func (provider *fakeProvider) CanProvideData(song music.Song) bool {
+	return true
+}
+
+func (provider *fakeProvider) Search(query string) ([]music.Song, error) {
+	provider.searches++
+	return []music.Song{{Name: query, Path: "https://example.com/watch?v=" + query}}, nil
+}
+
+func (provider *fakeProvider) ProvideData(song *music.Song) error {
+	provider.lookups++
+	song.Name = "name of " + song.Path
+	song.Duration = time.Minute
+	return nil
+}
+
+func (provider *fakeProvider) AddPlaylist(identifier string) (*music.Playlist, error) {
+	return &music.Playlist{Songs: []music.Song{{Name: "first", Path: "?v=first"}}}, nil
+}
+
+func (provider *fakeProvider) Identify(song music.Song) (music.SongKey, bool) {
+	index := strings.LastIndex(song.Path, "=")
+	if index == -1 {
+		return music.SongKey{}, false
+	}
+
+	return music.SongKey{Provider: "fake", Identifier: song.Path[index+1:]}, true
+}
+
+func TestDataProvider(t *testing.T) {
+	t.Parallel()
+
+	cache, err := Open(Config{TTL: time.Hour, SearchTTL: time.Hour})
+	assert.NoError(t, err)
+
+	fake := &fakeProvider{}
+	provider := cache.Wrap(fake)
+
+	song := music.Song{Path: "https://example.com/watch?v=abc"}
+	assert.NoError(t, provider.ProvideData(&song))
+	assert.Equal(t, 1, fake.lookups)
+
+	// another url of the same song uses the cached metadata and keeps its own path
+	other := music.Song{Path: "https://short.example.com/?v=abc"}
+	assert.NoError(t, provider.ProvideData(&other))
+	assert.Equal(t, 1, fake.lookups)
+	assert.Equal(t, song.Name, other.Name)
+	assert.Equal(t, "https://short.example.com/?v=abc", other.Path)
+
+	// the search results and the songs of playlists are cached
+	results, err := provider.Search("query")
+	assert.NoError(t, err)
+	_, err = provider.Search(" Query ")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, fake.searches)
+
+	assert.NoError(t, provider.ProvideData(&results[0]))
+	assert.Equal(t, "query", results[0].Name)
+
+	_, err = provider.AddPlaylist("playlist")
+	assert.NoError(t, err)
+
+	first := music.Song{Path: "?v=first"}
+	assert.NoError(t, provider.ProvideData(&first))
+	assert.Equal(t, "first", first.Name)
+	assert.Equal(t, 1, fake.lookups)
+
+	key, ok := provider.Identify(song)
+	assert.True(t, ok)
+	assert.Equal(t, "abc", key.Identifier)
+}
+
+// canonicalProvider gives every song the url example.com/watch?v=<identifier>
+type canonicalProvider struct {
+	fakeProvider
+}
+
+func (provider *canonicalProvider) CanonicalPath(song music.Song) (string, bool) {
+	key, ok := provider.Identify(song)
+	if !ok {
+		return "", false
+	}
+
+	return "https://example.com/watch?v=" + key.Identifier, true
+}
+
+func TestDataProvider_CanonicalPath(t *testing.T) {
+	t.Parallel()
+
+	cache, err := Open(Config{TTL: time.Hour, SearchTTL: time.Hour})
+	assert.NoError(t, err)
+
+	fake := &canonicalProvider{}
+	provider := cache.Wrap(fake)
+
+	song := music.Song{Path: "https://example.com/watch?v=abc"}
+	assert.NoError(t, provider.ProvideData(&song))
+
+	// a cached song gets the url the data provider would have given it
+	other := music.Song{Path: "https://short.example.com/?v=abc"}
+	assert.NoError(t, provider.ProvideData(&other))
+	assert.Equal(t, 1, fake.lookups)
+	assert.Equal(t, "https://example.com/watch?v=abc", other.Path)
+}
+
+func TestCache_Expired(t *testing.T) {
+	t.Parallel()
+
+	cache, err := Open(Config{TTL: time.Hour})
+	assert.NoError(t, err)
+
+	cache.put("old", &Entry{Song: music.Song{Name: "old"}, Fetched: time.Now().Add(-2 * time.Hour)})
+	cache.Put("new", music.Song{Name: "new"})
+
+	_, ok := cache.Get("old")
+	assert.False(t, ok)
+
+	song, ok := cache.Get("new")
+	assert.True(t, ok)
+	assert.Equal(t, "new", song.Name)
+
+	stats := cache.Stats()
+	assert.Equal(t, 1, stats.Hits)
+	assert.Equal(t, 1, stats.Misses)
+}
+
+func TestCache_Persisted(t *testing.T) {
+	t.Parallel()
+
+	file := filepath.Join(t.TempDir(), "metadata.json")
+
+	cache, err := Open(Config{File: file, TTL: time.Hour})
+	assert.NoError(t, err)
+
+	cache.Put("song", music.Song{Name: "song", Duration: time.Minute})
+	cache.PutResults("search", []music.Song{{Name: "result"}})
+	assert.NoError(t, cache.Save())
+
+	cache, err = Open(Config{File: file, TTL: time.Hour, SearchTTL: time.Hour})
+	assert.NoError(t, err)
+
+	song, ok := cache.Get("song")
+	assert.True(t, ok)
+	assert.Equal(t, time.Minute, song.Duration)
+
+	results, ok := cache.Results("search")
+	assert.True(t, ok)
+	assert.Equal(t, "result", results[0].Name)
+}
@@ -9,6 +9,16 @@ import (
 const (
 	EventSongStarted    = "song-started"
 	EventSongStartError = "song-start-error"
+	// EventSongFallback is emitted when a song could not be played and another source of it is
+	// played instead, with the song, the alternative and the error of the song
+	EventSongFallback = "song-fallback"
+	// EventSleepTimerEnded is emitted when the player is paused by the sleep timer
+	EventSleepTimerEnded = "sleep-timer-ended"
+	// EventProviderCrashed is emitted with the error when a provider crashed and is restarting
+	EventProviderCrashed = "provider-crashed"
+	// EventProviderRestarted is emitted when a crashed provider is running again, with the song
+	// that was playing and whether it could be resumed
+	EventProviderRestarted = "provider-restarted"
 )
 
 // Player is the wrapper around MusicProviders. This should keep track of the queue and control
@@ -26,10 +36,37 @@ type Player interface {
 	Next() error
 	Pause() error
 	Play() error
+	// Seek to an absolute position in the current song
+	Seek(position time.Duration) error
+	// SeekRelative seeks forwards or backwards from the current position
+	SeekRelative(offset time.Duration) error
 	Stop()
 	GetStatus() PlayerStatus
+	// GetCurrentSong returns the current song and the time remaining
 	GetCurrentSong() (*Song, time.Duration)
+	// GetPosition returns the playback position in and the duration of the current song
+	GetPosition() (position time.Duration, duration time.Duration)
 	GetQueue() *Queue
+	SetRepeatMode(mode RepeatMode) error
+	// SetNormalization enables or disables loudness normalisation for the providers that support it
+	SetNormalization(enabled bool) error
+	GetNormalization() bool
+	GetRepeatMode() RepeatMode
+	// SetPolicy restricts the volume and adding songs, nil removes all restrictions
+	SetPolicy(policy Policy)
+	// GetAudioDevices lists the audio outputs of the providers that support switching them
+	GetAudioDevices() ([]AudioDevice, error)
+	SetAudioDevice(name string) error
+	// AddMirror adds a provider that plays the same songs as the player
+	AddMirror(provider Provider)
+	RemoveMirror(provider Provider)
+	// SetStopAfter stops the player after the current song, until Play is called
+	SetStopAfter(enabled bool) error
+	GetStopAfter() bool
+	// Sleep fades out and pauses the player after the duration, 0 cancels the sleep timer
+	Sleep(duration time.Duration)
+	// GetSleepTimer returns the time until the sleep timer ends, if it is running
+	GetSleepTimer() (remaining time.Duration, running bool)
 	AddPlaylist(string) (*Playlist, error)
 }
 
@@ -41,6 +78,8 @@ const (
 	PlayerStatusLoading  PlayerStatus = "loading"
 	PlayerStatusPlaying  PlayerStatus = "playing"
 	PlayerStatusPaused   PlayerStatus = "paused"
+	// PlayerStatusStopped is used when the player stopped after a song and waits for play
+	PlayerStatusStopped PlayerStatus = "stopped"
 )
 
 func (s PlayerStatus) CanBeSkipped() bool {
@@ -50,3 +89,17 @@ func (s PlayerStatus) CanBeSkipped() bool {
 
 	return false
 }
+
+type RepeatMode string
+
+const (
+	RepeatModeOff RepeatMode = "off"
+	// RepeatModeOne plays the current song again until it is skipped
+	RepeatModeOne RepeatMode = "repeat-one"
+	// RepeatModeAll appends every song to the queue again after it has been played
+	RepeatModeAll RepeatMode = "repeat-all"
+)
+
+func (mode RepeatMode) IsValid() bool {
+	return mode == RepeatModeOff || mode == RepeatModeOne || mode == RepeatModeAll
+}
@@ -0,0 +1,142 @@
+package player
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	// startRetries is how often a temporary error of a provider is retried
+	startRetries    = 2
+	startRetryDelay = 2 * time.Second
+	// startSongTimeout is how long startSong keeps trying, the song can't be skipped meanwhile
+	startSongTimeout = 2 * time.Minute
+)
+
+var errNoProvider = errors.New("no provider can play the song")
+
+// startSong plays the song on the first provider that manages to. Providers on the machine of
+// the bot play the prepared version of the song when there is one. Temporary errors are retried,
+// other errors move on to the next provider that can play the song. When none of them can, the
+// data providers are asked for other sources of the song. The song that is played is returned,
+// which is an alternative when the song itself could not be played. It is announced and
+// mirrored as it is, as the prepared version only works on the machine of the bot.
+func (player *MusicPlayer) startSong(song music.Song) (music.Provider, music.Song, error) {
+	player.startDeadline = time.Now().Add(player.startTimeout)
+
+	provider, err := player.tryProviders(song, player.prepared(song))
+	if err == nil {
+		return provider, song, nil
+	}
+
+	if player.shouldStop || player.startExpired() {
+		return nil, song, err
+	}
+
+	log.Printf("unable to play %s, looking for another source: %v", song.Path, err)
+
+	tried := 0
+	for _, alternative := range player.alternatives(song) {
+		if player.shouldStop || player.startExpired() {
+			break
+		}
+
+		tried++
+		provider, alternativeErr := player.tryProviders(alternative, alternative)
+		if alternativeErr == nil {
+			player.EmitEvent(music.EventSongFallback, song, alternative, err)
+			return provider, alternative, nil
+		}
+
+		log.Printf("unable to play alternative %s: %v", alternative.Path, alternativeErr)
+	}
+
+	if tried > 0 {
+		err = fmt.Errorf("%v, %d other sources failed as well", err, tried)
+	}
+
+	return nil, song, err
+}
+
+// tryProviders plays the song on the first provider that manages to, local providers try the
+// prepared version first
+func (player *MusicPlayer) tryProviders(song music.Song, prepared music.Song) (music.Provider, error) {
+	err := errNoProvider
+
+	for _, provider := range player.musicProviders {
+		if player.startExpired() {
+			break
+		}
+
+		if !provider.CanPlay(song) {
+			continue
+		}
+
+		player.activeProvider = provider
+
+		if prepared.Path != song.Path && isLocal(provider) {
+			err = player.playWithRetry(provider, prepared)
+			if err == nil {
+				return provider, nil
+			}
+
+			log.Printf("unable to play the prepared version of %s: %v", song.Path, err)
+		}
+
+		err = player.playWithRetry(provider, song)
+		if err == nil {
+			return provider, nil
+		}
+	}
+
+	return nil, err
+}
+
+// startExpired returns whether starting the song took too long to keep trying
+func (player *MusicPlayer) startExpired() bool {
+	return time.Now().After(player.startDeadline)
+}
+
+// isLocal returns whether the provider plays on the machine of the bot
+func isLocal(provider music.Provider) bool {
+	local, ok := provider.(music.LocalProvider)
+	return ok && local.PlaysLocally()
+}
+
+// playWithRetry plays the song, trying again when the provider returns a temporary error
+func (player *MusicPlayer) playWithRetry(provider music.Provider, song music.Song) error {
+	err := provider.PlaySong(song)
+
+	for attempt := 1; attempt <= startRetries && music.IsTemporary(err) && !player.shouldStop && !player.startExpired(); attempt++ {
+		delay := player.retryDelay * time.Duration(attempt)
+		log.Printf("unable to play %s, trying again in %s: %v", song.Path, delay, err)
+		time.Sleep(delay)
+
+		err = provider.PlaySong(song)
+	}
+
+	return err
+}
+
+// alternatives asks the data provider of the song for other sources of it
+func (player *MusicPlayer) alternatives(song music.Song) []music.Song {
+	for _, dataProvider := range player.dataProviders {
+		alternativeProvider, ok := dataProvider.(music.AlternativeProvider)
+		if !ok || !dataProvider.CanProvideData(song) {
+			continue
+		}
+
+		alternatives, err := alternativeProvider.Alternatives(song)
+		if err != nil {
+			log.Printf("unable to find other sources for %s: %v", song.Path, err)
+		}
+
+		return alternatives
+	}
+
+	return nil
+}
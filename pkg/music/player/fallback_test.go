@@ -0,0 +1,178 @@
+package player
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// fakeProvider fails to play the songs in errors, with the error
+type fakeProvider struct {
+	music.Provider
+	errors map[string][]error
+	played []string
+}
+
+func (provider *fakeProvider) CanPlay(song music.Song) bool {
+	return true
+}
+
+// localProvider plays on the machine of the bot
+type localProvider struct {
+	fakeProvider
+}
+
+func (provider *localProvider) PlaysLocally() bool {
+	return true
+}
+
+func (provider *fakeProvider) PlaySong(song music.Song) error {
+	provider.played = append(provider.played, song.Path)
+
+	errs := provider.errors[song.Path]
+	if len(errs) == 0 {
+		return nil
+	}
+
+	provider.errors[song.Path] = errs[1:]
+	return errs[0]
+}
+
+type fakeDataProvider struct {
+	music.DataProvider
+	alternatives []music.Song
+}
+
+func (provider *fakeDataProvider) CanProvideData(song music.Song) bool {
+	return true
+}
+
+func (provider *fakeDataProvider) Alternatives(song music.Song) ([]music.Song, error) {
+	return provider.alternatives, nil
+}
+
+func newFallbackPlayer(providers []music.Provider, alternatives []music.Song) *MusicPlayer {
+	player := NewMusicPlayer(providers, []music.DataProvider{&fakeDataProvider{alternatives: alternatives}})
+	player.retryDelay = time.Millisecond
+
+	return player
+}
+
+func TestMusicPlayer_StartSongRetry(t *testing.T) {
+	t.Parallel()
+
+	timeout := music.TemporaryError{Err: errors.New("timeout")}
+	provider := &fakeProvider{errors: map[string][]error{"song": {timeout, timeout}}}
+	player := newFallbackPlayer([]music.Provider{provider}, nil)
+
+	active, song, err := player.startSong(music.Song{Path: "song"})
+	assert.NoError(t, err)
+	assert.Equal(t, provider, active)
+	assert.Equal(t, "song", song.Path)
+	assert.Equal(t, []string{"song", "song", "song"}, provider.played)
+}
+
+func TestMusicPlayer_StartSongNextProvider(t *testing.T) {
+	t.Parallel()
+
+	// errors that are not temporary are not retried
+	broken := &fakeProvider{errors: map[string][]error{"song": {errors.New("unsupported")}}}
+	working := &fakeProvider{}
+	player := newFallbackPlayer([]music.Provider{broken, working}, nil)
+
+	active, _, err := player.startSong(music.Song{Path: "song"})
+	assert.NoError(t, err)
+	assert.Equal(t, working, active)
+	assert.Equal(t, []string{"song"}, broken.played)
+}
+
+func TestMusicPlayer_StartSongAlternative(t *testing.T) {
+	t.Parallel()
+
+	unavailable := errors.New("video unavailable")
+	provider := &fakeProvider{errors: map[string][]error{
+		"song":   {unavailable},
+		"mirror": {unavailable},
+	}}
+	player := newFallbackPlayer([]music.Provider{provider}, []music.Song{{Path: "mirror"}, {Path: "reupload"}})
+
+	var fallback []interface{}
+	player.AddListener(music.EventSongFallback, func(arguments ...interface{}) {
+		fallback = arguments
+	})
+
+	_, song, err := player.startSong(music.Song{Path: "song"})
+	assert.NoError(t, err)
+	assert.Equal(t, "reupload", song.Path)
+	assert.Equal(t, []interface{}{music.Song{Path: "song"}, music.Song{Path: "reupload"}, unavailable}, fallback)
+
+	provider.errors["song"] = []error{unavailable}
+	provider.errors["mirror"] = []error{unavailable}
+	provider.errors["reupload"] = []error{unavailable}
+
+	_, _, err = player.startSong(music.Song{Path: "song"})
+	assert.EqualError(t, err, "video unavailable, 2 other sources failed as well")
+}
+
+type fakePreparer struct {
+	prepared map[string]string
+}
+
+func (preparer *fakePreparer) Prepare(songs []music.Song) {}
+
+func (preparer *fakePreparer) Prepared(song music.Song) music.Song {
+	if path, exists := preparer.prepared[song.Path]; exists {
+		song.Path = path
+	}
+
+	return song
+}
+
+func TestMusicPlayer_StartSongPrepared(t *testing.T) {
+	t.Parallel()
+
+	provider := &localProvider{fakeProvider{errors: map[string][]error{"expired": {errors.New("forbidden")}}}}
+	player := newFallbackPlayer([]music.Provider{provider}, nil)
+	player.SetPreparer(&fakePreparer{prepared: map[string]string{"song": "resolved", "other": "expired"}}, 3)
+
+	_, song, err := player.startSong(music.Song{Path: "song"})
+	assert.NoError(t, err)
+	assert.Equal(t, "song", song.Path)
+	assert.Equal(t, []string{"resolved"}, provider.played)
+
+	// the song itself is played when the prepared version fails
+	_, _, err = player.startSong(music.Song{Path: "other"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"resolved", "expired", "other"}, provider.played)
+}
+
+func TestMusicPlayer_StartSongPreparedRemote(t *testing.T) {
+	t.Parallel()
+
+	// files and urls prepared by the bot can't be played on another machine
+	remote := &fakeProvider{}
+	player := newFallbackPlayer([]music.Provider{remote}, nil)
+	player.SetPreparer(&fakePreparer{prepared: map[string]string{"song": "/cache/song"}}, 3)
+
+	_, _, err := player.startSong(music.Song{Path: "song"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"song"}, remote.played)
+}
+
+func TestMusicPlayer_StartSongTimeout(t *testing.T) {
+	t.Parallel()
+
+	timeout := music.TemporaryError{Err: errors.New("timeout")}
+	provider := &fakeProvider{errors: map[string][]error{"song": {timeout, timeout, timeout}}}
+	player := newFallbackPlayer([]music.Provider{provider}, []music.Song{{Path: "mirror"}})
+	player.retryDelay = 20 * time.Millisecond
+	player.startTimeout = 10 * time.Millisecond
+
+	// the song gives up after the deadline instead of trying again and looking for alternatives
+	_, _, err := player.startSong(music.Song{Path: "song"})
+	assert.Equal(t, timeout, err)
+	assert.Equal(t, []string{"song", "song"}, provider.played)
+}
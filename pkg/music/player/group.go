@@ -0,0 +1,191 @@
+package player
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	// syncInterval is how often the followers are compared with the leader
+	syncInterval = 2 * time.Second
+	// drift below syncThreshold can not be heard
+	syncThreshold = 20 * time.Millisecond
+	// drift above seekThreshold is corrected by seeking, smaller drift by changing the speed
+	seekThreshold = 500 * time.Millisecond
+	// maxSpeedCorrection is how much faster or slower a follower may play to catch up
+	maxSpeedCorrection = 0.05
+)
+
+// Group plays the songs of the leader on the followers as well and keeps them in sync. The
+// followers are mirrors of the leader, so they start, pause and skip along with it. Drift is
+// measured periodically and corrected by seeking or by playing a bit faster or slower.
+type Group struct {
+	leader    music.Player
+	lock      sync.Mutex
+	followers []music.Provider
+	stop      chan struct{}
+}
+
+func NewGroup(leader music.Player) *Group {
+	return &Group{
+		leader: leader,
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start keeps the followers in sync until the group is stopped
+func (group *Group) Start() {
+	go func() {
+		ticker := time.NewTicker(syncInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-group.stop:
+				return
+			case <-ticker.C:
+				group.sync()
+			}
+		}
+	}()
+}
+
+// Stop removes all followers and stops syncing
+func (group *Group) Stop() {
+	for _, follower := range group.Followers() {
+		group.Remove(follower)
+	}
+
+	close(group.stop)
+}
+
+// Add lets the follower play along with the leader. When the leader is playing the follower
+// joins the current song.
+func (group *Group) Add(follower music.Provider) {
+	group.lock.Lock()
+	group.followers = append(group.followers, follower)
+	group.lock.Unlock()
+
+	group.leader.AddMirror(follower)
+
+	song, _ := group.leader.GetCurrentSong()
+	if song == nil || !group.leader.GetStatus().CanBeSkipped() {
+		return
+	}
+
+	go func() {
+		if err := follower.PlaySong(*song); err != nil {
+			log.Printf("Group: unable to join %s: %v", song.Path, err)
+			return
+		}
+
+		if group.leader.GetStatus() == music.PlayerStatusPaused {
+			_ = follower.Pause()
+			return
+		}
+
+		_ = follower.Play()
+
+		if song.SongType == music.SongTypeSong {
+			position, _ := group.leader.GetPosition()
+			if err := follower.Seek(position); err != nil {
+				log.Printf("Group: unable to seek to the position of the leader: %v", err)
+			}
+		}
+	}()
+}
+
+// Remove stops the follower from playing along with the leader
+func (group *Group) Remove(follower music.Provider) {
+	group.lock.Lock()
+	for index, existing := range group.followers {
+		if existing == follower {
+			group.followers = append(group.followers[:index], group.followers[index+1:]...)
+			break
+		}
+	}
+	group.lock.Unlock()
+
+	group.leader.RemoveMirror(follower)
+
+	if adjuster, ok := follower.(music.SpeedAdjuster); ok {
+		_ = adjuster.SetSpeed(1)
+	}
+
+	if err := follower.Skip(); err != nil {
+		log.Printf("Group: unable to stop the follower: %v", err)
+	}
+}
+
+// Followers returns the providers that play along with the leader
+func (group *Group) Followers() []music.Provider {
+	group.lock.Lock()
+	defer group.lock.Unlock()
+
+	return append([]music.Provider(nil), group.followers...)
+}
+
+// sync measures the drift of every follower and corrects it
+func (group *Group) sync() {
+	if group.leader.GetStatus() != music.PlayerStatusPlaying {
+		return
+	}
+
+	for _, follower := range group.Followers() {
+		// the leader is measured before and after the follower, as asking takes a while
+		before, _ := group.leader.GetPosition()
+		position, err := follower.Position()
+		after, _ := group.leader.GetPosition()
+
+		if err != nil {
+			continue
+		}
+
+		leaderPosition := (before + after) / 2
+		seek, speed := correction(position - leaderPosition)
+
+		if seek {
+			if err := follower.Seek(leaderPosition); err != nil {
+				log.Printf("Group: unable to seek to the position of the leader: %v", err)
+			}
+		}
+
+		if adjuster, ok := follower.(music.SpeedAdjuster); ok {
+			if err := adjuster.SetSpeed(speed); err != nil {
+				log.Printf("Group: unable to change the speed: %v", err)
+			}
+		}
+	}
+}
+
+// correction returns how to correct a follower that is drift ahead of the leader: by seeking
+// to the position of the leader, or by changing the speed to catch up within one sync interval
+func correction(drift time.Duration) (seek bool, speed float64) {
+	size := drift
+	if size < 0 {
+		size = -size
+	}
+
+	if size >= seekThreshold {
+		return true, 1
+	}
+
+	if size <= syncThreshold {
+		return false, 1
+	}
+
+	speed = 1 - float64(drift)/float64(syncInterval)
+
+	if speed < 1-maxSpeedCorrection {
+		speed = 1 - maxSpeedCorrection
+	}
+
+	if speed > 1+maxSpeedCorrection {
+		speed = 1 + maxSpeedCorrection
+	}
+
+	return false, speed
+}
@@ -0,0 +1,257 @@
+package player
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+func TestCorrection(t *testing.T) {
+	t.Parallel()
+
+	seek, speed := correction(10 * time.Millisecond)
+	assert.False(t, seek)
+	assert.Equal(t, 1.0, speed)
+
+	// ahead of the leader, slow down
+	seek, speed = correction(40 * time.Millisecond)
+	assert.False(t, seek)
+	assert.InDelta(t, 0.98, speed, 0.0001)
+
+	// behind the leader, speed up as much as allowed
+	seek, speed = correction(-200 * time.Millisecond)
+	assert.False(t, seek)
+	assert.InDelta(t, 1.05, speed, 0.0001)
+
+	seek, speed = correction(-2 * time.Second)
+	assert.True(t, seek)
+	assert.Equal(t, 1.0, speed)
+}
+
+// groupLeader is a player at a fixed position, the tests move it along
+type groupLeader struct {
+	music.Player
+
+	lock     sync.Mutex
+	status   music.PlayerStatus
+	song     *music.Song
+	position time.Duration
+	mirrors  []music.Provider
+}
+
+func (leader *groupLeader) GetStatus() music.PlayerStatus {
+	leader.lock.Lock()
+	defer leader.lock.Unlock()
+
+	return leader.status
+}
+
+func (leader *groupLeader) GetCurrentSong() (*music.Song, time.Duration) {
+	return leader.song, 0
+}
+
+func (leader *groupLeader) GetPosition() (time.Duration, time.Duration) {
+	leader.lock.Lock()
+	defer leader.lock.Unlock()
+
+	return leader.position, time.Minute
+}
+
+func (leader *groupLeader) setPosition(position time.Duration) {
+	leader.lock.Lock()
+	defer leader.lock.Unlock()
+
+	leader.position = position
+}
+
+func (leader *groupLeader) AddMirror(provider music.Provider) {
+	leader.mirrors = append(leader.mirrors, provider)
+}
+
+func (leader *groupLeader) RemoveMirror(provider music.Provider) {
+	for index, mirror := range leader.mirrors {
+		if mirror == provider {
+			leader.mirrors = append(leader.mirrors[:index], leader.mirrors[index+1:]...)
+			return
+		}
+	}
+}
+
+// groupFollower reports what it was asked to do on the events channel. PlaySong waits for
+// loaded, to take a while like loading a real song.
+type groupFollower struct {
+	music.Provider
+
+	position time.Duration
+	loaded   chan struct{}
+	events   chan string
+}
+
+func newGroupFollower(position time.Duration) *groupFollower {
+	return &groupFollower{
+		position: position,
+		loaded:   make(chan struct{}),
+		events:   make(chan string, 10),
+	}
+}
+
+func (follower *groupFollower) PlaySong(song music.Song) error {
+	<-follower.loaded
+	follower.events <- "play " + song.Path
+	return nil
+}
+
+func (follower *groupFollower) Play() error {
+	follower.events <- "resume"
+	return nil
+}
+
+func (follower *groupFollower) Pause() error {
+	follower.events <- "pause"
+	return nil
+}
+
+func (follower *groupFollower) Skip() error {
+	follower.events <- "skip"
+	return nil
+}
+
+func (follower *groupFollower) Seek(position time.Duration) error {
+	follower.events <- "seek " + position.String()
+	return nil
+}
+
+func (follower *groupFollower) Position() (time.Duration, error) {
+	return follower.position, nil
+}
+
+// speedFollower can change its speed
+type speedFollower struct {
+	*groupFollower
+}
+
+func (follower speedFollower) SetSpeed(speed float64) error {
+	follower.events <- fmt.Sprintf("speed %.2f", speed)
+	return nil
+}
+
+func expectEvents(t *testing.T, follower *groupFollower, expected ...string) {
+	for _, event := range expected {
+		select {
+		case actual := <-follower.events:
+			assert.Equal(t, event, actual)
+		case <-time.After(time.Second):
+			t.Fatalf("%s did not happen", event)
+		}
+	}
+
+	select {
+	case actual := <-follower.events:
+		t.Fatalf("unexpected %s", actual)
+	default:
+	}
+}
+
+func TestGroup_Add(t *testing.T) {
+	t.Parallel()
+
+	leader := &groupLeader{
+		status:   music.PlayerStatusPlaying,
+		song:     &music.Song{Path: "song.mp3", SongType: music.SongTypeSong},
+		position: 2 * time.Second,
+	}
+	group := NewGroup(leader)
+
+	follower := newGroupFollower(0)
+	group.Add(follower)
+	assert.Equal(t, []music.Provider{follower}, leader.mirrors)
+	assert.Equal(t, []music.Provider{follower}, group.Followers())
+
+	// the follower seeks to where the leader is once the song is loaded, not where it was when
+	// the follower joined
+	leader.setPosition(10 * time.Second)
+	close(follower.loaded)
+	expectEvents(t, follower, "play song.mp3", "resume", "seek 10s")
+}
+
+func TestGroup_AddPaused(t *testing.T) {
+	t.Parallel()
+
+	leader := &groupLeader{
+		status: music.PlayerStatusPaused,
+		song:   &music.Song{Path: "song.mp3", SongType: music.SongTypeSong},
+	}
+	group := NewGroup(leader)
+
+	follower := newGroupFollower(0)
+	close(follower.loaded)
+	group.Add(follower)
+	expectEvents(t, follower, "play song.mp3", "pause")
+
+	// nothing is played when the leader is stopped
+	leader.status = music.PlayerStatusStopped
+	stopped := newGroupFollower(0)
+	group.Add(stopped)
+	time.Sleep(10 * time.Millisecond)
+	expectEvents(t, stopped)
+}
+
+func TestGroup_SyncSeek(t *testing.T) {
+	t.Parallel()
+
+	leader := &groupLeader{status: music.PlayerStatusPlaying, position: 10 * time.Second}
+	group := NewGroup(leader)
+
+	// a follower a second behind seeks, and plays at normal speed again
+	follower := newGroupFollower(9 * time.Second)
+	group.followers = []music.Provider{speedFollower{follower}}
+	group.sync()
+	expectEvents(t, follower, "seek 10s", "speed 1.00")
+
+	// followers are left alone while the leader is paused
+	leader.status = music.PlayerStatusPaused
+	group.sync()
+	expectEvents(t, follower)
+}
+
+func TestGroup_SyncSpeed(t *testing.T) {
+	t.Parallel()
+
+	leader := &groupLeader{status: music.PlayerStatusPlaying, position: 10 * time.Second}
+	group := NewGroup(leader)
+
+	// a follower slightly ahead slows down instead of seeking
+	ahead := newGroupFollower(10*time.Second + 40*time.Millisecond)
+	behind := newGroupFollower(10*time.Second - 200*time.Millisecond)
+	group.followers = []music.Provider{speedFollower{ahead}, speedFollower{behind}}
+	group.sync()
+	expectEvents(t, ahead, "speed 0.98")
+	expectEvents(t, behind, "speed 1.05")
+
+	// a follower that can't change its speed only seeks when the drift is large
+	plain := newGroupFollower(10*time.Second + 40*time.Millisecond)
+	group.followers = []music.Provider{plain}
+	group.sync()
+	expectEvents(t, plain)
+}
+
+func TestGroup_Remove(t *testing.T) {
+	t.Parallel()
+
+	leader := &groupLeader{status: music.PlayerStatusStopped}
+	group := NewGroup(leader)
+
+	follower := speedFollower{newGroupFollower(0)}
+	group.Add(follower)
+	assert.Len(t, leader.mirrors, 1)
+
+	// the follower plays at normal speed again and stops playing the song of the leader
+	group.Remove(follower)
+	assert.Empty(t, group.Followers())
+	assert.Empty(t, leader.mirrors)
+	expectEvents(t, follower.groupFollower, "speed 1.00", "skip")
+}
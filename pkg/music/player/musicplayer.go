@@ -3,6 +3,7 @@ package player
 import (
 	"fmt"
 	"log"
+	"sync"
 
 	"github.com/svenwiltink/go-musicbot/pkg/music"
 
@@ -15,16 +16,51 @@ import (
 // MusicPlayer is responsible for playing music
 type MusicPlayer struct {
 	*eventemitter.Emitter
-	Queue           *music.Queue
-	Status          music.PlayerStatus
-	dataProviders   []music.DataProvider
-	musicProviders  []music.Provider
-	activeProvider  music.Provider
-	currentSong     *music.Song
-	shouldStop      bool
-	currentSongEnds time.Time
+	Queue          *music.Queue
+	Status         music.PlayerStatus
+	dataProviders  []music.DataProvider
+	musicProviders []music.Provider
+	// mirrors play the same songs as the active provider, like a stream of the music
+	mirrors        []music.Provider
+	mirrorLock     sync.Mutex
+	activeProvider music.Provider
+	currentSong    *music.Song
+	shouldStop     bool
+	repeatMode     music.RepeatMode
+	// skipped is set when the current song was skipped instead of played until the end
+	skipped bool
+	// fadeOut is the time it takes to fade out a song when it is skipped
+	fadeOut time.Duration
+	// fading is set while a skipped song fades out
+	fadeLock sync.Mutex
+	fading   bool
+	// retryDelay is the time before trying to play a song again after a temporary error
+	retryDelay time.Duration
+	// startTimeout is how long starting a song may take, including retries and alternatives.
+	// startDeadline is when the song that is being started has to give up.
+	startTimeout  time.Duration
+	startDeadline time.Time
+	// fallbackPosition is used when the active provider cannot report its position
+	fallbackPosition positionTracker
+	policy           music.Policy
+	// preparer prepares the next prepareAhead songs of the queue
+	preparer     music.Preparer
+	prepareAhead int
+	// stopAfter stops the player after the current song, resume continues with the next one
+	stopAfter bool
+	resume    chan struct{}
+	// stopped is closed when the player is stopped
+	stopped  chan struct{}
+	stopOnce sync.Once
+
+	sleepLock  sync.Mutex
+	sleepTimer *time.Timer
+	sleepAt    time.Time
 }
 
+// sleepFadeOut is the time it takes to fade out when the sleep timer ends
+const sleepFadeOut = 10 * time.Second
+
 func (player *MusicPlayer) GetQueue() *music.Queue {
 	return player.Queue
 }
@@ -38,6 +74,8 @@ func (player *MusicPlayer) Pause() error {
 
 	if err == nil {
 		player.Status = music.PlayerStatusPaused
+		player.fallbackPosition.pause()
+		player.updateMirrors("pause", music.Provider.Pause)
 	}
 
 	return err
@@ -45,6 +83,12 @@ func (player *MusicPlayer) Pause() error {
 }
 
 func (player *MusicPlayer) Play() error {
+	if player.Status == music.PlayerStatusStopped {
+		player.Status = music.PlayerStatusWaiting
+		player.resume <- struct{}{}
+		return nil
+	}
+
 	if player.Status != music.PlayerStatusPaused {
 		return errors.New("cannot resume, music is not paused")
 	}
@@ -53,34 +97,382 @@ func (player *MusicPlayer) Play() error {
 
 	if err == nil {
 		player.Status = music.PlayerStatusPlaying
+		player.fallbackPosition.resume()
+		player.updateMirrors("resume", music.Provider.Play)
 	}
 
 	return err
 }
 
+// Seek to an absolute position in the current song
+func (player *MusicPlayer) Seek(position time.Duration) error {
+	err := player.checkSeekable()
+	if err != nil {
+		return err
+	}
+
+	_, duration := player.GetPosition()
+	if position < 0 || position > duration {
+		return fmt.Errorf("position must be between 0s and %s", duration)
+	}
+
+	err = player.activeProvider.Seek(position)
+	if err != nil {
+		return err
+	}
+
+	player.fallbackPosition.seek(position)
+	player.updateMirrors("seek", func(mirror music.Provider) error {
+		return mirror.Seek(position)
+	})
+
+	return nil
+}
+
+// SeekRelative seeks forwards or backwards from the current position
+func (player *MusicPlayer) SeekRelative(offset time.Duration) error {
+	err := player.checkSeekable()
+	if err != nil {
+		return err
+	}
+
+	// never seek before the start of the song
+	position, _ := player.GetPosition()
+	if position+offset < 0 {
+		offset = -position
+	}
+
+	err = player.activeProvider.SeekRelative(offset)
+	if err != nil {
+		return err
+	}
+
+	player.fallbackPosition.seek(position + offset)
+
+	// mirrors seek to the same position, so they don't drift apart
+	player.updateMirrors("seek", func(mirror music.Provider) error {
+		return mirror.Seek(position + offset)
+	})
+
+	return nil
+}
+
+func (player *MusicPlayer) checkSeekable() error {
+	if !player.Status.CanBeSkipped() || player.currentSong == nil {
+		return errors.New("nothing is playing")
+	}
+
+	if player.currentSong.SongType != music.SongTypeSong {
+		return errors.New("cannot seek in a livestream")
+	}
+
+	return nil
+}
+
+func (player *MusicPlayer) SetRepeatMode(mode music.RepeatMode) error {
+	if !mode.IsValid() {
+		return fmt.Errorf("invalid repeat mode %s", mode)
+	}
+
+	player.repeatMode = mode
+	player.prefetchNext()
+	return nil
+}
+
+// SetFadeOut sets the time it takes to fade out a song when it is skipped. Zero disables fading
+func (player *MusicPlayer) SetFadeOut(duration time.Duration) {
+	player.fadeOut = duration
+}
+
+// SetNormalization enables or disables loudness normalisation for the providers that support it
+func (player *MusicPlayer) SetNormalization(enabled bool) error {
+	supported := false
+
+	for _, provider := range player.musicProviders {
+		normalizer, ok := provider.(music.Normalizer)
+		if !ok {
+			continue
+		}
+
+		supported = true
+		if err := normalizer.SetNormalization(enabled); err != nil {
+			return err
+		}
+	}
+
+	if !supported {
+		return errors.New("none of the music providers support normalisation")
+	}
+
+	return nil
+}
+
+// GetAudioDevices lists the audio outputs of the first provider that can switch between them
+func (player *MusicPlayer) GetAudioDevices() ([]music.AudioDevice, error) {
+	for _, provider := range player.musicProviders {
+		if selector, ok := provider.(music.DeviceSelector); ok {
+			return selector.AudioDevices()
+		}
+	}
+
+	return nil, errors.New("none of the music providers support audio devices")
+}
+
+// SetAudioDevice switches the audio output of the first provider that can switch between them
+func (player *MusicPlayer) SetAudioDevice(name string) error {
+	for _, provider := range player.musicProviders {
+		if selector, ok := provider.(music.DeviceSelector); ok {
+			return selector.SetAudioDevice(name)
+		}
+	}
+
+	return errors.New("none of the music providers support audio devices")
+}
+
+// GetNormalization returns whether any of the providers normalises the loudness
+func (player *MusicPlayer) GetNormalization() bool {
+	for _, provider := range player.musicProviders {
+		if normalizer, ok := provider.(music.Normalizer); ok && normalizer.GetNormalization() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// AddMirror adds a provider that plays the same songs as the active provider, and is paused,
+// resumed and skipped along with it
+func (player *MusicPlayer) AddMirror(provider music.Provider) {
+	player.mirrorLock.Lock()
+	defer player.mirrorLock.Unlock()
+
+	player.mirrors = append(player.mirrors, provider)
+}
+
+// RemoveMirror stops mirroring the songs to the provider
+func (player *MusicPlayer) RemoveMirror(provider music.Provider) {
+	player.mirrorLock.Lock()
+	defer player.mirrorLock.Unlock()
+
+	for index, mirror := range player.mirrors {
+		if mirror == provider {
+			player.mirrors = append(player.mirrors[:index], player.mirrors[index+1:]...)
+			return
+		}
+	}
+}
+
+func (player *MusicPlayer) getMirrors() []music.Provider {
+	player.mirrorLock.Lock()
+	defer player.mirrorLock.Unlock()
+
+	return append([]music.Provider(nil), player.mirrors...)
+}
+
+// updateMirrors applies the action to every mirror, a mirror failing does not affect the others
+func (player *MusicPlayer) updateMirrors(name string, action func(provider music.Provider) error) {
+	for _, mirror := range player.getMirrors() {
+		if err := action(mirror); err != nil {
+			log.Printf("unable to %s mirror: %v", name, err)
+		}
+	}
+}
+
+// SetPreparer prepares the next songs of the queue before they are played, nil disables it
+func (player *MusicPlayer) SetPreparer(preparer music.Preparer, ahead int) {
+	player.preparer = preparer
+	player.prepareAhead = ahead
+}
+
+// prepared returns the prepared version of the song
+func (player *MusicPlayer) prepared(song music.Song) music.Song {
+	if player.preparer == nil {
+		return song
+	}
+
+	return player.preparer.Prepared(song)
+}
+
+// prepareNext prepares the songs that will be played next
+func (player *MusicPlayer) prepareNext() {
+	if player.preparer == nil {
+		return
+	}
+
+	songs, _ := player.Queue.GetNextN(player.prepareAhead)
+	player.preparer.Prepare(songs)
+}
+
+// SetPolicy restricts the volume and adding songs, nil removes all restrictions
+func (player *MusicPlayer) SetPolicy(policy music.Policy) {
+	player.policy = policy
+}
+
+// maxVolume returns the highest volume the policy allows
+func (player *MusicPlayer) maxVolume() int {
+	if player.policy == nil {
+		return 100
+	}
+
+	return player.policy.MaxVolume()
+}
+
+func (player *MusicPlayer) canAdd() error {
+	if player.policy == nil {
+		return nil
+	}
+
+	return player.policy.CanAdd()
+}
+
+// SetStopAfter stops the player after the current song. The queue is kept, Play continues with
+// the next song.
+func (player *MusicPlayer) SetStopAfter(enabled bool) error {
+	if enabled && !player.Status.CanBeSkipped() {
+		return errors.New("nothing is playing")
+	}
+
+	player.stopAfter = enabled
+	player.prefetchNext()
+
+	return nil
+}
+
+func (player *MusicPlayer) GetStopAfter() bool {
+	return player.stopAfter
+}
+
+// Sleep fades out and pauses the player after the duration. A duration of 0 cancels the timer.
+func (player *MusicPlayer) Sleep(duration time.Duration) {
+	player.sleepLock.Lock()
+	defer player.sleepLock.Unlock()
+
+	if player.sleepTimer != nil {
+		player.sleepTimer.Stop()
+		player.sleepTimer = nil
+	}
+
+	if duration <= 0 {
+		return
+	}
+
+	player.sleepAt = time.Now().Add(duration)
+	player.sleepTimer = time.AfterFunc(duration, player.fallAsleep)
+}
+
+// GetSleepTimer returns the time until the sleep timer ends, if it is running
+func (player *MusicPlayer) GetSleepTimer() (time.Duration, bool) {
+	player.sleepLock.Lock()
+	defer player.sleepLock.Unlock()
+
+	if player.sleepTimer == nil {
+		return 0, false
+	}
+
+	return time.Until(player.sleepAt), true
+}
+
+func (player *MusicPlayer) fallAsleep() {
+	player.sleepLock.Lock()
+	player.sleepTimer = nil
+	player.sleepLock.Unlock()
+
+	if player.Status != music.PlayerStatusPlaying {
+		return
+	}
+
+	provider := player.activeProvider
+	volume, volumeErr := provider.GetVolume()
+	if volumeErr == nil {
+		player.fade(provider, volume, 0, sleepFadeOut)
+	}
+
+	if err := player.Pause(); err != nil {
+		log.Printf("unable to pause for the sleep timer: %v", err)
+	}
+
+	// playback continues at the original volume
+	if volumeErr == nil {
+		if err := provider.SetVolume(volume); err != nil {
+			log.Printf("unable to restore the volume after fading: %v", err)
+		}
+	}
+
+	player.EmitEvent(music.EventSleepTimerEnded)
+}
+
+func (player *MusicPlayer) GetRepeatMode() music.RepeatMode {
+	return player.repeatMode
+}
+
 func (player *MusicPlayer) GetStatus() music.PlayerStatus {
 	return player.Status
 }
 
 func (player *MusicPlayer) GetCurrentSong() (*music.Song, time.Duration) {
-	if player.currentSong != nil {
-		return player.currentSong, time.Until(player.currentSongEnds).Round(time.Second)
+	song := player.currentSong
+	if song == nil {
+		return nil, time.Duration(0)
+	}
+
+	position, duration := player.GetPosition()
+
+	remaining := duration - position
+	if remaining < 0 {
+		remaining = 0
 	}
 
-	return nil, time.Duration(0)
+	return song, remaining.Round(time.Second)
+}
+
+// GetPosition asks the active provider for the position and duration of the current song. The
+// wall clock and the duration provided by the data provider are used when it cannot tell.
+func (player *MusicPlayer) GetPosition() (position time.Duration, duration time.Duration) {
+	song := player.currentSong
+	if song == nil {
+		return 0, 0
+	}
+
+	position = player.fallbackPosition.Position()
+	duration = song.Duration
+
+	provider := player.activeProvider
+	if provider == nil || !player.Status.CanBeSkipped() {
+		return position, duration
+	}
+
+	if providerPosition, err := provider.Position(); err == nil {
+		position = providerPosition
+	}
+
+	if providerDuration, err := provider.Duration(); err == nil && providerDuration > 0 {
+		duration = providerDuration
+	}
+
+	return position, duration
 }
 
 func (player *MusicPlayer) SetVolume(percentage int) error {
+	if maxVolume := player.maxVolume(); percentage > maxVolume {
+		return fmt.Errorf("the volume is capped at %d right now", maxVolume)
+	}
+
 	for _, provider := range player.musicProviders {
 		if err := provider.SetVolume(percentage); err != nil {
 			return err
 		}
 	}
 
+	player.updateMirrors("set the volume of", func(mirror music.Provider) error {
+		return mirror.SetVolume(percentage)
+	})
+
 	return nil
 }
 
 func (player *MusicPlayer) IncreaseVolume(percentage int) (newVolume int, err error) {
+	maxVolume := player.maxVolume()
+
 	for _, provider := range player.musicProviders {
 		newVolume, err = provider.GetVolume()
 		if err != nil {
@@ -93,6 +485,11 @@ func (player *MusicPlayer) IncreaseVolume(percentage int) (newVolume int, err er
 			newVolume = 100
 		}
 
+		// lowering the volume is always allowed, even when it stays above the cap
+		if percentage > 0 && newVolume > maxVolume {
+			return 0, fmt.Errorf("the volume is capped at %d right now", maxVolume)
+		}
+
 		if newVolume < 0 {
 			newVolume = 0
 		}
@@ -103,6 +500,10 @@ func (player *MusicPlayer) IncreaseVolume(percentage int) (newVolume int, err er
 		}
 	}
 
+	player.updateMirrors("set the volume of", func(mirror music.Provider) error {
+		return mirror.SetVolume(newVolume)
+	})
+
 	return newVolume, nil
 }
 
@@ -137,6 +538,10 @@ func (player *MusicPlayer) Search(searchString string) ([]music.Song, error) {
 
 // AddSong tries to add the song to the Queue
 func (player *MusicPlayer) AddSong(song music.Song) (music.Song, error) {
+	if err := player.canAdd(); err != nil {
+		return song, err
+	}
+
 	// assume it is a song unless the dataprovider changes it to a stream
 	song.SongType = music.SongTypeSong
 
@@ -187,34 +592,135 @@ func (player *MusicPlayer) getSuitablePlayer(song music.Song) music.Provider {
 // Start the MusicPlayer
 func (player *MusicPlayer) Start() {
 	log.Println("Starting music player")
+	player.Queue.AddListener(music.EventQueueChanged, func(arguments ...interface{}) {
+		player.prefetchNext()
+	})
+
+	for _, provider := range player.musicProviders {
+		supervised, ok := provider.(music.Supervised)
+		if !ok {
+			continue
+		}
+
+		supervised.OnRestart(func(err error) {
+			player.EmitEvent(music.EventProviderCrashed, err)
+		}, func(song *music.Song, resumed bool) {
+			player.EmitEvent(music.EventProviderRestarted, song, resumed)
+			// the provider forgot the prefetched song
+			player.prefetchNext()
+		})
+	}
 	go player.playLoop()
 }
 
+// prefetchNext tells the active provider which song comes next so it can continue without a gap
+func (player *MusicPlayer) prefetchNext() {
+	player.prepareNext()
+
+	provider := player.activeProvider
+	if provider == nil || !player.Status.CanBeSkipped() {
+		return
+	}
+
+	var next *music.Song
+	if player.stopAfter {
+		// the next song should not start by itself
+		next = nil
+	} else if player.repeatMode == music.RepeatModeOne && !player.skipped {
+		next = player.currentSong
+	} else if songs, _ := player.Queue.GetNextN(1); len(songs) > 0 {
+		next = &songs[0]
+	}
+
+	// transitions between providers can not be gapless
+	if next != nil && player.getSuitablePlayer(*next) != provider {
+		next = nil
+	}
+
+	// local providers start the song with the prepared version, which should match
+	if next != nil && isLocal(provider) {
+		prepared := player.prepared(*next)
+		next = &prepared
+	}
+
+	if err := provider.Prefetch(next); err != nil {
+		log.Printf("unable to prefetch the next song: %v", err)
+	}
+}
+
 func (player *MusicPlayer) playLoop() {
 	for !player.shouldStop {
 		player.Status = music.PlayerStatusWaiting
 		log.Println("Waiting for song")
-		song := player.Queue.WaitForNext()
-		player.currentSong = &song
-
-		provider := player.getSuitablePlayer(song)
-		player.activeProvider = provider
+		queued := player.Queue.WaitForNext()
+		player.currentSong = &queued
 
 		player.Status = music.PlayerStatusLoading
-		err := provider.PlaySong(song)
+		player.fallbackPosition.reset()
+		provider, song, err := player.startSong(queued)
 
 		if err != nil {
 			log.Println(err)
-			player.EmitEvent(music.EventSongStartError, song, err)
+			player.EmitEvent(music.EventSongStartError, queued, err)
 			continue
 		}
 
-		player.currentSongEnds = time.Now().Add(song.Duration)
+		player.activeProvider = provider
+		player.currentSong = &song
+
+		for _, mirror := range player.getMirrors() {
+			go func(mirror music.Provider) {
+				if err := mirror.PlaySong(song); err != nil {
+					log.Printf("unable to play %s on mirror: %v", song.Path, err)
+					return
+				}
+
+				if err := mirror.Play(); err != nil {
+					log.Printf("unable to resume mirror: %v", err)
+				}
+			}(mirror)
+		}
+
+		player.skipped = false
+		player.fallbackPosition.start()
 		player.EmitEvent(music.EventSongStarted, song)
 		player.Status = music.PlayerStatusPlaying
+		player.prefetchNext()
 		provider.Wait()
 
 		log.Println("Song ended")
+		// an alternative source might not work for long, repeat the song itself
+		player.repeat(queued)
+
+		if player.stopAfter {
+			player.hold()
+		}
+	}
+}
+
+// hold keeps the player stopped until Play is called or the player is stopped, the queue is left
+// untouched
+func (player *MusicPlayer) hold() {
+	log.Println("Stopped after the song, waiting for play")
+	player.stopAfter = false
+	player.currentSong = nil
+	player.Status = music.PlayerStatusStopped
+
+	select {
+	case <-player.resume:
+	case <-player.stopped:
+	}
+}
+
+// repeat puts the song that just ended back in the queue according to the repeat mode
+func (player *MusicPlayer) repeat(song music.Song) {
+	switch player.repeatMode {
+	case music.RepeatModeOne:
+		if !player.skipped {
+			player.Queue.Prepend(song)
+		}
+	case music.RepeatModeAll:
+		player.Queue.Append(song)
 	}
 }
 
@@ -225,27 +731,112 @@ func (player *MusicPlayer) Next() error {
 		return fmt.Errorf("nothing is playing")
 	}
 
-	err := player.activeProvider.Skip()
+	player.skipped = true
+	player.prefetchNext()
+
+	provider := player.activeProvider
+
+	if player.fadeOut > 0 && player.Status == music.PlayerStatusPlaying {
+		volume, err := provider.GetVolume()
+		if err == nil {
+			// the song is already being skipped
+			if !player.startFade() {
+				return nil
+			}
+
+			// fading takes a while, the command that skipped should not wait for it
+			go func() {
+				defer player.endFade()
+
+				player.fade(provider, volume, 0, player.fadeOut)
+
+				if err := player.skip(provider); err != nil {
+					log.Printf("unable to skip after fading: %v", err)
+				}
+
+				// the next song should start at the original volume
+				if err := provider.SetVolume(volume); err != nil {
+					log.Printf("unable to restore the volume after fading: %v", err)
+				}
+			}()
+
+			return nil
+		}
+	}
+
+	return player.skip(provider)
+}
+
+// skip skips the current song of the provider and the mirrors
+func (player *MusicPlayer) skip(provider music.Provider) error {
+	err := provider.Skip()
 	if err != nil {
 		return err
 	}
 
+	player.updateMirrors("skip", music.Provider.Skip)
+
 	if player.Status == music.PlayerStatusPaused {
-		err = player.activeProvider.Play()
-		return err
+		return provider.Play()
 	}
 
 	return nil
 }
 
+// startFade marks the current song as fading out, it returns false when it already is
+func (player *MusicPlayer) startFade() bool {
+	player.fadeLock.Lock()
+	defer player.fadeLock.Unlock()
+
+	if player.fading {
+		return false
+	}
+
+	player.fading = true
+	return true
+}
+
+func (player *MusicPlayer) endFade() {
+	player.fadeLock.Lock()
+	defer player.fadeLock.Unlock()
+
+	player.fading = false
+}
+
+// fade changes the volume in steps during the given time
+func (player *MusicPlayer) fade(provider music.Provider, from int, to int, duration time.Duration) {
+	const steps = 10
+
+	for step := 1; step <= steps; step++ {
+		time.Sleep(duration / steps)
+
+		if err := provider.SetVolume(from + (to-from)*step/steps); err != nil {
+			log.Printf("unable to fade: %v", err)
+			return
+		}
+	}
+}
+
 func (player *MusicPlayer) Stop() {
 	player.shouldStop = true
+	player.stopOnce.Do(func() {
+		close(player.stopped)
+	})
+
 	for _, provider := range player.musicProviders {
 		provider.Stop()
 	}
+
+	for _, mirror := range player.getMirrors() {
+		mirror.Stop()
+	}
 }
 
 func (player *MusicPlayer) AddPlaylist(playlistUrl string) (*music.Playlist, error) {
+	if err := player.canAdd(); err != nil {
+		return nil, err
+	}
+
 	playlist := music.Playlist{}
 
 	for _, provider := range player.dataProviders {
@@ -280,6 +871,11 @@ func NewMusicPlayer(providers []music.Provider, dataProviders []music.DataProvid
 		musicProviders: providers,
 		dataProviders:  dataProviders,
 		shouldStop:     false,
+		repeatMode:     music.RepeatModeOff,
+		resume:         make(chan struct{}, 1),
+		stopped:        make(chan struct{}),
+		retryDelay:     startRetryDelay,
+		startTimeout:   startSongTimeout,
 	}
 
 	return instance
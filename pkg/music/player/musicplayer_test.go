@@ -0,0 +1,153 @@
+package player
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+type volumeProvider struct {
+	music.Provider
+	volume int
+}
+
+func (provider *volumeProvider) GetVolume() (int, error) { return provider.volume, nil }
+
+func (provider *volumeProvider) SetVolume(percentage int) error {
+	provider.volume = percentage
+	return nil
+}
+
+type capPolicy struct {
+	maxVolume int
+}
+
+func (policy capPolicy) MaxVolume() int { return policy.maxVolume }
+func (policy capPolicy) CanAdd() error  { return nil }
+
+func TestMusicPlayer_VolumeCapped(t *testing.T) {
+	t.Parallel()
+
+	provider := &volumeProvider{volume: 95}
+	player := NewMusicPlayer([]music.Provider{provider}, nil)
+
+	// without a policy the volume stops at 100
+	volume, err := player.IncreaseVolume(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 100, volume)
+
+	player.SetPolicy(capPolicy{maxVolume: 20})
+
+	assert.Error(t, player.SetVolume(30))
+	assert.Equal(t, 100, provider.volume)
+
+	// lowering is allowed while the volume is above the cap
+	volume, err = player.DecreaseVolume(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 90, volume)
+
+	assert.NoError(t, player.SetVolume(15))
+
+	_, err = player.IncreaseVolume(10)
+	assert.EqualError(t, err, "the volume is capped at 20 right now")
+	assert.Equal(t, 15, provider.volume)
+
+	volume, err = player.IncreaseVolume(5)
+	assert.NoError(t, err)
+	assert.Equal(t, 20, volume)
+}
+
+// fadingProvider records the volumes it was set to and when it was skipped
+type fadingProvider struct {
+	music.Provider
+
+	lock    sync.Mutex
+	volume  int
+	volumes []int
+	skipped chan int
+}
+
+func (provider *fadingProvider) GetVolume() (int, error) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	return provider.volume, nil
+}
+
+func (provider *fadingProvider) SetVolume(percentage int) error {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.volume = percentage
+	provider.volumes = append(provider.volumes, percentage)
+	return nil
+}
+
+func (provider *fadingProvider) Prefetch(song *music.Song) error {
+	return nil
+}
+
+func (provider *fadingProvider) CanPlay(song music.Song) bool {
+	return true
+}
+
+func (provider *fadingProvider) Skip() error {
+	volume, _ := provider.GetVolume()
+	provider.skipped <- volume
+	return nil
+}
+
+func TestMusicPlayer_NextFades(t *testing.T) {
+	t.Parallel()
+
+	provider := &fadingProvider{volume: 50, skipped: make(chan int, 2)}
+	player := NewMusicPlayer([]music.Provider{provider}, nil)
+	player.SetFadeOut(100 * time.Millisecond)
+	player.activeProvider = provider
+	player.Status = music.PlayerStatusPlaying
+
+	// the fade does not hold up the command
+	started := time.Now()
+	assert.NoError(t, player.Next())
+	assert.NoError(t, player.Next())
+	assert.Less(t, int64(time.Since(started)), int64(50*time.Millisecond))
+
+	// the song is skipped once it is silent
+	select {
+	case volume := <-provider.skipped:
+		assert.Equal(t, 0, volume)
+	case <-time.After(time.Second):
+		t.Fatal("the song was not skipped")
+	}
+
+	assert.Eventually(t, func() bool {
+		volume, _ := provider.GetVolume()
+		return volume == 50
+	}, time.Second, 10*time.Millisecond)
+
+	// skipping during the fade did not skip another song
+	assert.Empty(t, provider.skipped)
+}
+
+func TestMusicPlayer_HoldStops(t *testing.T) {
+	t.Parallel()
+
+	player := NewMusicPlayer(nil, nil)
+
+	held := make(chan struct{})
+	go func() {
+		player.hold()
+		close(held)
+	}()
+
+	player.Stop()
+
+	select {
+	case <-held:
+	case <-time.After(time.Second):
+		t.Fatal("the player kept waiting for play after it was stopped")
+	}
+}
@@ -0,0 +1,71 @@
+package player
+
+import (
+	"sync"
+	"time"
+)
+
+// positionTracker keeps track of the playback position using the wall clock. It is the fallback
+// for providers that are unable to report their position.
+type positionTracker struct {
+	lock     sync.Mutex
+	position time.Duration
+	// since is the moment position was last updated. It is zero while paused
+	since time.Time
+}
+
+func (tracker *positionTracker) start() {
+	tracker.reset()
+	tracker.resume()
+}
+
+// reset sets the position to the start of a song that is not playing yet
+func (tracker *positionTracker) reset() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.position = 0
+	tracker.since = time.Time{}
+}
+
+func (tracker *positionTracker) pause() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.position = tracker.get()
+	tracker.since = time.Time{}
+}
+
+func (tracker *positionTracker) resume() {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	if tracker.since.IsZero() {
+		tracker.since = time.Now()
+	}
+}
+
+func (tracker *positionTracker) seek(position time.Duration) {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	tracker.position = position
+	if !tracker.since.IsZero() {
+		tracker.since = time.Now()
+	}
+}
+
+func (tracker *positionTracker) Position() time.Duration {
+	tracker.lock.Lock()
+	defer tracker.lock.Unlock()
+
+	return tracker.get()
+}
+
+func (tracker *positionTracker) get() time.Duration {
+	if tracker.since.IsZero() {
+		return tracker.position
+	}
+
+	return tracker.position + time.Since(tracker.since)
+}
@@ -0,0 +1,36 @@
+package player
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositionTracker_Pause(t *testing.T) {
+	t.Parallel()
+
+	tracker := &positionTracker{}
+	tracker.start()
+	tracker.since = tracker.since.Add(-time.Minute)
+
+	tracker.pause()
+	position := tracker.Position()
+	assert.InDelta(t, time.Minute, position, float64(time.Second))
+
+	time.Sleep(10 * time.Millisecond)
+	assert.Equal(t, position, tracker.Position())
+}
+
+func TestPositionTracker_Seek(t *testing.T) {
+	t.Parallel()
+
+	tracker := &positionTracker{}
+	tracker.pause()
+	tracker.seek(90 * time.Second)
+
+	assert.Equal(t, 90*time.Second, tracker.Position())
+
+	tracker.resume()
+	assert.GreaterOrEqual(t, tracker.Position(), 90*time.Second)
+}
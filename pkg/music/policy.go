@@ -0,0 +1,9 @@
+package music
+
+// Policy restricts what the Player is allowed to do, like capping the volume during certain hours
+type Policy interface {
+	// MaxVolume returns the highest volume that is allowed right now
+	MaxVolume() int
+	// CanAdd returns an error when songs can not be added right now
+	CanAdd() error
+}
@@ -0,0 +1,244 @@
+package prefetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+	"github.com/svenwiltink/go-musicbot/pkg/music/cache"
+)
+
+const (
+	// urlLifetime is how long a resolved url is used, the urls of youtube expire after a few hours
+	urlLifetime     = time.Hour
+	resolveTimeout  = 30 * time.Second
+	downloadTimeout = 10 * time.Minute
+	// pendingBuffer is the amount of songs waiting to be prepared, more are prepared later
+	pendingBuffer = 32
+	// failureBackoff is how long a song that could not be prepared is left alone
+	failureBackoff = 10 * time.Minute
+	ytdlpFormat    = "bestaudio/best"
+)
+
+// Config configures the prefetcher
+type Config struct {
+	// Cache is where the audio is downloaded to. Without a cache only the urls of the audio are
+	// resolved, as are the urls of songs that can not be cached.
+	Cache *cache.Cache
+}
+
+// entry is a song that is prepared or being prepared
+type entry struct {
+	path     string
+	ready    bool
+	failed   bool
+	prepared time.Time
+}
+
+// Prefetcher prepares songs with yt-dlp before they are played, so mpv does not have to resolve
+// them when they start. It either resolves the url of the audio or downloads the audio to the
+// cache, where it is kept for repeat plays.
+type Prefetcher struct {
+	config  Config
+	lock    sync.Mutex
+	entries map[string]*entry
+	pending chan music.Song
+}
+
+func New(config Config) *Prefetcher {
+	return &Prefetcher{
+		config:  config,
+		entries: make(map[string]*entry),
+		pending: make(chan music.Song, pendingBuffer),
+	}
+}
+
+// Start prepares the songs in the background, one at a time
+func (prefetcher *Prefetcher) Start() {
+	go func() {
+		for song := range prefetcher.pending {
+			prefetcher.prepare(song)
+		}
+	}()
+}
+
+// canPrepare returns whether yt-dlp should be used for the song. Streams never end so they
+// can not be downloaded, and files don't need to be prepared. The prepared audio always starts
+// at the beginning, so songs that start somewhere in the middle are played as they are.
+func canPrepare(song music.Song) bool {
+	return song.SongType != music.SongTypeStream &&
+		(strings.HasPrefix(song.Path, "http://") || strings.HasPrefix(song.Path, "https://")) &&
+		!hasStartOffset(song.Path)
+}
+
+// hasStartOffset returns whether the url starts the song after the beginning, like the t
+// parameter of youtube
+func hasStartOffset(path string) bool {
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return false
+	}
+
+	fragment, _ := url.ParseQuery(parsed.Fragment)
+
+	for _, values := range []url.Values{parsed.Query(), fragment} {
+		for _, key := range []string{"t", "start"} {
+			value := strings.TrimSuffix(values.Get(key), "s")
+			if value != "" && value != "0" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (prefetcher *Prefetcher) Prepare(songs []music.Song) {
+	prefetcher.lock.Lock()
+	defer prefetcher.lock.Unlock()
+
+	for _, song := range songs {
+		if !canPrepare(song) {
+			continue
+		}
+
+		if existing, exists := prefetcher.entries[song.Path]; exists && !prefetcher.expired(existing) {
+			continue
+		}
+
+		select {
+		case prefetcher.pending <- song:
+			prefetcher.entries[song.Path] = &entry{}
+		default:
+			// the songs are prepared again when the queue changes
+			return
+		}
+	}
+}
+
+func (prefetcher *Prefetcher) Prepared(song music.Song) music.Song {
+	if !canPrepare(song) {
+		return song
+	}
+
+	prefetcher.lock.Lock()
+	existing, exists := prefetcher.entries[song.Path]
+	prefetcher.lock.Unlock()
+
+	if exists && existing.ready && !prefetcher.expired(existing) {
+		song.Path = existing.path
+		return song
+	}
+
+	// the song might not have been prepared yet, while it was downloaded before
+	if prefetcher.config.Cache != nil && !exists {
+		if file, cached := prefetcher.config.Cache.Audio(song); cached {
+			song.Path = file
+		}
+	}
+
+	return song
+}
+
+// expired returns whether the entry should be prepared again. The lock must be held.
+func (prefetcher *Prefetcher) expired(existing *entry) bool {
+	switch {
+	case existing.failed:
+		return time.Since(existing.prepared) > failureBackoff
+	case !existing.ready:
+		return false
+	case strings.HasPrefix(existing.path, "http://") || strings.HasPrefix(existing.path, "https://"):
+		return time.Since(existing.prepared) > urlLifetime
+	default:
+		// the audio might have been removed from the cache
+		_, err := os.Stat(existing.path)
+		return err != nil
+	}
+}
+
+func (prefetcher *Prefetcher) prepare(song music.Song) {
+	var path string
+	var err error
+
+	if prefetcher.canCache(song) {
+		path, err = prefetcher.download(song)
+	} else {
+		path, err = resolve(song)
+	}
+
+	prefetcher.lock.Lock()
+	prefetcher.entries[song.Path] = &entry{
+		path:     path,
+		ready:    err == nil,
+		failed:   err != nil,
+		prepared: time.Now(),
+	}
+	prefetcher.lock.Unlock()
+
+	if err != nil {
+		log.Printf("Prefetch: unable to prepare %s: %v", song.Path, err)
+	}
+}
+
+// canCache returns whether the audio of the song can be downloaded to the cache
+func (prefetcher *Prefetcher) canCache(song music.Song) bool {
+	if prefetcher.config.Cache == nil {
+		return false
+	}
+
+	_, ok := prefetcher.config.Cache.Key(song)
+	return ok
+}
+
+// resolve asks yt-dlp for the url of the audio of the song
+func resolve(song music.Song) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "yt-dlp", "--no-playlist", "--format", ytdlpFormat, "--get-url", song.Path).Output()
+	if err != nil {
+		return "", fmt.Errorf("yt-dlp failed: %v", err)
+	}
+
+	url := strings.TrimSpace(strings.SplitN(string(output), "\n", 2)[0])
+	if url == "" {
+		return "", errors.New("yt-dlp did not return a url")
+	}
+
+	return url, nil
+}
+
+// download downloads the audio of the song to the cache with yt-dlp, unless it is cached already
+func (prefetcher *Prefetcher) download(song music.Song) (string, error) {
+	if file, cached := prefetcher.config.Cache.Audio(song); cached {
+		return file, nil
+	}
+
+	return prefetcher.config.Cache.Store(song, func(file string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+		defer cancel()
+
+		// yt-dlp downloads to a .part file first, so a file that exists is complete
+		output, err := exec.CommandContext(ctx, "yt-dlp", "--no-playlist", "--format", ytdlpFormat, "--force-overwrites", "--output", file, song.Path).CombinedOutput()
+		if err != nil {
+			_ = os.Remove(file + ".part")
+			return fmt.Errorf("yt-dlp failed: %v: %s", err, lastLine(output))
+		}
+
+		return nil
+	})
+}
+
+// lastLine returns the last line of the output of a command, which usually holds the error
+func lastLine(output []byte) string {
+	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+	return lines[len(lines)-1]
+}
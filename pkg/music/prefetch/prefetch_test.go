@@ -0,0 +1,58 @@
+package prefetch
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+	"github.com/svenwiltink/go-musicbot/pkg/music/cache"
+)
+
+type fakeIdentifier struct{}
+
+func (fakeIdentifier) Identify(song music.Song) (music.SongKey, bool) {
+	return music.SongKey{Provider: "fake", Identifier: song.Path}, true
+}
+
+func TestPrefetcher_Prepared(t *testing.T) {
+	t.Parallel()
+
+	audioCache, err := cache.Open(cache.Config{Directory: t.TempDir()}, []music.Identifier{fakeIdentifier{}})
+	assert.NoError(t, err)
+
+	prefetcher := New(Config{Cache: audioCache})
+
+	song := music.Song{Name: "song", Path: "https://www.youtube.com/watch?v=abc"}
+	assert.Equal(t, song, prefetcher.Prepared(song))
+
+	// audio downloaded earlier is reused
+	file, err := audioCache.Store(song, func(file string) error {
+		return os.WriteFile(file, []byte("audio"), 0644)
+	})
+	assert.NoError(t, err)
+
+	prepared := prefetcher.Prepared(song)
+	assert.Equal(t, file, prepared.Path)
+	assert.Equal(t, "song", prepared.Name)
+
+	// streams and local files are played as they are
+	stream := music.Song{Path: "https://stream.example.com/live", SongType: music.SongTypeStream}
+	assert.Equal(t, stream, prefetcher.Prepared(stream))
+	assert.Equal(t, music.Song{Path: "/music/song.mp3"}, prefetcher.Prepared(music.Song{Path: "/music/song.mp3"}))
+
+	// the downloaded audio would start at the beginning instead of at the start time
+	later := music.Song{Name: "song", Path: "https://www.youtube.com/watch?v=abc&t=90"}
+	assert.Equal(t, later, prefetcher.Prepared(later))
+}
+
+func TestHasStartOffset(t *testing.T) {
+	t.Parallel()
+
+	assert.True(t, hasStartOffset("https://www.youtube.com/watch?v=abc&t=90"))
+	assert.True(t, hasStartOffset("https://youtu.be/abc?t=1m30s"))
+	assert.True(t, hasStartOffset("https://example.com/song.mp3#t=30"))
+	assert.False(t, hasStartOffset("https://www.youtube.com/watch?v=abc&t=0"))
+	assert.False(t, hasStartOffset("https://www.youtube.com/watch?v=abc&t=0s"))
+	assert.False(t, hasStartOffset("https://www.youtube.com/watch?v=abc"))
+}
@@ -0,0 +1,10 @@
+package music
+
+// Preparer prepares the songs in the queue before they are played, like resolving the url of
+// the audio, so they start faster
+type Preparer interface {
+	// Prepare prepares the songs in the background, the first one is needed first
+	Prepare(songs []Song)
+	// Prepared returns the prepared version of the song, or the song itself when it is not ready
+	Prepared(song Song) Song
+}
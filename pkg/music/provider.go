@@ -1,17 +1,69 @@
 package music
 
+import "time"
+
 // Provider is the interface for an implementation that can actually play songs
 type Provider interface {
 	CanPlay(song Song) bool
 	SetVolume(percentage int) error
 	GetVolume() (int, error)
 	PlaySong(song Song) error
+	// Prefetch prepares the song that will be played after the current one, so the transition
+	// is gapless. Calling PlaySong with that song afterwards continues with the prefetched song.
+	// A nil song clears the prefetched song.
+	Prefetch(song *Song) error
 	Play() error
 	Pause() error
 	Skip() error
+	// Seek to an absolute position in the current song
+	Seek(position time.Duration) error
+	// SeekRelative seeks forwards or backwards from the current position
+	SeekRelative(offset time.Duration) error
+	// Position returns the playback position in the current song
+	Position() (time.Duration, error)
+	// Duration returns the duration of the current song as reported by the provider
+	Duration() (time.Duration, error)
 	// wait for the current song to end
 	Wait()
 
 	// stop the player.
 	Stop()
 }
+
+// Supervised is implemented by providers that restart themselves when they crash
+type Supervised interface {
+	// OnRestart registers the functions that are called when the provider crashed and when it is
+	// running again. resumed tells whether the song that was playing could be resumed.
+	OnRestart(crashed func(err error), restarted func(song *Song, resumed bool))
+}
+
+// LocalProvider is implemented by providers that play on the machine of the bot. Only they are
+// given the prepared version of a song, which can be a file in the cache of the bot.
+type LocalProvider interface {
+	PlaysLocally() bool
+}
+
+// AudioDevice is an audio output a provider can play on
+type AudioDevice struct {
+	Name        string
+	Description string
+	Active      bool
+}
+
+// DeviceSelector is implemented by providers that can switch between audio outputs
+type DeviceSelector interface {
+	AudioDevices() ([]AudioDevice, error)
+	SetAudioDevice(name string) error
+}
+
+// SpeedAdjuster is implemented by providers that can change the playback speed, which is used
+// to keep several providers in sync
+type SpeedAdjuster interface {
+	SetSpeed(speed float64) error
+}
+
+// Normalizer is implemented by providers that can normalise the loudness of songs
+type Normalizer interface {
+	SetNormalization(enabled bool) error
+	GetNormalization() bool
+}
@@ -0,0 +1,163 @@
+package mpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	dialTimeout    = 5 * time.Second
+	commandTimeout = 10 * time.Second
+)
+
+// attribute is a line of a response, like "volume: 50"
+type attribute struct {
+	key   string
+	value string
+}
+
+// response is the list of attributes returned by a command, in order
+type response []attribute
+
+// get returns the value of the first attribute with the key
+func (response response) get(key string) string {
+	for _, attribute := range response {
+		if attribute.key == key {
+			return attribute.value
+		}
+	}
+
+	return ""
+}
+
+// values returns the values of all attributes with the key
+func (response response) values(key string) []string {
+	values := make([]string, 0)
+	for _, attribute := range response {
+		if attribute.key == key {
+			values = append(values, attribute.value)
+		}
+	}
+
+	return values
+}
+
+// ackError is returned when MPD refused the command, the connection can still be used
+type ackError struct {
+	message string
+}
+
+func (err ackError) Error() string {
+	return "mpd: " + err.message
+}
+
+// writeError is returned when the command could not be sent, so MPD did not run it
+type writeError struct {
+	err error
+}
+
+func (err writeError) Error() string {
+	return err.err.Error()
+}
+
+// client is a connection to MPD using its text protocol. Commands are a line with the
+// arguments quoted, the response is a list of "key: value" lines ending with OK or ACK.
+type client struct {
+	connection net.Conn
+	reader     *bufio.Reader
+}
+
+func dial(address string, password string) (*client, error) {
+	connection, err := net.DialTimeout("tcp", address, dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := &client{
+		connection: connection,
+		reader:     bufio.NewReader(connection),
+	}
+
+	_ = connection.SetReadDeadline(time.Now().Add(commandTimeout))
+	greeting, err := instance.reader.ReadString('\n')
+	if err != nil {
+		_ = connection.Close()
+		return nil, fmt.Errorf("unable to read the greeting: %v", err)
+	}
+
+	if !strings.HasPrefix(greeting, "OK MPD ") {
+		_ = connection.Close()
+		return nil, fmt.Errorf("%s is not an MPD server", address)
+	}
+
+	if password != "" {
+		if _, err := instance.command("password", password); err != nil {
+			_ = connection.Close()
+			return nil, err
+		}
+	}
+
+	return instance, nil
+}
+
+// command runs the command and returns its response
+func (client *client) command(name string, arguments ...string) (response, error) {
+	return client.commandTimeout(commandTimeout, name, arguments...)
+}
+
+// commandTimeout runs the command, a timeout of 0 waits forever which is used for idle
+func (client *client) commandTimeout(timeout time.Duration, name string, arguments ...string) (response, error) {
+	line := name
+	for _, argument := range arguments {
+		line += " " + quote(argument)
+	}
+
+	deadline := time.Time{}
+	if timeout > 0 {
+		deadline = time.Now().Add(timeout)
+	}
+	_ = client.connection.SetDeadline(deadline)
+
+	if _, err := client.connection.Write([]byte(line + "\n")); err != nil {
+		return nil, writeError{err: err}
+	}
+
+	result := make(response, 0)
+	for {
+		text, err := client.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		text = strings.TrimSuffix(text, "\n")
+
+		if text == "OK" {
+			return result, nil
+		}
+
+		if strings.HasPrefix(text, "ACK ") {
+			return nil, ackError{message: strings.TrimPrefix(text, "ACK ")}
+		}
+
+		parts := strings.SplitN(text, ": ", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unexpected line from mpd %q", text)
+		}
+
+		result = append(result, attribute{key: parts[0], value: parts[1]})
+	}
+}
+
+func (client *client) close() {
+	_ = client.connection.Close()
+}
+
+// quote quotes an argument, escaping quotes and backslashes
+func quote(argument string) string {
+	argument = strings.ReplaceAll(argument, `\`, `\\`)
+	argument = strings.ReplaceAll(argument, `"`, `\"`)
+	return `"` + argument + `"`
+}
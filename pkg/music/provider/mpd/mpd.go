@@ -0,0 +1,442 @@
+package mpd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	stateStop = "stop"
+	// reconnectDelay is how long Wait waits before watching the song again when MPD is gone
+	reconnectDelay = time.Second
+	// idleCheck is how long the connection may be unused before it is checked with a ping
+	idleCheck = 10 * time.Second
+	// startTimeout is how long PlaySong waits for MPD to start playing, a song that is still
+	// loading after that is assumed to be fine
+	startTimeout  = 2 * time.Second
+	startInterval = 100 * time.Millisecond
+)
+
+// pageHosts serve pages that need youtube-dl to find the audio, MPD can't play them even though
+// it has a handler for https
+var pageHosts = []string{"youtube.com", "youtu.be", "soundcloud.com"}
+
+// readOnlyCommands can safely run again when the connection failed before their response
+// arrived, MPD might have run the others already
+var readOnlyCommands = map[string]bool{
+	"ping":        true,
+	"status":      true,
+	"currentsong": true,
+	"urlhandlers": true,
+}
+
+// Player plays songs on an existing MPD server, which can also feed Snapcast. MPD plays files
+// from its music directory and the urls of its url handlers, like http streams. Pages that
+// need youtube-dl, like youtube videos, can not be played.
+type Player struct {
+	address  string
+	password string
+
+	lock       sync.Mutex
+	connection *client
+	// lastCommand is when the connection was last used
+	lastCommand time.Time
+	handlers    []string
+	// songID is the id of the song started by PlaySong in the queue of MPD
+	songID string
+	// watcher is the connection Wait uses to idle until the song ends
+	watcher  *client
+	stopping bool
+}
+
+// NewPlayer creates a player for the MPD server at the address, like localhost:6600
+func NewPlayer(address string, password string) *Player {
+	return &Player{
+		address:  address,
+		password: password,
+	}
+}
+
+// Start connects to MPD and asks which urls it can play
+func (player *Player) Start() error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	response, err := player.command("urlhandlers")
+	if err != nil {
+		return fmt.Errorf("unable to connect to mpd at %s: %v", player.address, err)
+	}
+
+	player.handlers = response.values("handler")
+
+	return nil
+}
+
+// command runs the command, reconnecting once when the connection was closed. MPD closes
+// connections that have been quiet for a while. Commands that change MPD are only sent again
+// when they could not be sent at all. The lock must be held.
+func (player *Player) command(name string, arguments ...string) (response, error) {
+	readOnly := readOnlyCommands[name]
+
+	// a ping finds out whether MPD closed the connection before the command is sent
+	if !readOnly && player.connection != nil && time.Since(player.lastCommand) > idleCheck {
+		if _, err := player.command("ping"); err != nil {
+			return nil, err
+		}
+	}
+
+	if player.connection != nil {
+		response, err := player.connection.command(name, arguments...)
+		if err == nil || isMpdError(err) {
+			player.lastCommand = time.Now()
+			return response, err
+		}
+
+		player.connection.close()
+		player.connection = nil
+
+		var notSent writeError
+		if !readOnly && !errors.As(err, &notSent) {
+			return nil, music.TemporaryError{Err: fmt.Errorf("the connection to mpd failed during %s: %v", name, err)}
+		}
+	}
+
+	connection, err := dial(player.address, player.password)
+	if err != nil && !isMpdError(err) {
+		return nil, music.TemporaryError{Err: err}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	player.connection = connection
+
+	response, err := connection.command(name, arguments...)
+	if err == nil || isMpdError(err) {
+		player.lastCommand = time.Now()
+	}
+
+	return response, err
+}
+
+func (player *Player) status() (response, error) {
+	return player.command("status")
+}
+
+// CanPlay returns whether MPD has a handler for the url of the song. Paths without a scheme
+// are files in the music directory of MPD.
+func (player *Player) CanPlay(song music.Song) bool {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if !strings.Contains(song.Path, "://") {
+		return true
+	}
+
+	if isPage(song.Path) {
+		return false
+	}
+
+	for _, handler := range player.handlers {
+		if strings.HasPrefix(song.Path, handler) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (player *Player) PlaySong(song music.Song) error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	if _, err := player.command("clear"); err != nil {
+		return err
+	}
+
+	// the error of a previous song would be taken for an error of this one
+	if _, err := player.command("clearerror"); err != nil {
+		return err
+	}
+
+	response, err := player.command("addid", song.Path)
+	if err != nil {
+		return err
+	}
+
+	songID := response.get("Id")
+	if _, err := player.command("playid", songID); err != nil {
+		return err
+	}
+
+	if err := player.waitForStart(songID); err != nil {
+		return err
+	}
+
+	player.songID = songID
+
+	return nil
+}
+
+// waitForStart returns an error when MPD fails to play the song. MPD accepts any url it has a
+// handler for and only finds out whether it can be played after playid. The lock must be held.
+func (player *Player) waitForStart(songID string) error {
+	deadline := time.Now().Add(startTimeout)
+
+	for {
+		status, err := player.status()
+		if err != nil {
+			return err
+		}
+
+		if message := status.get("error"); message != "" {
+			return fmt.Errorf("mpd is unable to play the song: %s", message)
+		}
+
+		if status.get("state") == stateStop || status.get("songid") != songID {
+			return errors.New("mpd stopped the song right away")
+		}
+
+		// the song is playing once time passes, streams might still be buffering
+		if elapsed, err := strconv.ParseFloat(status.get("elapsed"), 64); err == nil && elapsed > 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil
+		}
+
+		time.Sleep(startInterval)
+	}
+}
+
+// Prefetch does nothing, MPD only gets the song when it should start
+func (player *Player) Prefetch(song *music.Song) error {
+	return nil
+}
+
+func (player *Player) Play() error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	_, err := player.command("pause", "0")
+	return err
+}
+
+func (player *Player) Pause() error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	_, err := player.command("pause", "1")
+	return err
+}
+
+// Skip stops the song, which ends Wait
+func (player *Player) Skip() error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	_, err := player.command("stop")
+	return err
+}
+
+func (player *Player) Seek(position time.Duration) error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	_, err := player.command("seekcur", formatSeconds(position))
+	return err
+}
+
+func (player *Player) SeekRelative(offset time.Duration) error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	argument := formatSeconds(offset)
+	if offset >= 0 {
+		argument = "+" + argument
+	}
+
+	_, err := player.command("seekcur", argument)
+	return err
+}
+
+func (player *Player) Position() (time.Duration, error) {
+	return player.statusDuration("elapsed")
+}
+
+func (player *Player) Duration() (time.Duration, error) {
+	return player.statusDuration("duration")
+}
+
+// statusDuration returns a duration in seconds from the status, like elapsed
+func (player *Player) statusDuration(key string) (time.Duration, error) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	status, err := player.status()
+	if err != nil {
+		return 0, err
+	}
+
+	value := status.get(key)
+	if value == "" {
+		return 0, fmt.Errorf("mpd does not know the %s", key)
+	}
+
+	seconds, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %s: %v", key, value, err)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func (player *Player) GetVolume() (int, error) {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	status, err := player.status()
+	if err != nil {
+		return 0, err
+	}
+
+	volume, err := strconv.Atoi(status.get("volume"))
+	if err != nil || volume < 0 {
+		return 0, errors.New("mpd has no volume control")
+	}
+
+	return volume, nil
+}
+
+func (player *Player) SetVolume(percentage int) error {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	_, err := player.command("setvol", strconv.Itoa(percentage))
+	return err
+}
+
+// Wait waits until the song started by PlaySong ends, by idling on a connection of its own
+// until MPD stopped or moved on to another song
+func (player *Player) Wait() {
+	player.lock.Lock()
+	songID := player.songID
+	player.lock.Unlock()
+
+	if songID == "" {
+		return
+	}
+
+	for {
+		player.lock.Lock()
+		if player.stopping {
+			player.lock.Unlock()
+			return
+		}
+
+		watcher := player.watcher
+		player.lock.Unlock()
+
+		if watcher == nil {
+			var err error
+			watcher, err = dial(player.address, player.password)
+			if err != nil {
+				log.Printf("Mpd: unable to watch the song, trying again: %v", err)
+				time.Sleep(reconnectDelay)
+				continue
+			}
+
+			player.lock.Lock()
+			player.watcher = watcher
+			player.lock.Unlock()
+		}
+
+		ended, err := player.watch(watcher, songID)
+		if err == nil && ended {
+			return
+		}
+
+		if err != nil {
+			player.lock.Lock()
+			if player.watcher == watcher {
+				player.watcher = nil
+			}
+			player.lock.Unlock()
+
+			watcher.close()
+		}
+	}
+}
+
+// watch returns whether the song ended, or waits until something changed in the player of MPD
+func (player *Player) watch(watcher *client, songID string) (bool, error) {
+	status, err := watcher.command("status")
+	if err != nil {
+		return false, err
+	}
+
+	if status.get("state") == stateStop || status.get("songid") != songID {
+		return true, nil
+	}
+
+	_, err = watcher.commandTimeout(0, "idle", "player")
+	return false, err
+}
+
+func (player *Player) Stop() {
+	player.lock.Lock()
+	defer player.lock.Unlock()
+
+	player.stopping = true
+
+	if _, err := player.command("stop"); err != nil {
+		log.Printf("Mpd: unable to stop: %v", err)
+	}
+
+	if player.connection != nil {
+		player.connection.close()
+	}
+
+	if player.watcher != nil {
+		player.watcher.close()
+	}
+}
+
+// isPage returns whether the url is a page that needs youtube-dl
+func isPage(path string) bool {
+	parsed, err := url.Parse(path)
+	if err != nil {
+		return false
+	}
+
+	host := strings.ToLower(parsed.Hostname())
+	for _, pageHost := range pageHosts {
+		if host == pageHost || strings.HasSuffix(host, "."+pageHost) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isMpdError returns whether MPD refused the command. On any other error the connection
+// failed or is out of sync, and must not be used anymore.
+func isMpdError(err error) bool {
+	var refused ackError
+	return errors.As(err, &refused)
+}
+
+// formatSeconds formats the duration as seconds with milliseconds, like 12.345
+func formatSeconds(duration time.Duration) string {
+	return strconv.FormatFloat(duration.Seconds(), 'f', 3, 64)
+}
@@ -0,0 +1,323 @@
+package mpd
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// fakeServer speaks enough of the MPD protocol to test the player
+type fakeServer struct {
+	listener net.Listener
+	password string
+
+	lock     sync.Mutex
+	state    string
+	songID   int
+	uri      string
+	volume   int
+	elapsed  string
+	commands []string
+	// drop closes the connection after running the command, without responding
+	drop map[string]bool
+	// garbage is sent after the response of the command, like a confused server would
+	garbage map[string]string
+	// errors are the urls mpd fails to decode, with the error it reports
+	errors map[string]string
+	err    string
+	// changed is closed when the player changes, which ends idle
+	changed chan struct{}
+}
+
+func startFakeServer(t *testing.T, password string) *fakeServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	server := &fakeServer{
+		listener: listener,
+		password: password,
+		state:    "stop",
+		volume:   50,
+		elapsed:  "0.000",
+		changed:  make(chan struct{}),
+		drop:     make(map[string]bool),
+		garbage:  make(map[string]string),
+		errors:   make(map[string]string),
+	}
+
+	go func() {
+		for {
+			connection, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go server.serve(connection)
+		}
+	}()
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	return server
+}
+
+func (server *fakeServer) address() string {
+	return server.listener.Addr().String()
+}
+
+// setState changes the state of the player and wakes up the idle clients
+func (server *fakeServer) setState(state string) {
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	server.state = state
+	close(server.changed)
+	server.changed = make(chan struct{})
+}
+
+func (server *fakeServer) serve(connection net.Conn) {
+	defer connection.Close()
+
+	reader := bufio.NewReader(connection)
+	fmt.Fprint(connection, "OK MPD 0.23.5\n")
+
+	authorized := server.password == ""
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		command := fields[0]
+		argument := ""
+		if len(fields) == 2 {
+			argument = strings.Trim(fields[1], `"`)
+		}
+
+		if command == "password" {
+			authorized = argument == server.password
+			if !authorized {
+				fmt.Fprint(connection, "ACK [3@0] {password} incorrect password\n")
+				continue
+			}
+
+			fmt.Fprint(connection, "OK\n")
+			continue
+		}
+
+		if !authorized {
+			fmt.Fprintf(connection, "ACK [4@0] {%s} you don't have permission\n", command)
+			continue
+		}
+
+		server.lock.Lock()
+		server.commands = append(server.commands, command)
+		changed := server.changed
+		response := ""
+
+		switch command {
+		case "urlhandlers":
+			response = "handler: http://\nhandler: https://\n"
+		case "status":
+			response = fmt.Sprintf("volume: %d\nstate: %s\nsongid: %d\nelapsed: %s\nduration: 180.000\n", server.volume, server.state, server.songID, server.elapsed)
+			if server.err != "" {
+				response += "error: " + server.err + "\n"
+			}
+		case "clearerror":
+			server.err = ""
+		case "clear":
+			server.uri = ""
+		case "addid":
+			server.songID++
+			server.uri = argument
+			response = fmt.Sprintf("Id: %d\n", server.songID)
+		case "playid":
+			server.state = "play"
+			server.elapsed = "0.500"
+			if message, exists := server.errors[server.uri]; exists {
+				server.state = "stop"
+				server.elapsed = "0.000"
+				server.err = message
+			}
+		case "pause":
+			server.state = map[string]string{"0": "play", "1": "pause"}[argument]
+		case "stop":
+			server.state = "stop"
+		case "setvol":
+			fmt.Sscanf(argument, "%d", &server.volume)
+		case "seekcur":
+			server.elapsed = argument
+		}
+		dropped := server.drop[command]
+		delete(server.drop, command)
+		garbage := server.garbage[command]
+		delete(server.garbage, command)
+		server.lock.Unlock()
+
+		if dropped {
+			return
+		}
+
+		if command == "idle" {
+			<-changed
+			response = "changed: player\n"
+		}
+
+		fmt.Fprint(connection, garbage+response+"OK\n")
+	}
+}
+
+func TestPlayer(t *testing.T) {
+	t.Parallel()
+
+	server := startFakeServer(t, "secret")
+	player := NewPlayer(server.address(), "secret")
+	assert.NoError(t, player.Start())
+
+	assert.True(t, player.CanPlay(music.Song{Path: "https://radio.example.com/stream"}))
+	assert.True(t, player.CanPlay(music.Song{Path: "albums/song.flac"}))
+	assert.False(t, player.CanPlay(music.Song{Path: "spotify://track"}))
+	assert.False(t, player.CanPlay(music.Song{Path: "https://www.youtube.com/watch?v=abc"}))
+	assert.False(t, player.CanPlay(music.Song{Path: "https://youtu.be/abc"}))
+	assert.False(t, player.CanPlay(music.Song{Path: "https://soundcloud.com/artist/song"}))
+
+	assert.NoError(t, player.PlaySong(music.Song{Path: "https://radio.example.com/stream"}))
+	assert.Equal(t, "https://radio.example.com/stream", server.uri)
+	assert.Equal(t, "play", server.state)
+
+	assert.NoError(t, player.SetVolume(30))
+	volume, err := player.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 30, volume)
+
+	assert.NoError(t, player.Seek(90*time.Second))
+	position, err := player.Position()
+	assert.NoError(t, err)
+	assert.Equal(t, 90*time.Second, position)
+
+	assert.NoError(t, player.SeekRelative(-5*time.Second))
+	assert.Equal(t, "-5.000", server.elapsed)
+
+	waited := make(chan struct{})
+	go func() {
+		player.Wait()
+		close(waited)
+	}()
+
+	// pausing does not end the song
+	assert.NoError(t, player.Pause())
+	server.setState("pause")
+
+	select {
+	case <-waited:
+		t.Fatal("Wait returned before the song ended")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	server.setState("stop")
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the song ended")
+	}
+
+	player.Stop()
+}
+
+func TestPlayer_ConnectionLost(t *testing.T) {
+	t.Parallel()
+
+	server := startFakeServer(t, "")
+	player := NewPlayer(server.address(), "")
+	assert.NoError(t, player.Start())
+
+	// a status is asked again on a new connection
+	server.lock.Lock()
+	server.drop["status"] = true
+	server.lock.Unlock()
+
+	_, err := player.GetVolume()
+	assert.NoError(t, err)
+
+	// MPD added the song, so it must not be added twice
+	server.lock.Lock()
+	server.drop["addid"] = true
+	server.lock.Unlock()
+
+	err = player.PlaySong(music.Song{Path: "https://radio.example.com/stream"})
+	assert.True(t, music.IsTemporary(err))
+
+	server.lock.Lock()
+	defer server.lock.Unlock()
+
+	added := 0
+	for _, command := range server.commands {
+		if command == "addid" {
+			added++
+		}
+	}
+	assert.Equal(t, 1, added)
+}
+
+func TestPlayer_PlaySongFails(t *testing.T) {
+	t.Parallel()
+
+	server := startFakeServer(t, "")
+	player := NewPlayer(server.address(), "")
+	assert.NoError(t, player.Start())
+
+	server.lock.Lock()
+	server.errors["https://example.com/broken"] = "Failed to decode https://example.com/broken"
+	server.lock.Unlock()
+
+	err := player.PlaySong(music.Song{Path: "https://example.com/broken"})
+	assert.EqualError(t, err, "mpd is unable to play the song: Failed to decode https://example.com/broken")
+
+	// the error is cleared for the next song
+	assert.NoError(t, player.PlaySong(music.Song{Path: "https://example.com/song"}))
+}
+
+func TestPlayer_OutOfSync(t *testing.T) {
+	t.Parallel()
+
+	server := startFakeServer(t, "")
+	player := NewPlayer(server.address(), "")
+	assert.NoError(t, player.Start())
+
+	server.lock.Lock()
+	server.garbage["setvol"] = "nonsense\nOK\n"
+	server.lock.Unlock()
+
+	// the rest of the response must not be read as the response of the next command
+	assert.Error(t, player.SetVolume(30))
+
+	volume, err := player.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 30, volume)
+}
+
+func TestPlayer_Password(t *testing.T) {
+	t.Parallel()
+
+	server := startFakeServer(t, "secret")
+	player := NewPlayer(server.address(), "wrong")
+	assert.Error(t, player.Start())
+}
+
+func TestQuote(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, `"say \"hi\" C:\\music"`, quote(`say "hi" C:\music`))
+}
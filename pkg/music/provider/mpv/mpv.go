@@ -1,6 +1,7 @@
 package mpv
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -19,12 +20,18 @@ import (
 const (
 	mpvRetryAttempts  = 5
 	mpvMaxLoadTimeout = time.Duration(time.Second * 30)
+	// mpvCallTimeout is how long to wait for an answer from mpv. mpvipc never answers calls that
+	// were sent just before the connection was lost.
+	mpvCallTimeout = 5 * time.Second
+	DefaultVolume  = 50
 )
 
 // MPV events
 const (
 	EventFileLoaded eventemitter.EventType = "file-loaded"
 	EventFileEnded  eventemitter.EventType = "end-file"
+	// eventSkipped ends Wait when a song can not be resumed after a crash
+	eventSkipped eventemitter.EventType = "musicbot-skipped"
 )
 
 // Player control MPV
@@ -34,18 +41,51 @@ type Player struct {
 	connection   *mpvipc.Connection
 	eventEmitter *eventemitter.Emitter
 	isRunning    bool
+	// prefetched is the song appended to the mpv playlist after the current one, prefetchedEntry
+	// is the id of its entry in the playlist
+	prefetched      *music.Song
+	prefetchedEntry float64
+
+	options Options
+	// audioDevice is the device selected at runtime, it is kept when mpv is restarted
+	audioDevice string
+
+	normalize       bool
+	normalizeFilter string
+	replayGain      string
+
+	// the state that is restored when mpv is restarted after a crash
+	volume   int
+	paused   bool
+	current  *music.Song
+	position time.Duration
+
+	// generation is increased every time mpv is (re)started, so signals from a previous
+	// process or connection can be recognised
+	generation int
+	crashes    chan crash
+	stopping   bool
+	onCrash    func(err error)
+	onRestart  func(song *music.Song, resumed bool)
 
 	mpvPath    string
 	socketPath string
+	// execCommand creates the mpv process, tests replace it with a fake mpv
+	execCommand func(name string, arguments ...string) *exec.Cmd
 }
 
 // NewPlayer creates an instance of MpvPlayer
 func NewPlayer(mpvPath string, socketPath string) *Player {
 	return &Player{
-		mpvPath:      mpvPath,
-		socketPath:   socketPath,
-		isRunning:    false,
-		eventEmitter: eventemitter.NewEmitter(true),
+		mpvPath:         mpvPath,
+		socketPath:      socketPath,
+		isRunning:       false,
+		eventEmitter:    eventemitter.NewEmitter(true),
+		normalizeFilter: DefaultNormalizeFilter,
+		replayGain:      DefaultReplayGain,
+		volume:          DefaultVolume,
+		crashes:         make(chan crash, crashBuffer),
+		execCommand:     exec.Command,
 	}
 }
 
@@ -53,13 +93,14 @@ func (player *Player) GetVolume() (int, error) {
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
 
-	data, err := player.connection.Call("get_property", "volume")
+	data, err := player.call("get_property", "volume")
 
 	if err != nil {
 		return 0, err
 	}
 
 	floatVol := data.(float64)
+	player.volume = int(floatVol)
 
 	return int(floatVol), nil
 }
@@ -68,15 +109,73 @@ func (player *Player) SetVolume(percentage int) error {
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
 
-	_, err := player.connection.Call("set_property", "volume", percentage)
+	_, err := player.call("set_property", "volume", percentage)
+	if err == nil {
+		player.volume = percentage
+	}
+
 	return err
 }
 
-// Start the mpv player
+// call calls a command on mpv, giving up when mpv does not answer in time. The mutex must be held.
+func (player *Player) call(arguments ...interface{}) (interface{}, error) {
+	return callMpv(player.connection, arguments...)
+}
+
+// callMpv calls a command on the connection, giving up when mpv does not answer in time
+func callMpv(connection *mpvipc.Connection, arguments ...interface{}) (interface{}, error) {
+	type result struct {
+		data interface{}
+		err  error
+	}
+
+	results := make(chan result, 1)
+
+	go func() {
+		data, err := connection.Call(arguments...)
+		results <- result{data: data, err: err}
+	}()
+
+	select {
+	case result := <-results:
+		return result.data, result.err
+	case <-time.After(mpvCallTimeout):
+		return nil, music.TemporaryError{Err: fmt.Errorf("mpv did not answer %v within %s", arguments[0], mpvCallTimeout)}
+	}
+}
+
+// Start the mpv player. It is restarted automatically when it crashes.
 func (player *Player) Start() error {
+	player.eventEmitter.AddCapturer(func(eventName eventemitter.EventType, arguments ...interface{}) {
+		if len(eventName) == 0 {
+			return
+		}
+
+		var strArgs []string
+		for _, arg := range arguments {
+			strArgs = append(strArgs, fmt.Sprintf("%#v", arg))
+		}
+		log.Printf("MpvControl.mpvEvent [%s] %s", eventName, strings.Join(strArgs, " | "))
+	})
+
+	err := player.launch()
+	if err != nil {
+		return err
+	}
+
+	go player.supervise()
+
+	return nil
+}
+
+// launch starts the mpv process and connects to it
+func (player *Player) launch() error {
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
 
+	player.generation++
+	player.prefetched = nil
+
 	err := player.removeExistingFile()
 	if err != nil {
 		log.Printf("Mpv: Error starting mpv [%s] %v", player.mpvPath, err)
@@ -96,6 +195,13 @@ func (player *Player) Start() error {
 
 	player.startEventListeners()
 
+	if player.normalize {
+		err = player.applyNormalization(true)
+		if err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -136,40 +242,202 @@ func (player *Player) waitForMpv() error {
 }
 
 func (player *Player) startEventListeners() {
-	player.eventEmitter.AddCapturer(func(eventName eventemitter.EventType, arguments ...interface{}) {
-		if len(eventName) == 0 {
-			return
-		}
-
-		var strArgs []string
-		for _, arg := range arguments {
-			strArgs = append(strArgs, fmt.Sprintf("%#v", arg))
-		}
-		log.Printf("MpvControl.mpvEvent [%s] %s", eventName, strings.Join(strArgs, " | "))
-	})
+	connection := player.connection
+	generation := player.generation
+	events, stopListening := connection.NewEventListener()
 
 	go func() {
-		events, stopListening := player.connection.NewEventListener()
 		for event := range events {
 			player.eventEmitter.EmitEvent(eventemitter.EventType(event.Name), event)
 		}
+	}()
+
+	go func() {
+		connection.WaitUntilClosed()
 		stopListening <- struct{}{}
+		player.crashed(generation, errors.New("lost the ipc connection to mpv"))
 	}()
 }
 
-// Skip the current song
+// Skip the current song. If a song has been prefetched mpv continues with that one
 func (player *Player) Skip() error {
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
 
-	_, err := player.connection.Call("stop")
+	if player.prefetched != nil {
+		_, err := player.call("playlist-next", "force")
+		return err
+	}
+
+	_, err := player.call("stop")
 
 	return err
 }
 
+// Prefetch appends the song to the mpv playlist so mpv continues with it without a gap
+func (player *Player) Prefetch(song *music.Song) error {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	if song != nil && player.prefetched != nil && *song == *player.prefetched {
+		return nil
+	}
+
+	if player.prefetched != nil {
+		// removes everything but the current song from the playlist
+		_, err := player.call("playlist-clear")
+		if err != nil {
+			return err
+		}
+
+		player.prefetched = nil
+	}
+
+	if song == nil {
+		return nil
+	}
+
+	_, err := player.call("loadfile", song.Path, "append")
+	if err != nil {
+		return err
+	}
+
+	count, err := player.getFloatProperty("playlist-count")
+	if err != nil {
+		return err
+	}
+
+	entry, err := player.getFloatProperty(fmt.Sprintf("playlist/%d/id", int(count)-1))
+	if err != nil {
+		return err
+	}
+
+	prefetched := *song
+	player.prefetched = &prefetched
+	player.prefetchedEntry = entry
+
+	return nil
+}
+
+// continuePrefetched checks whether mpv already continued with the entry of the prefetched
+// song. The same url can be in the playlist twice, so the entry is compared instead of the path.
+func (player *Player) continuePrefetched(song music.Song) bool {
+	if player.prefetched == nil || *player.prefetched != song {
+		return false
+	}
+
+	position, err := player.getFloatProperty("playlist-playing-pos")
+	if err != nil || position < 0 {
+		return false
+	}
+
+	entry, err := player.getFloatProperty(fmt.Sprintf("playlist/%d/id", int(position)))
+	if err != nil || entry != player.prefetchedEntry {
+		return false
+	}
+
+	player.prefetched = nil
+	player.current = &song
+	return true
+}
+
+// getFloatProperty returns a numeric property of mpv
+func (player *Player) getFloatProperty(property string) (float64, error) {
+	data, err := player.call("get_property", property)
+	if err != nil {
+		return 0, err
+	}
+
+	value, ok := data.(float64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected value for %s: %v", property, data)
+	}
+
+	return value, nil
+}
+
+// Seek to an absolute position in the current song
+func (player *Player) Seek(position time.Duration) error {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	_, err := player.call("seek", position.Seconds(), "absolute")
+
+	return err
+}
+
+// SeekRelative seeks forwards or backwards from the current position
+func (player *Player) SeekRelative(offset time.Duration) error {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	_, err := player.call("seek", offset.Seconds(), "relative")
+
+	return err
+}
+
+// Position returns the playback position in the current song
+func (player *Player) Position() (time.Duration, error) {
+	position, err := player.getDurationProperty("time-pos")
+	if err == nil {
+		player.mutex.Lock()
+		player.position = position
+		player.mutex.Unlock()
+	}
+
+	return position, err
+}
+
+// Duration returns the duration of the current song. This is not available for streams
+func (player *Player) Duration() (time.Duration, error) {
+	return player.getDurationProperty("duration")
+}
+
+func (player *Player) getDurationProperty(property string) (time.Duration, error) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	data, err := player.call("get_property", property)
+	if err != nil {
+		return 0, err
+	}
+
+	seconds, ok := data.(float64)
+	if !ok {
+		return 0, fmt.Errorf("unexpected value for %s: %v", property, data)
+	}
+
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
 func (player *Player) startProcess() error {
-	command := exec.Command(player.mpvPath, "--no-video", "--volume=50", "--idle", "--input-ipc-server="+player.socketPath)
+	arguments := []string{
+		"--no-video",
+		fmt.Sprintf("--volume=%d", player.volume),
+		"--idle",
+		"--gapless-audio=yes",
+		"--prefetch-playlist=yes",
+		"--input-ipc-server=" + player.socketPath,
+	}
+
+	if player.options.Profile != "" {
+		arguments = append(arguments, "--profile="+player.options.Profile)
+	}
+
+	if player.audioDevice != "" {
+		arguments = append(arguments, "--audio-device="+player.audioDevice)
+	}
+
+	if player.options.YtdlFormat != "" {
+		arguments = append(arguments, "--ytdl-format="+player.options.YtdlFormat)
+	}
+
+	// the extra arguments come last so they can override the ones above
+	arguments = append(arguments, player.options.Args...)
+
+	command := player.execCommand(player.mpvPath, arguments...)
 	player.process = command
+	generation := player.generation
 
 	err := command.Start()
 	player.isRunning = err == nil
@@ -183,12 +451,15 @@ func (player *Player) startProcess() error {
 
 		player.mutex.Lock()
 
-		player.isRunning = false
-		player.process = nil
+		if player.process == command {
+			player.isRunning = false
+			player.process = nil
+		}
 
 		player.mutex.Unlock()
 
 		log.Printf("MpvControl.startMpv: mpv has exited [%s | %s] %v", player.mpvPath, player.socketPath, err)
+		player.crashed(generation, fmt.Errorf("mpv has exited: %v", err))
 	}()
 
 	return nil
@@ -198,10 +469,42 @@ func (player *Player) CanPlay(song music.Song) bool {
 	return true
 }
 
+// PlaysLocally is true, mpv runs on the machine of the bot
+func (player *Player) PlaysLocally() bool {
+	return true
+}
+
 func (player *Player) PlaySong(song music.Song) error {
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
 
+	if player.continuePrefetched(song) {
+		return nil
+	}
+
+	// make sure mpv does not continue with a song that was prefetched earlier
+	if player.prefetched != nil {
+		_, err := player.call("playlist-clear")
+		if err != nil {
+			return err
+		}
+
+		player.prefetched = nil
+	}
+
+	err := player.loadSong(song)
+	if err != nil {
+		return err
+	}
+
+	player.current = &song
+	player.position = 0
+
+	return nil
+}
+
+// loadSong replaces the current song and waits until mpv loaded it
+func (player *Player) loadSong(song music.Song) error {
 	waitForLoad := make(chan bool)
 	waitForLoadListener := player.eventEmitter.ListenOnce(EventFileLoaded, func(arguments ...interface{}) {
 		waitForLoad <- true
@@ -220,7 +523,7 @@ func (player *Player) PlaySong(song music.Song) error {
 	defer player.eventEmitter.RemoveListener(EventFileEnded, waitForEOFListener)
 
 	// Start an event listener to wait for the file to load.
-	_, err := player.connection.Call("loadfile", song.Path, "replace")
+	_, err := player.call("loadfile", song.Path, "replace")
 	if err != nil {
 		log.Printf("MpvControl.LoadFile: Error sending loadfile command [%s] %v", song.Path, err)
 		return err
@@ -236,11 +539,12 @@ func (player *Player) PlaySong(song music.Song) error {
 		return fmt.Errorf(errStr)
 	case <-timeoutCtx.Done():
 		log.Printf("MpvControl.LoadFile: Load file timeout, did not receive file-loaded event in %d", mpvMaxLoadTimeout)
-		_, err = player.connection.Call("stop")
+		_, err = player.call("stop")
 		if err != nil {
 			log.Printf("MpvControl.LoadFile: Error calling stop after timeout: %v", err)
 			return err
 		}
+		// a song that did not load in time won't load when it is tried again
 		return fmt.Errorf("MPV timeout")
 	}
 }
@@ -249,7 +553,10 @@ func (player *Player) Play() error {
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
 
-	_, err := player.connection.Call("set_property", "pause", false)
+	_, err := player.call("set_property", "pause", false)
+	if err == nil {
+		player.paused = false
+	}
 
 	return err
 }
@@ -258,12 +565,20 @@ func (player *Player) Pause() error {
 	player.mutex.Lock()
 	defer player.mutex.Unlock()
 
-	_, err := player.connection.Call("set_property", "pause", true)
+	_, err := player.call("set_property", "pause", true)
+	if err == nil {
+		player.paused = true
+	}
 
 	return err
 }
 
 func (player *Player) Stop() {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	player.stopping = true
+
 	if player.isRunning {
 		_ = player.process.Process.Kill()
 	}
@@ -273,10 +588,29 @@ func (player *Player) Stop() {
 
 func (player *Player) Wait() {
 
-	done := make(chan bool)
-	player.eventEmitter.ListenOnce(EventFileEnded, func(arguments ...interface{}) {
+	done := make(chan bool, 2)
+	endedListener := player.eventEmitter.ListenOnce(EventFileEnded, func(arguments ...interface{}) {
+		done <- true
+	})
+	skippedListener := player.eventEmitter.ListenOnce(eventSkipped, func(arguments ...interface{}) {
 		done <- true
 	})
 
 	<-done
+
+	player.eventEmitter.RemoveListener(EventFileEnded, endedListener)
+	player.eventEmitter.RemoveListener(eventSkipped, skippedListener)
+
+	player.mutex.Lock()
+	player.current = nil
+	player.mutex.Unlock()
+}
+
+// SetSpeed changes the playback speed, 1 is the normal speed
+func (player *Player) SetSpeed(speed float64) error {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	_, err := player.call("set_property", "speed", speed)
+	return err
 }
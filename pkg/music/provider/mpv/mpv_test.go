@@ -0,0 +1,451 @@
+package mpv
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// fakeMpv answers the ipc commands like mpv would. The process it starts is the test binary
+// running TestFakeMpvProcess, which does nothing until it is killed.
+type fakeMpv struct {
+	t *testing.T
+
+	lock     sync.Mutex
+	listener net.Listener
+	// launches are the arguments of every started process
+	launches   [][]string
+	commands   []string
+	properties map[string]interface{}
+	// playlist are the paths of the playlist entries, the entry with id n is at playlist[n-1]
+	// until the playlist is cleared
+	playlist []playlistEntry
+	playing  int
+	entries  int
+	// failures is the amount of launches that fail to start
+	failures int
+	// hang holds back the answer to get_property idle-active until it is closed
+	hang    chan struct{}
+	waiting chan struct{}
+}
+
+type playlistEntry struct {
+	id   int
+	path string
+}
+
+func newFakeMpv(t *testing.T) (*fakeMpv, *Player) {
+	fake := &fakeMpv{
+		t: t,
+		properties: map[string]interface{}{
+			"idle-active": true,
+			"volume":      float64(DefaultVolume),
+		},
+	}
+
+	player := NewPlayer("mpv", filepath.Join(t.TempDir(), "mpv.sock"))
+	player.execCommand = fake.command
+
+	t.Cleanup(func() {
+		player.Stop()
+
+		fake.lock.Lock()
+		defer fake.lock.Unlock()
+
+		if fake.listener != nil {
+			_ = fake.listener.Close()
+		}
+	})
+
+	return fake, player
+}
+
+// command starts listening on the socket of the arguments, like mpv does when it starts
+func (fake *fakeMpv) command(name string, arguments ...string) *exec.Cmd {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.launches = append(fake.launches, arguments)
+
+	if fake.failures > 0 {
+		fake.failures--
+		return exec.Command(filepath.Join(fake.t.TempDir(), "missing"))
+	}
+
+	if fake.listener != nil {
+		_ = fake.listener.Close()
+	}
+
+	for _, argument := range arguments {
+		if !strings.HasPrefix(argument, "--input-ipc-server=") {
+			continue
+		}
+
+		listener, err := net.Listen("unix", strings.TrimPrefix(argument, "--input-ipc-server="))
+		assert.NoError(fake.t, err)
+
+		fake.listener = listener
+		go fake.accept(listener)
+	}
+
+	process := exec.Command(os.Args[0], "-test.run=^TestFakeMpvProcess$")
+	process.Env = append(os.Environ(), "GO_FAKE_MPV=1")
+
+	return process
+}
+
+func (fake *fakeMpv) accept(listener net.Listener) {
+	for {
+		connection, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go fake.serve(connection)
+	}
+}
+
+func (fake *fakeMpv) serve(connection net.Conn) {
+	defer connection.Close()
+
+	var writeLock sync.Mutex
+	send := func(message map[string]interface{}) {
+		data, _ := json.Marshal(message)
+
+		writeLock.Lock()
+		defer writeLock.Unlock()
+
+		_, _ = connection.Write(append(data, '\n'))
+	}
+
+	scanner := bufio.NewScanner(connection)
+	for scanner.Scan() {
+		var request struct {
+			Command []interface{} `json:"command"`
+			ID      uint          `json:"request_id"`
+		}
+
+		if err := json.Unmarshal(scanner.Bytes(), &request); err != nil {
+			continue
+		}
+
+		go fake.handle(request.Command, request.ID, send)
+	}
+}
+
+func (fake *fakeMpv) handle(command []interface{}, id uint, send func(map[string]interface{})) {
+	words := make([]string, 0, len(command))
+	for _, argument := range command {
+		words = append(words, fmt.Sprint(argument))
+	}
+
+	fake.lock.Lock()
+	fake.commands = append(fake.commands, strings.Join(words, " "))
+	hang, waiting := fake.hang, fake.waiting
+	fake.lock.Unlock()
+
+	if hang != nil && words[0] == "get_property" && words[1] == "idle-active" {
+		close(waiting)
+		<-hang
+	}
+
+	fake.lock.Lock()
+	result := map[string]interface{}{"request_id": id, "error": "success"}
+	var event map[string]interface{}
+
+	switch words[0] {
+	case "get_property":
+		value, exists := fake.property(words[1])
+		if !exists {
+			result["error"] = "property unavailable"
+		}
+		result["data"] = value
+	case "set_property":
+		fake.properties[words[1]] = command[2]
+	case "loadfile":
+		fake.entries++
+		entry := playlistEntry{id: fake.entries, path: words[1]}
+
+		if words[2] == "append" {
+			fake.playlist = append(fake.playlist, entry)
+			break
+		}
+
+		fake.playlist = []playlistEntry{entry}
+		fake.playing = 0
+		fake.properties["idle-active"] = false
+		event = map[string]interface{}{"event": "file-loaded"}
+	case "playlist-next":
+		if fake.playing+1 < len(fake.playlist) {
+			fake.playing++
+		}
+	case "playlist-clear":
+		if len(fake.playlist) > 0 {
+			fake.playlist = fake.playlist[fake.playing : fake.playing+1]
+			fake.playing = 0
+		}
+	}
+	fake.lock.Unlock()
+
+	send(result)
+
+	if event != nil {
+		send(event)
+	}
+}
+
+// property returns the property like mpv does, the lock must be held
+func (fake *fakeMpv) property(name string) (interface{}, bool) {
+	switch {
+	case name == "path":
+		if len(fake.playlist) == 0 {
+			return nil, false
+		}
+		return fake.playlist[fake.playing].path, true
+	case name == "playlist-count":
+		return float64(len(fake.playlist)), true
+	case name == "playlist-playing-pos":
+		if len(fake.playlist) == 0 {
+			return float64(-1), true
+		}
+		return float64(fake.playing), true
+	case strings.HasPrefix(name, "playlist/") && strings.HasSuffix(name, "/id"):
+		var index int
+		if _, err := fmt.Sscanf(name, "playlist/%d/id", &index); err != nil || index < 0 || index >= len(fake.playlist) {
+			return nil, false
+		}
+		return float64(fake.playlist[index].id), true
+	}
+
+	value, exists := fake.properties[name]
+	return value, exists
+}
+
+func (fake *fakeMpv) set(property string, value interface{}) {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.properties[property] = value
+}
+
+// received tells whether mpv received the command since the commands were last cleared
+func (fake *fakeMpv) received(command string) bool {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	for _, received := range fake.commands {
+		if received == command {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (fake *fakeMpv) clear() {
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	fake.commands = nil
+}
+
+// TestFakeMpvProcess is the mpv process started by the fake, it runs until it is killed
+func TestFakeMpvProcess(t *testing.T) {
+	if os.Getenv("GO_FAKE_MPV") != "1" {
+		return
+	}
+
+	time.Sleep(time.Hour)
+}
+
+func TestPlayer_Options(t *testing.T) {
+	t.Parallel()
+
+	fake, player := newFakeMpv(t)
+
+	muted := 0
+	player.Configure(Options{
+		Args:        []string{"--cache=yes"},
+		AudioDevice: "pulse/kitchen",
+		Profile:     "office",
+		Volume:      &muted,
+		YtdlFormat:  "bestaudio",
+	})
+
+	assert.NoError(t, player.Start())
+
+	assert.Equal(t, [][]string{{
+		"--no-video",
+		"--volume=0",
+		"--idle",
+		"--gapless-audio=yes",
+		"--prefetch-playlist=yes",
+		"--input-ipc-server=" + player.socketPath,
+		"--profile=office",
+		"--audio-device=pulse/kitchen",
+		"--ytdl-format=bestaudio",
+		"--cache=yes",
+	}}, fake.launches)
+}
+
+func TestPlayer_Normalization(t *testing.T) {
+	t.Parallel()
+
+	fake, player := newFakeMpv(t)
+	player.ConfigureNormalization("loudnorm", "album", true)
+	assert.NoError(t, player.Start())
+
+	assert.True(t, fake.received("af add @musicbot-normalize:lavfi=[loudnorm]"))
+	assert.True(t, fake.received("set_property replaygain album"))
+
+	fake.clear()
+	assert.NoError(t, player.SetNormalization(false))
+	assert.True(t, fake.received("af remove @musicbot-normalize"))
+	assert.True(t, fake.received("set_property replaygain no"))
+	assert.False(t, player.GetNormalization())
+}
+
+func TestPlayer_Prefetch(t *testing.T) {
+	t.Parallel()
+
+	fake, player := newFakeMpv(t)
+	assert.NoError(t, player.Start())
+
+	first := music.Song{Path: "https://example.com/first"}
+	second := music.Song{Path: "https://example.com/second"}
+
+	assert.NoError(t, player.PlaySong(first))
+	assert.NoError(t, player.Prefetch(&second))
+	assert.True(t, fake.received("loadfile https://example.com/second append"))
+
+	// mpv continues with the prefetched song without loading it again
+	assert.NoError(t, player.Skip())
+	assert.True(t, fake.received("playlist-next force"))
+
+	fake.clear()
+	assert.NoError(t, player.PlaySong(second))
+	assert.False(t, fake.received("loadfile https://example.com/second replace"))
+
+	// a different song replaces the prefetched one
+	assert.NoError(t, player.Prefetch(&first))
+	fake.clear()
+	assert.NoError(t, player.PlaySong(second))
+	assert.True(t, fake.received("playlist-clear"))
+	assert.True(t, fake.received("loadfile https://example.com/second replace"))
+
+	// the same song repeated is only continued once mpv plays the appended entry
+	assert.NoError(t, player.Prefetch(&second))
+	fake.clear()
+	assert.NoError(t, player.PlaySong(second))
+	assert.True(t, fake.received("loadfile https://example.com/second replace"))
+
+	assert.NoError(t, player.Prefetch(&second))
+	assert.NoError(t, player.Skip())
+	fake.clear()
+	assert.NoError(t, player.PlaySong(second))
+	assert.False(t, fake.received("loadfile https://example.com/second replace"))
+}
+
+func TestPlayer_Restart(t *testing.T) {
+	t.Parallel()
+
+	fake, player := newFakeMpv(t)
+
+	restarted := make(chan bool, 1)
+	player.OnRestart(nil, func(song *music.Song, resumed bool) {
+		restarted <- resumed
+	})
+
+	assert.NoError(t, player.Start())
+	assert.NoError(t, player.SetVolume(30))
+
+	song := music.Song{Path: "https://example.com/song", SongType: music.SongTypeSong}
+	assert.NoError(t, player.PlaySong(song))
+
+	// the heartbeat remembers where the song was
+	fake.set("time-pos", float64(42))
+	player.heartbeat()
+
+	// the first restart fails, the second one is tried after the backoff
+	fake.lock.Lock()
+	fake.failures = 1
+	fake.commands = nil
+	fake.lock.Unlock()
+
+	player.mutex.Lock()
+	_ = player.process.Process.Kill()
+	player.mutex.Unlock()
+
+	select {
+	case resumed := <-restarted:
+		assert.True(t, resumed)
+	case <-time.After(10 * time.Second):
+		t.Fatal("mpv was not restarted")
+	}
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	assert.Len(t, fake.launches, 3)
+	assert.Contains(t, fake.launches[2], "--volume=30")
+	assert.Contains(t, fake.commands, "loadfile https://example.com/song replace")
+	assert.Contains(t, fake.commands, "seek 42 absolute")
+}
+
+func TestPlayer_HeartbeatDoesNotBlock(t *testing.T) {
+	t.Parallel()
+
+	fake, player := newFakeMpv(t)
+	assert.NoError(t, player.Start())
+
+	hang := make(chan struct{})
+	waiting := make(chan struct{})
+
+	fake.lock.Lock()
+	fake.hang = hang
+	fake.waiting = waiting
+	fake.lock.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		player.heartbeat()
+		close(done)
+	}()
+
+	<-waiting
+
+	// the player can be used while the heartbeat waits for mpv
+	answered := make(chan struct{})
+	go func() {
+		player.GetNormalization()
+		close(answered)
+	}()
+
+	select {
+	case <-answered:
+	case <-time.After(time.Second):
+		t.Fatal("the heartbeat blocks the player")
+	}
+
+	close(hang)
+	<-done
+}
+
+func TestNextBackoff(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, 2*time.Second, nextBackoff(restartMinBackoff))
+	assert.Equal(t, restartMaxBackoff, nextBackoff(40*time.Second))
+	assert.Equal(t, restartMaxBackoff, nextBackoff(restartMaxBackoff))
+}
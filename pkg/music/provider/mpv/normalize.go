@@ -0,0 +1,73 @@
+package mpv
+
+import (
+	"fmt"
+	"log"
+)
+
+const (
+	normalizeFilterLabel   = "@musicbot-normalize"
+	DefaultNormalizeFilter = "dynaudnorm"
+	DefaultReplayGain      = "track"
+)
+
+// ConfigureNormalization sets the ffmpeg filter used to normalise the loudness of songs and
+// the ReplayGain mode used for files with ReplayGain tags. It should be called before Start.
+func (player *Player) ConfigureNormalization(filter string, replayGain string, enabled bool) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	if filter == "" {
+		filter = DefaultNormalizeFilter
+	}
+
+	if replayGain == "" {
+		replayGain = DefaultReplayGain
+	}
+
+	player.normalizeFilter = filter
+	player.replayGain = replayGain
+	player.normalize = enabled
+}
+
+// SetNormalization enables or disables loudness normalisation at runtime
+func (player *Player) SetNormalization(enabled bool) error {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	err := player.applyNormalization(enabled)
+	if err != nil {
+		return err
+	}
+
+	player.normalize = enabled
+	return nil
+}
+
+func (player *Player) GetNormalization() bool {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	return player.normalize
+}
+
+func (player *Player) applyNormalization(enabled bool) error {
+	// always remove the filter first so it is never added twice. This fails if it is not there
+	if _, err := player.call("af", "remove", normalizeFilterLabel); err != nil {
+		log.Printf("Mpv: no normalisation filter to remove: %v", err)
+	}
+
+	replayGain := "no"
+
+	if enabled {
+		filter := fmt.Sprintf("%s:lavfi=[%s]", normalizeFilterLabel, player.normalizeFilter)
+		if _, err := player.call("af", "add", filter); err != nil {
+			return fmt.Errorf("unable to add normalisation filter %s: %v", player.normalizeFilter, err)
+		}
+
+		replayGain = player.replayGain
+	}
+
+	_, err := player.call("set_property", "replaygain", replayGain)
+	return err
+}
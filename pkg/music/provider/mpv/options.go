@@ -0,0 +1,88 @@
+package mpv
+
+import (
+	"fmt"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// Options are passed to mpv when it is started
+type Options struct {
+	// Args are extra command line arguments
+	Args []string
+	// AudioDevice is the audio output, like pulse/alsa_output.pci-0000_00_1f.3.analog-stereo
+	AudioDevice string
+	// Profile is the name of an mpv profile from mpv.conf
+	Profile string
+	// Volume is the volume mpv starts with, DefaultVolume when it is nil
+	Volume *int
+	// YtdlFormat is the format youtube-dl or yt-dlp selects, like bestaudio
+	YtdlFormat string
+}
+
+// Configure sets the options mpv is started with. It should be called before Start.
+func (player *Player) Configure(options Options) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	player.options = options
+	player.audioDevice = options.AudioDevice
+
+	if options.Volume != nil {
+		player.volume = *options.Volume
+	}
+}
+
+// AudioDevices lists the audio outputs mpv can use
+func (player *Player) AudioDevices() ([]music.AudioDevice, error) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	data, err := player.call("get_property", "audio-device-list")
+	if err != nil {
+		return nil, err
+	}
+
+	list, ok := data.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected value for audio-device-list: %v", data)
+	}
+
+	active, err := player.call("get_property", "audio-device")
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]music.AudioDevice, 0, len(list))
+	for _, entry := range list {
+		properties, ok := entry.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		name, _ := properties["name"].(string)
+		description, _ := properties["description"].(string)
+
+		devices = append(devices, music.AudioDevice{
+			Name:        name,
+			Description: description,
+			Active:      name == active,
+		})
+	}
+
+	return devices, nil
+}
+
+// SetAudioDevice switches the audio output
+func (player *Player) SetAudioDevice(name string) error {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	_, err := player.call("set_property", "audio-device", name)
+	if err != nil {
+		return err
+	}
+
+	player.audioDevice = name
+	return nil
+}
@@ -0,0 +1,224 @@
+package mpv
+
+import (
+	"log"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	heartbeatInterval = 5 * time.Second
+	restartMinBackoff = time.Second
+	restartMaxBackoff = time.Minute
+	// crashBuffer fits a process exit, a lost connection and a failed heartbeat at once
+	crashBuffer = 3
+)
+
+// crash is reported when the mpv process exits or the connection to it is lost
+type crash struct {
+	generation int
+	err        error
+}
+
+// OnRestart registers the functions that are called when mpv crashed and when it is running
+// again. resumed tells whether the song that was playing could be resumed.
+func (player *Player) OnRestart(crashed func(err error), restarted func(song *music.Song, resumed bool)) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	player.onCrash = crashed
+	player.onRestart = restarted
+}
+
+// crashed reports a crash of the given generation of mpv to the supervisor
+func (player *Player) crashed(generation int, err error) {
+	select {
+	case player.crashes <- crash{generation: generation, err: err}:
+	default:
+		// a crash is already being reported
+	}
+}
+
+// supervise restarts mpv when it crashes. mpv is checked periodically as well, as the ipc
+// connection can hang without being closed.
+func (player *Player) supervise() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case crash := <-player.crashes:
+			player.mutex.Lock()
+			current := crash.generation == player.generation
+			stopping := player.stopping
+			player.mutex.Unlock()
+
+			if stopping {
+				return
+			}
+
+			if current {
+				player.recover(crash.err)
+			}
+		case <-ticker.C:
+			player.heartbeat()
+		}
+	}
+}
+
+// heartbeat checks whether mpv still answers and remembers the position in the current song,
+// so it can be resumed after a crash. The mutex is not held while waiting for mpv, so a hanging
+// mpv does not block the commands until the call times out.
+func (player *Player) heartbeat() {
+	player.mutex.Lock()
+	stopping := player.stopping
+	connection := player.connection
+	generation := player.generation
+	player.mutex.Unlock()
+
+	if stopping || connection == nil {
+		return
+	}
+
+	idle, err := callMpv(connection, "get_property", "idle-active")
+	if err != nil {
+		log.Printf("Mpv: heartbeat failed: %v", err)
+		player.crashed(generation, err)
+		return
+	}
+
+	if idle == true {
+		return
+	}
+
+	data, err := callMpv(connection, "get_property", "time-pos")
+	if err != nil {
+		return
+	}
+
+	seconds, ok := data.(float64)
+	if !ok {
+		return
+	}
+
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	// mpv might have been restarted in the meantime
+	if player.generation == generation {
+		player.position = time.Duration(seconds * float64(time.Second))
+	}
+}
+
+// recover restarts mpv until it succeeds and resumes the song that was playing
+func (player *Player) recover(reason error) {
+	log.Printf("Mpv: mpv crashed, restarting: %v", reason)
+
+	player.mutex.Lock()
+	onCrash := player.onCrash
+	player.mutex.Unlock()
+
+	if onCrash != nil {
+		onCrash(reason)
+	}
+
+	backoff := restartMinBackoff
+
+	for {
+		player.kill()
+
+		err := player.launch()
+		if err == nil {
+			break
+		}
+
+		log.Printf("Mpv: unable to restart mpv, trying again in %s: %v", backoff, err)
+		time.Sleep(backoff)
+
+		backoff = nextBackoff(backoff)
+	}
+
+	song, resumed := player.resume()
+
+	player.mutex.Lock()
+	onRestart := player.onRestart
+	player.mutex.Unlock()
+
+	if onRestart != nil {
+		onRestart(song, resumed)
+	}
+}
+
+// nextBackoff doubles the time between restarts, up to restartMaxBackoff
+func nextBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff > restartMaxBackoff {
+		backoff = restartMaxBackoff
+	}
+
+	return backoff
+}
+
+// kill stops what is left of the crashed mpv process and connection
+func (player *Player) kill() {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	if player.connection != nil {
+		_ = player.connection.Close()
+	}
+
+	if player.isRunning && player.process != nil {
+		_ = player.process.Process.Kill()
+	}
+
+	player.isRunning = false
+	player.process = nil
+}
+
+// resume loads the song that was playing when mpv crashed and continues where it was. When that
+// fails the song is skipped.
+func (player *Player) resume() (*music.Song, bool) {
+	player.mutex.Lock()
+	defer player.mutex.Unlock()
+
+	song := player.current
+	if song == nil {
+		return nil, true
+	}
+
+	err := player.restoreSong(*song)
+	if err == nil {
+		return song, true
+	}
+
+	log.Printf("Mpv: unable to resume %s, skipping it: %v", song.Path, err)
+	player.current = nil
+
+	// Wait might still be waiting for the song to end
+	player.eventEmitter.EmitEvent(eventSkipped)
+
+	return song, false
+}
+
+func (player *Player) restoreSong(song music.Song) error {
+	// the pause property is kept when loading a new file
+	if player.paused {
+		if _, err := player.call("set_property", "pause", true); err != nil {
+			return err
+		}
+	}
+
+	err := player.loadSong(song)
+	if err != nil {
+		return err
+	}
+
+	// streams continue live, songs where they were
+	if song.SongType == music.SongTypeSong && player.position > 0 {
+		_, err = player.call("seek", player.position.Seconds(), "absolute")
+	}
+
+	return err
+}
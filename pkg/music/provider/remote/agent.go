@@ -0,0 +1,267 @@
+package remote
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// requestBuffer is the amount of requests that can wait while a slow one, like loading a song,
+// is handled
+const requestBuffer = 16
+
+var (
+	errNotSupported = errors.New("not supported by the player of the agent")
+	errBusy         = errors.New("the agent is busy, too many requests are waiting")
+)
+
+// Agent runs next to the player and lets a bot on another machine control it. Only one bot is
+// connected at a time, a new connection replaces the previous one.
+type Agent struct {
+	provider music.Provider
+	token    string
+	upgrader websocket.Upgrader
+
+	lock       sync.Mutex
+	connection *connection
+	// sequence is the sequence of the last started song, playing tells whether it still plays
+	sequence int
+	playing  bool
+}
+
+// connection serialises the writes to a websocket
+type connection struct {
+	socket *websocket.Conn
+	lock   sync.Mutex
+}
+
+func (connection *connection) write(message frame) error {
+	connection.lock.Lock()
+	defer connection.lock.Unlock()
+
+	_ = connection.socket.SetWriteDeadline(time.Now().Add(writeTimeout))
+	return connection.socket.WriteJSON(message)
+}
+
+// NewAgent creates an agent for the provider. Bots must send the token to connect.
+func NewAgent(provider music.Provider, token string) *Agent {
+	return &Agent{
+		provider: provider,
+		token:    token,
+	}
+}
+
+func (agent *Agent) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if subtle.ConstantTimeCompare([]byte(request.Header.Get("Authorization")), []byte(authorization(agent.token))) != 1 {
+		http.Error(writer, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	socket, err := agent.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		log.Printf("Agent: unable to accept the connection from %s: %v", request.RemoteAddr, err)
+		return
+	}
+
+	log.Printf("Agent: bot connected from %s", request.RemoteAddr)
+
+	current := &connection{socket: socket}
+
+	agent.lock.Lock()
+	if agent.connection != nil {
+		log.Println("Agent: replacing the previous connection")
+		_ = agent.connection.socket.Close()
+	}
+	agent.connection = current
+
+	hello := frame{Event: eventHello, Schemes: agent.schemes()}
+	if agent.playing {
+		hello.Sequence = agent.sequence
+	}
+	agent.lock.Unlock()
+
+	defer func() {
+		agent.lock.Lock()
+		if agent.connection == current {
+			agent.connection = nil
+		}
+		agent.lock.Unlock()
+
+		_ = socket.Close()
+	}()
+
+	if err := current.write(hello); err != nil {
+		log.Printf("Agent: unable to greet the bot: %v", err)
+		return
+	}
+
+	// the bot pings regularly, a bot that stopped pinging is gone
+	_ = socket.SetReadDeadline(time.Now().Add(pongTimeout))
+	socket.SetPingHandler(func(data string) error {
+		_ = socket.SetReadDeadline(time.Now().Add(pongTimeout))
+
+		current.lock.Lock()
+		defer current.lock.Unlock()
+
+		return socket.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(writeTimeout))
+	})
+
+	// requests are handled in order, while the pings keep being answered. The read loop never
+	// waits for the requests, that would hold up the pings as well.
+	requests := make(chan frame, requestBuffer)
+	defer close(requests)
+
+	go func() {
+		for request := range requests {
+			if err := current.write(agent.handle(request)); err != nil {
+				log.Printf("Agent: unable to respond to %s: %v", request.Method, err)
+			}
+		}
+	}()
+
+	for {
+		var message frame
+		if err := socket.ReadJSON(&message); err != nil {
+			log.Printf("Agent: bot %s disconnected: %v", request.RemoteAddr, err)
+			return
+		}
+
+		select {
+		case requests <- message:
+		default:
+			response := frame{ID: message.ID, Error: errBusy.Error()}
+			if err := current.write(response); err != nil {
+				log.Printf("Agent: unable to refuse %s: %v", message.Method, err)
+			}
+		}
+	}
+}
+
+// schemes returns the url schemes the player can play
+func (agent *Agent) schemes() []string {
+	schemes := make([]string, 0, len(probeSchemes))
+	for _, name := range probeSchemes {
+		path := "song"
+		if name != "" {
+			path = name + "://"
+		}
+
+		if agent.provider.CanPlay(music.Song{Path: path}) {
+			schemes = append(schemes, name)
+		}
+	}
+
+	return schemes
+}
+
+// handle calls the provider and returns the response to the request
+func (agent *Agent) handle(request frame) frame {
+	response := frame{ID: request.ID}
+	var err error
+
+	switch request.Method {
+	case methodCanPlay:
+		if request.Song != nil {
+			response.Playable = agent.provider.CanPlay(*request.Song)
+		}
+	case methodPlaySong:
+		if request.Song == nil {
+			err = errors.New("no song to play")
+			break
+		}
+		response.Sequence, err = agent.playSong(*request.Song)
+	case methodPrefetch:
+		err = agent.provider.Prefetch(request.Song)
+	case methodPlay:
+		err = agent.provider.Play()
+	case methodPause:
+		err = agent.provider.Pause()
+	case methodSkip:
+		err = agent.provider.Skip()
+	case methodSeek:
+		err = agent.provider.Seek(request.Position)
+	case methodSeekRelative:
+		err = agent.provider.SeekRelative(request.Position)
+	case methodPosition:
+		response.Position, err = agent.provider.Position()
+	case methodDuration:
+		response.Duration, err = agent.provider.Duration()
+	case methodGetVolume:
+		response.Volume, err = agent.provider.GetVolume()
+	case methodSetVolume:
+		err = agent.provider.SetVolume(request.Volume)
+	case methodSetSpeed:
+		adjuster, ok := agent.provider.(music.SpeedAdjuster)
+		if !ok {
+			err = errNotSupported
+			break
+		}
+		err = adjuster.SetSpeed(request.Speed)
+	case methodAudioDevices:
+		selector, ok := agent.provider.(music.DeviceSelector)
+		if !ok {
+			err = errNotSupported
+			break
+		}
+		response.Devices, err = selector.AudioDevices()
+	case methodSetAudioDevice:
+		selector, ok := agent.provider.(music.DeviceSelector)
+		if !ok {
+			err = errNotSupported
+			break
+		}
+		err = selector.SetAudioDevice(request.Device)
+	default:
+		err = errors.New("unknown method " + request.Method)
+	}
+
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	return response
+}
+
+// playSong starts the song and reports to the bot when it ends
+func (agent *Agent) playSong(song music.Song) (int, error) {
+	if err := agent.provider.PlaySong(song); err != nil {
+		return 0, err
+	}
+
+	agent.lock.Lock()
+	agent.sequence++
+	sequence := agent.sequence
+	agent.playing = true
+	agent.lock.Unlock()
+
+	go func() {
+		agent.provider.Wait()
+		agent.songEnded(sequence)
+	}()
+
+	return sequence, nil
+}
+
+// songEnded tells the bot the song ended. When no bot is connected it is told by the hello.
+func (agent *Agent) songEnded(sequence int) {
+	agent.lock.Lock()
+	if sequence == agent.sequence {
+		agent.playing = false
+	}
+	current := agent.connection
+	agent.lock.Unlock()
+
+	if current == nil {
+		return
+	}
+
+	if err := current.write(frame{Event: eventSongEnded, Sequence: sequence}); err != nil {
+		log.Printf("Agent: unable to report the end of the song: %v", err)
+	}
+}
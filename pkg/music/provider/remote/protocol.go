@@ -0,0 +1,87 @@
+package remote
+
+import (
+	"strings"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// The bot and the agent exchange frames as JSON over a websocket. The bot sends requests with
+// a method, the agent answers every request with a response carrying the same id. The agent
+// also sends events on its own: a hello when the bot connects and song-ended when a song ends.
+// The hello lists the url schemes the player of the agent can play, so the bot can decide
+// whether a song can be played without asking the agent.
+
+const (
+	// methodCanPlay is still answered for bots that ask instead of using the schemes of the hello
+	methodCanPlay        = "canPlay"
+	methodPlaySong       = "playSong"
+	methodPrefetch       = "prefetch"
+	methodPlay           = "play"
+	methodPause          = "pause"
+	methodSkip           = "skip"
+	methodSeek           = "seek"
+	methodSeekRelative   = "seekRelative"
+	methodPosition       = "position"
+	methodDuration       = "duration"
+	methodGetVolume      = "getVolume"
+	methodSetVolume      = "setVolume"
+	methodSetSpeed       = "setSpeed"
+	methodAudioDevices   = "audioDevices"
+	methodSetAudioDevice = "setAudioDevice"
+
+	// eventHello tells the bot which song is playing, 0 when nothing is, and which schemes
+	// the player can play
+	eventHello = "hello"
+	// eventSongEnded tells the bot the song with the sequence ended
+	eventSongEnded = "song-ended"
+)
+
+const (
+	// pingInterval is how often the bot checks whether the agent is still there
+	pingInterval = 5 * time.Second
+	// pongTimeout is how long either side waits for the other before reconnecting
+	pongTimeout  = 3 * pingInterval
+	writeTimeout = 5 * time.Second
+)
+
+// frame is a request, response or event
+type frame struct {
+	ID     int    `json:"id,omitempty"`
+	Method string `json:"method,omitempty"`
+	Event  string `json:"event,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	Song     *music.Song         `json:"song,omitempty"`
+	Volume   int                 `json:"volume,omitempty"`
+	Position time.Duration       `json:"position,omitempty"`
+	Duration time.Duration       `json:"duration,omitempty"`
+	Speed    float64             `json:"speed,omitempty"`
+	Device   string              `json:"device,omitempty"`
+	Devices  []music.AudioDevice `json:"devices,omitempty"`
+	Playable bool                `json:"playable,omitempty"`
+	// Schemes are the url schemes the player can play, an empty scheme stands for paths
+	Schemes []string `json:"schemes,omitempty"`
+	// Sequence identifies a song started by playSong, so a late song-ended of a previous song
+	// is not mistaken for the end of the current one
+	Sequence int `json:"sequence,omitempty"`
+}
+
+// probeSchemes are the url schemes the agent asks its player about for the hello
+var probeSchemes = []string{"", "file", "http", "https", "ftp", "rtmp", "rtsp", "mms", "sftp", "smb", "nfs"}
+
+// scheme returns the url scheme of the path of a song, or an empty string for plain paths
+func scheme(path string) string {
+	index := strings.Index(path, "://")
+	if index < 0 {
+		return ""
+	}
+
+	return strings.ToLower(path[:index])
+}
+
+// authorization is the value of the Authorization header for the token
+func authorization(token string) string {
+	return "Bearer " + token
+}
@@ -0,0 +1,397 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	callTimeout = 10 * time.Second
+	// loadTimeout is how long the agent may take to start a song
+	loadTimeout         = time.Minute
+	connectTimeout      = 5 * time.Second
+	reconnectMinBackoff = time.Second
+	reconnectMaxBackoff = 30 * time.Second
+)
+
+var errNotConnected = music.TemporaryError{Err: errors.New("not connected to the agent")}
+
+// Provider plays songs on a player on another machine, through the agent running there. The
+// connection is checked with pings and restored when it is lost. The song that is playing
+// continues on the agent in the meantime.
+type Provider struct {
+	address string
+	token   string
+
+	lock       sync.Mutex
+	connection *connection
+	nextID     int
+	pending    map[int]chan frame
+	stopping   bool
+
+	// schemes are the url schemes the agent said it can play, nil until it said so
+	schemes map[string]bool
+
+	// sequence is the song Wait is waiting for, ended is closed when it ends
+	sequence  int
+	ended     chan struct{}
+	lastEnded int
+}
+
+// New creates a provider for the agent at the websocket address, like ws://speakers:8100/agent or
+// wss://speakers:8100/agent when the agent serves TLS
+func New(address string, token string) *Provider {
+	return &Provider{
+		address: address,
+		token:   token,
+		pending: make(map[int]chan frame),
+	}
+}
+
+// Start connects to the agent. When the agent can not be reached it keeps trying in the
+// background, so the bot starts anyway.
+func (provider *Provider) Start() error {
+	connected := make(chan struct{})
+	go provider.connectLoop(connected)
+
+	select {
+	case <-connected:
+	case <-time.After(connectTimeout):
+		log.Printf("Remote: unable to connect to %s yet, continuing in the background", provider.address)
+	}
+
+	return nil
+}
+
+// connectLoop keeps the connection to the agent alive until the provider is stopped
+func (provider *Provider) connectLoop(connected chan struct{}) {
+	backoff := reconnectMinBackoff
+	header := http.Header{}
+	header.Set("Authorization", authorization(provider.token))
+
+	for {
+		provider.lock.Lock()
+		stopping := provider.stopping
+		provider.lock.Unlock()
+
+		if stopping {
+			return
+		}
+
+		socket, _, err := websocket.DefaultDialer.Dial(provider.address, header)
+		if err != nil {
+			log.Printf("Remote: unable to connect to %s, trying again in %s: %v", provider.address, backoff, err)
+			time.Sleep(backoff)
+
+			backoff *= 2
+			if backoff > reconnectMaxBackoff {
+				backoff = reconnectMaxBackoff
+			}
+
+			continue
+		}
+
+		log.Printf("Remote: connected to %s", provider.address)
+		backoff = reconnectMinBackoff
+
+		current := &connection{socket: socket}
+		provider.lock.Lock()
+		provider.connection = current
+		provider.lock.Unlock()
+
+		if connected != nil {
+			close(connected)
+			connected = nil
+		}
+
+		err = provider.readLoop(current)
+		log.Printf("Remote: lost the connection to %s: %v", provider.address, err)
+
+		provider.disconnected(current)
+	}
+}
+
+// readLoop handles the frames of the agent until the connection fails. The agent is pinged
+// periodically, a connection that hangs is closed when the pongs stop.
+func (provider *Provider) readLoop(current *connection) error {
+	socket := current.socket
+
+	_ = socket.SetReadDeadline(time.Now().Add(pongTimeout))
+	socket.SetPongHandler(func(string) error {
+		return socket.SetReadDeadline(time.Now().Add(pongTimeout))
+	})
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		ticker := time.NewTicker(pingInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				current.lock.Lock()
+				err := socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout))
+				current.lock.Unlock()
+
+				if err != nil {
+					_ = socket.Close()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		var message frame
+		if err := socket.ReadJSON(&message); err != nil {
+			return err
+		}
+
+		switch message.Event {
+		case eventHello:
+			// the song might have ended while the connection was gone
+			provider.lock.Lock()
+			if provider.sequence != 0 && provider.sequence != message.Sequence {
+				provider.endSong(provider.sequence)
+			}
+
+			// a restarted agent counts its songs from the start again
+			provider.lastEnded = 0
+
+			// agents that don't list their schemes are asked nothing, PlaySong will tell
+			if message.Schemes != nil {
+				provider.schemes = make(map[string]bool, len(message.Schemes))
+				for _, name := range message.Schemes {
+					provider.schemes[name] = true
+				}
+			}
+			provider.lock.Unlock()
+		case eventSongEnded:
+			provider.lock.Lock()
+			provider.endSong(message.Sequence)
+			provider.lock.Unlock()
+		default:
+			provider.lock.Lock()
+			response, exists := provider.pending[message.ID]
+			delete(provider.pending, message.ID)
+			provider.lock.Unlock()
+
+			if exists {
+				response <- message
+			}
+		}
+	}
+}
+
+// disconnected cleans up the connection and fails the calls waiting for an answer
+func (provider *Provider) disconnected(current *connection) {
+	_ = current.socket.Close()
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	if provider.connection == current {
+		provider.connection = nil
+	}
+
+	for id, response := range provider.pending {
+		close(response)
+		delete(provider.pending, id)
+	}
+}
+
+// endSong releases Wait when the song it waits for ended. The lock must be held.
+func (provider *Provider) endSong(sequence int) {
+	if sequence > provider.lastEnded {
+		provider.lastEnded = sequence
+	}
+
+	if sequence != provider.sequence || provider.ended == nil {
+		return
+	}
+
+	close(provider.ended)
+	provider.ended = nil
+	provider.sequence = 0
+}
+
+// call sends the request to the agent and waits for the response
+func (provider *Provider) call(request frame, timeout time.Duration) (frame, error) {
+	provider.lock.Lock()
+	current := provider.connection
+	if current == nil {
+		provider.lock.Unlock()
+		return frame{}, errNotConnected
+	}
+
+	provider.nextID++
+	request.ID = provider.nextID
+	response := make(chan frame, 1)
+	provider.pending[request.ID] = response
+	provider.lock.Unlock()
+
+	forget := func() {
+		provider.lock.Lock()
+		delete(provider.pending, request.ID)
+		provider.lock.Unlock()
+	}
+
+	if err := current.write(request); err != nil {
+		forget()
+		return frame{}, fmt.Errorf("unable to send %s to the agent: %v", request.Method, err)
+	}
+
+	select {
+	case result, open := <-response:
+		if !open {
+			return frame{}, errNotConnected
+		}
+
+		if result.Error != "" {
+			return result, errors.New(result.Error)
+		}
+
+		return result, nil
+	case <-time.After(timeout):
+		forget()
+		return frame{}, music.TemporaryError{Err: fmt.Errorf("the agent did not answer %s within %s", request.Method, timeout)}
+	}
+}
+
+// CanPlay decides using the schemes the agent listed when it last connected, so songs can be
+// added while the agent is unreachable. Before the agent connected every song is accepted,
+// PlaySong fails with a temporary error until it does.
+func (provider *Provider) CanPlay(song music.Song) bool {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	if provider.schemes == nil {
+		return true
+	}
+
+	return provider.schemes[scheme(song.Path)]
+}
+
+func (provider *Provider) PlaySong(song music.Song) error {
+	response, err := provider.call(frame{Method: methodPlaySong, Song: &song}, loadTimeout)
+	if err != nil {
+		return err
+	}
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.sequence = response.Sequence
+	provider.ended = make(chan struct{})
+
+	// very short songs might have ended already
+	if response.Sequence <= provider.lastEnded {
+		provider.endSong(response.Sequence)
+	}
+
+	return nil
+}
+
+func (provider *Provider) Prefetch(song *music.Song) error {
+	_, err := provider.call(frame{Method: methodPrefetch, Song: song}, callTimeout)
+	return err
+}
+
+func (provider *Provider) Play() error {
+	_, err := provider.call(frame{Method: methodPlay}, callTimeout)
+	return err
+}
+
+func (provider *Provider) Pause() error {
+	_, err := provider.call(frame{Method: methodPause}, callTimeout)
+	return err
+}
+
+func (provider *Provider) Skip() error {
+	_, err := provider.call(frame{Method: methodSkip}, callTimeout)
+	return err
+}
+
+func (provider *Provider) Seek(position time.Duration) error {
+	_, err := provider.call(frame{Method: methodSeek, Position: position}, callTimeout)
+	return err
+}
+
+func (provider *Provider) SeekRelative(offset time.Duration) error {
+	_, err := provider.call(frame{Method: methodSeekRelative, Position: offset}, callTimeout)
+	return err
+}
+
+func (provider *Provider) Position() (time.Duration, error) {
+	response, err := provider.call(frame{Method: methodPosition}, callTimeout)
+	return response.Position, err
+}
+
+func (provider *Provider) Duration() (time.Duration, error) {
+	response, err := provider.call(frame{Method: methodDuration}, callTimeout)
+	return response.Duration, err
+}
+
+func (provider *Provider) GetVolume() (int, error) {
+	response, err := provider.call(frame{Method: methodGetVolume}, callTimeout)
+	return response.Volume, err
+}
+
+func (provider *Provider) SetVolume(percentage int) error {
+	_, err := provider.call(frame{Method: methodSetVolume, Volume: percentage}, callTimeout)
+	return err
+}
+
+func (provider *Provider) SetSpeed(speed float64) error {
+	_, err := provider.call(frame{Method: methodSetSpeed, Speed: speed}, callTimeout)
+	return err
+}
+
+func (provider *Provider) AudioDevices() ([]music.AudioDevice, error) {
+	response, err := provider.call(frame{Method: methodAudioDevices}, callTimeout)
+	return response.Devices, err
+}
+
+func (provider *Provider) SetAudioDevice(name string) error {
+	_, err := provider.call(frame{Method: methodSetAudioDevice, Device: name}, callTimeout)
+	return err
+}
+
+// Wait waits until the song that was started last ends
+func (provider *Provider) Wait() {
+	provider.lock.Lock()
+	ended := provider.ended
+	provider.lock.Unlock()
+
+	if ended != nil {
+		<-ended
+	}
+}
+
+// Stop stops the music on the agent and disconnects. The agent keeps running.
+func (provider *Provider) Stop() {
+	if err := provider.Skip(); err != nil {
+		log.Printf("Remote: unable to stop the music on the agent: %v", err)
+	}
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.stopping = true
+	provider.endSong(provider.sequence)
+
+	if provider.connection != nil {
+		_ = provider.connection.socket.Close()
+	}
+}
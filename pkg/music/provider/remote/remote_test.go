@@ -0,0 +1,252 @@
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// fakeProvider plays songs until end is called
+type fakeProvider struct {
+	music.Provider
+
+	lock   sync.Mutex
+	volume int
+	song   *music.Song
+	ended  chan struct{}
+}
+
+// CanPlay only plays https urls
+func (provider *fakeProvider) CanPlay(song music.Song) bool {
+	return strings.HasPrefix(song.Path, "https://")
+}
+
+func (provider *fakeProvider) PlaySong(song music.Song) error {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.song = &song
+	provider.ended = make(chan struct{})
+	return nil
+}
+
+func (provider *fakeProvider) Wait() {
+	provider.lock.Lock()
+	ended := provider.ended
+	provider.lock.Unlock()
+
+	<-ended
+}
+
+func (provider *fakeProvider) end() {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	close(provider.ended)
+}
+
+func (provider *fakeProvider) Skip() error {
+	return nil
+}
+
+func (provider *fakeProvider) SetVolume(percentage int) error {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.volume = percentage
+	return nil
+}
+
+func (provider *fakeProvider) GetVolume() (int, error) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	return provider.volume, nil
+}
+
+func startAgent(t *testing.T, provider music.Provider) (*httptest.Server, string) {
+	server := httptest.NewServer(NewAgent(provider, "secret"))
+	t.Cleanup(server.Close)
+
+	return server, "ws" + strings.TrimPrefix(server.URL, "http")
+}
+
+func TestProvider(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeProvider{}
+	_, address := startAgent(t, fake)
+
+	provider := New(address, "secret")
+	assert.NoError(t, provider.Start())
+	defer provider.Stop()
+
+	assert.NoError(t, provider.SetVolume(42))
+	volume, err := provider.GetVolume()
+	assert.NoError(t, err)
+	assert.Equal(t, 42, volume)
+
+	// optional capabilities the player of the agent lacks are reported as errors
+	assert.Error(t, provider.SetSpeed(1.05))
+
+	assert.NoError(t, provider.PlaySong(music.Song{Name: "song", Path: "https://example.com/song"}))
+	assert.Equal(t, "song", fake.song.Name)
+
+	waited := make(chan struct{})
+	go func() {
+		provider.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+		t.Fatal("Wait returned before the song ended")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	fake.end()
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the song ended")
+	}
+}
+
+func TestProvider_CanPlay(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeProvider{}
+	server, address := startAgent(t, fake)
+
+	provider := New(address, "secret")
+
+	// nothing is known before the agent said hello
+	assert.True(t, provider.CanPlay(music.Song{Path: "ftp://example.com/song"}))
+
+	assert.NoError(t, provider.Start())
+	defer provider.Stop()
+
+	assert.Eventually(t, func() bool {
+		return !provider.CanPlay(music.Song{Path: "ftp://example.com/song"})
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, provider.CanPlay(music.Song{Path: "HTTPS://example.com/song"}))
+	assert.False(t, provider.CanPlay(music.Song{Path: "song.mp3"}))
+
+	// the schemes are remembered while the agent is unreachable
+	server.Close()
+	assert.True(t, provider.CanPlay(music.Song{Path: "https://example.com/song"}))
+}
+
+func TestProvider_Reconnect(t *testing.T) {
+	t.Parallel()
+
+	fake := &fakeProvider{}
+	server, address := startAgent(t, fake)
+
+	provider := New(address, "secret")
+	assert.NoError(t, provider.Start())
+	defer provider.Stop()
+
+	assert.NoError(t, provider.PlaySong(music.Song{Name: "song"}))
+
+	// the song ends while the connection is gone, which the hello tells after reconnecting
+	server.CloseClientConnections()
+	fake.end()
+
+	waited := make(chan struct{})
+	go func() {
+		provider.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Wait did not return after reconnecting")
+	}
+
+	assert.Eventually(t, func() bool {
+		return provider.SetVolume(10) == nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+func TestAgent_Token(t *testing.T) {
+	t.Parallel()
+
+	_, address := startAgent(t, &fakeProvider{})
+
+	header := http.Header{}
+	header.Set("Authorization", authorization("wrong"))
+
+	_, response, err := websocket.DefaultDialer.Dial(address, header)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+// blockingProvider does not finish starting a song until it is released
+type blockingProvider struct {
+	fakeProvider
+	release chan struct{}
+}
+
+func (provider *blockingProvider) PlaySong(song music.Song) error {
+	<-provider.release
+	return provider.fakeProvider.PlaySong(song)
+}
+
+func TestAgent_Busy(t *testing.T) {
+	t.Parallel()
+
+	fake := &blockingProvider{release: make(chan struct{})}
+	defer close(fake.release)
+	_, address := startAgent(t, fake)
+
+	header := http.Header{}
+	header.Set("Authorization", authorization("secret"))
+
+	socket, _, err := websocket.DefaultDialer.Dial(address, header)
+	assert.NoError(t, err)
+	defer socket.Close()
+
+	var hello frame
+	assert.NoError(t, socket.ReadJSON(&hello))
+	assert.Equal(t, eventHello, hello.Event)
+
+	// the first request is being handled, the next ones wait until the buffer is full
+	song := &music.Song{Path: "https://example.com/song"}
+	for id := 1; id <= requestBuffer+2; id++ {
+		assert.NoError(t, socket.WriteJSON(frame{ID: id, Method: methodPlaySong, Song: song}))
+	}
+
+	var response frame
+	assert.NoError(t, socket.ReadJSON(&response))
+	assert.Greater(t, response.ID, requestBuffer)
+	assert.Equal(t, errBusy.Error(), response.Error)
+
+	// pings are still answered
+	pong := make(chan struct{}, 1)
+	socket.SetPongHandler(func(string) error {
+		pong <- struct{}{}
+		return nil
+	})
+	assert.NoError(t, socket.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)))
+
+	go func() {
+		_ = socket.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, _ = socket.ReadMessage()
+	}()
+
+	select {
+	case <-pong:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the ping was not answered")
+	}
+}
@@ -0,0 +1,192 @@
+package stream
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// icyMetaInt is the amount of audio bytes between two ICY metadata blocks
+	icyMetaInt = 16000
+	// clientBuffer is the amount of chunks buffered for a client before it is dropped
+	clientBuffer = 50
+)
+
+type client struct {
+	chunks chan []byte
+}
+
+// broadcaster sends the audio to every connected listener
+type broadcaster struct {
+	name  string
+	lock  sync.Mutex
+	title string
+
+	clients map[*client]struct{}
+}
+
+func newBroadcaster(name string) *broadcaster {
+	return &broadcaster{
+		name:    name,
+		clients: make(map[*client]struct{}),
+	}
+}
+
+func (broadcaster *broadcaster) setTitle(title string) {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+
+	broadcaster.title = title
+}
+
+func (broadcaster *broadcaster) getTitle() string {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+
+	return broadcaster.title
+}
+
+// write sends the chunk to every listener. Listeners that can not keep up are dropped.
+func (broadcaster *broadcaster) write(chunk []byte) {
+	broadcaster.lock.Lock()
+	defer broadcaster.lock.Unlock()
+
+	for client := range broadcaster.clients {
+		select {
+		case client.chunks <- chunk:
+		default:
+			log.Println("Stream: dropping a listener that can not keep up")
+			delete(broadcaster.clients, client)
+			close(client.chunks)
+		}
+	}
+}
+
+func (broadcaster *broadcaster) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	client := &client{chunks: make(chan []byte, clientBuffer)}
+
+	broadcaster.lock.Lock()
+	broadcaster.clients[client] = struct{}{}
+	broadcaster.lock.Unlock()
+
+	defer func() {
+		broadcaster.lock.Lock()
+		if _, exists := broadcaster.clients[client]; exists {
+			delete(broadcaster.clients, client)
+			close(client.chunks)
+		}
+		broadcaster.lock.Unlock()
+	}()
+
+	log.Printf("Stream: listener connected from %s", request.RemoteAddr)
+
+	writer.Header().Set("Content-Type", "audio/mpeg")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("icy-name", broadcaster.name)
+
+	var output io.Writer = writer
+	if request.Header.Get("Icy-MetaData") == "1" {
+		writer.Header().Set("icy-metaint", strconv.Itoa(icyMetaInt))
+		output = &icyWriter{
+			writer:    writer,
+			metaInt:   icyMetaInt,
+			remaining: icyMetaInt,
+			title:     broadcaster.getTitle,
+		}
+	}
+
+	writer.WriteHeader(http.StatusOK)
+	flusher, _ := writer.(http.Flusher)
+
+	for {
+		select {
+		case chunk, open := <-client.chunks:
+			if !open {
+				return
+			}
+
+			if _, err := output.Write(chunk); err != nil {
+				log.Printf("Stream: listener %s disconnected: %v", request.RemoteAddr, err)
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-request.Context().Done():
+			log.Printf("Stream: listener %s disconnected", request.RemoteAddr)
+			return
+		}
+	}
+}
+
+// icyWriter inserts ICY metadata with the title of the song every metaInt bytes of audio
+type icyWriter struct {
+	writer    io.Writer
+	metaInt   int
+	remaining int
+	title     func() string
+	lastTitle string
+}
+
+func (writer *icyWriter) Write(data []byte) (int, error) {
+	written := 0
+
+	for len(data) > 0 {
+		size := len(data)
+		if size > writer.remaining {
+			size = writer.remaining
+		}
+
+		if _, err := writer.writer.Write(data[:size]); err != nil {
+			return written, err
+		}
+
+		written += size
+		data = data[size:]
+		writer.remaining -= size
+
+		if writer.remaining == 0 {
+			if _, err := writer.writer.Write(writer.metadata()); err != nil {
+				return written, err
+			}
+
+			writer.remaining = writer.metaInt
+		}
+	}
+
+	return written, nil
+}
+
+// metadata returns the next metadata block, which is empty when the title did not change
+func (writer *icyWriter) metadata() []byte {
+	title := writer.title()
+	if title == writer.lastTitle {
+		return []byte{0}
+	}
+
+	writer.lastTitle = title
+	return icyMetadata(title)
+}
+
+// icyMetadata encodes the title as an ICY metadata block: a byte with the length divided by 16,
+// followed by the text padded with zeroes
+func icyMetadata(title string) []byte {
+	const maxLength = 255 * 16
+
+	text := "StreamTitle='" + strings.ReplaceAll(title, "'", "`") + "';"
+	if len(text) > maxLength {
+		text = text[:maxLength-2] + "';"
+	}
+
+	blocks := (len(text) + 15) / 16
+	data := make([]byte, 1+blocks*16)
+	data[0] = byte(blocks)
+	copy(data[1:], text)
+
+	return data
+}
@@ -0,0 +1,47 @@
+package stream
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIcyMetadata(t *testing.T) {
+	t.Parallel()
+
+	metadata := icyMetadata("Rick Astley - Never Gonna Give You Up")
+	text := "StreamTitle='Rick Astley - Never Gonna Give You Up';"
+
+	assert.Equal(t, byte(4), metadata[0])
+	assert.Len(t, metadata, 1+4*16)
+	assert.Equal(t, text, string(bytes.TrimRight(metadata[1:], "\x00")))
+
+	// quotes would end the title early
+	assert.Contains(t, string(icyMetadata("Don't Stop Me Now")), "StreamTitle='Don`t Stop Me Now';")
+}
+
+func TestIcyWriter(t *testing.T) {
+	t.Parallel()
+
+	var output bytes.Buffer
+	writer := &icyWriter{
+		writer:    &output,
+		metaInt:   4,
+		remaining: 4,
+		title:     func() string { return "a" },
+	}
+
+	written, err := writer.Write([]byte("123456789"))
+	assert.NoError(t, err)
+	assert.Equal(t, 9, written)
+
+	// the title is sent once, after that empty blocks are sent until it changes
+	expected := append([]byte("1234"), icyMetadata("a")...)
+	expected = append(expected, []byte("5678")...)
+	expected = append(expected, 0)
+	expected = append(expected, '9')
+
+	assert.Equal(t, expected, output.Bytes())
+	assert.Equal(t, 3, writer.remaining)
+}
@@ -0,0 +1,437 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+const (
+	// chunkDuration is the amount of audio sent to the listeners at once
+	chunkDuration   = 100 * time.Millisecond
+	maxLoadTimeout  = 30 * time.Second
+	silenceSource   = "av://lavfi:anullsrc=r=44100:cl=stereo"
+	silenceDuration = time.Second
+)
+
+var errNothingPlaying = errors.New("nothing is playing on the stream")
+
+// Config configures the stream
+type Config struct {
+	// MpvPath is used to decode the songs and encode them to mp3
+	MpvPath string
+	// Listen is the address the http server listens on, like :8000
+	Listen string
+	// Path is the path of the stream, like /stream.mp3
+	Path string
+	// Name is shown by the players of the listeners
+	Name string
+	// Bitrate of the stream in kbit/s
+	Bitrate int
+}
+
+// Provider plays songs by streaming them over http, so the music can be heard from anywhere.
+// The songs are encoded by mpv and sent to the listeners in real time. Silence is sent while
+// nothing is playing so the listeners stay connected.
+type Provider struct {
+	config      Config
+	broadcaster *broadcaster
+	server      *http.Server
+	silence     []byte
+
+	lock    sync.Mutex
+	decoder *exec.Cmd
+	source  *bufio.Reader
+	done    chan struct{}
+	// song is the song that is playing, it is decoded again to seek or to change the volume.
+	// restarts counts those restarts, so only the last one is used.
+	song     *music.Song
+	restarts int
+	paused   bool
+	stopped  bool
+	volume   int
+	position time.Duration
+}
+
+func New(config Config) *Provider {
+	return &Provider{
+		config:      config,
+		broadcaster: newBroadcaster(config.Name),
+		volume:      100,
+	}
+}
+
+// Start the http server and start streaming silence
+func (provider *Provider) Start() error {
+	silence, err := provider.encode(silenceSource, fmt.Sprintf("--length=%d", int(silenceDuration.Seconds()))).Output()
+	if err != nil {
+		log.Printf("Stream: unable to encode silence, listeners might disconnect between songs: %v", err)
+	}
+	provider.silence = silence
+
+	mux := http.NewServeMux()
+	mux.Handle(provider.config.Path, provider.broadcaster)
+
+	provider.server = &http.Server{
+		Addr:    provider.config.Listen,
+		Handler: mux,
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- provider.server.ListenAndServe()
+	}()
+
+	// give the server a moment to fail, for example when the port is in use
+	select {
+	case err := <-errs:
+		return fmt.Errorf("unable to start the stream server: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	log.Printf("Stream: listening on %s%s", provider.config.Listen, provider.config.Path)
+
+	go provider.run()
+
+	return nil
+}
+
+// encode creates an mpv process that encodes the source to mp3 on its stdout
+func (provider *Provider) encode(source string, arguments ...string) *exec.Cmd {
+	arguments = append([]string{
+		"--no-config",
+		"--no-video",
+		"--no-terminal",
+		"--ytdl-format=bestaudio/best",
+		"--o=-",
+		"--of=mp3",
+		"--oac=libmp3lame",
+		"--oacopts=b=" + strconv.Itoa(provider.config.Bitrate) + "k",
+		"--audio-samplerate=44100",
+		"--audio-channels=stereo",
+	}, arguments...)
+
+	return exec.Command(provider.config.MpvPath, append(arguments, source)...)
+}
+
+func (provider *Provider) bytesPerSecond() int {
+	return provider.config.Bitrate * 1000 / 8
+}
+
+// run sends the audio to the listeners in real time
+func (provider *Provider) run() {
+	chunkSize := int(int64(provider.bytesPerSecond()) * int64(chunkDuration) / int64(time.Second))
+	buffer := make([]byte, chunkSize)
+	next := time.Now()
+
+	for {
+		provider.lock.Lock()
+		if provider.stopped {
+			provider.lock.Unlock()
+			return
+		}
+
+		source := provider.source
+		if provider.paused {
+			source = nil
+		}
+		provider.lock.Unlock()
+
+		var chunk []byte
+		if source != nil {
+			size, err := io.ReadFull(source, buffer)
+			chunk = buffer[:size]
+			provider.advance(source, size, err)
+		}
+
+		if len(chunk) == 0 {
+			chunk = provider.silence
+		}
+
+		if len(chunk) == 0 {
+			time.Sleep(chunkDuration)
+			continue
+		}
+
+		// the listeners keep their own copy as the buffer is reused
+		provider.broadcaster.write(append([]byte(nil), chunk...))
+
+		next = next.Add(time.Duration(len(chunk)) * time.Second / time.Duration(provider.bytesPerSecond()))
+		wait := time.Until(next)
+		if wait > 0 {
+			time.Sleep(wait)
+		} else if wait < -time.Second {
+			// reading the song took a while, don't try to catch up
+			next = time.Now()
+		}
+	}
+}
+
+// advance updates the position in the song that is being read, and ends the song when the
+// source is exhausted
+func (provider *Provider) advance(source *bufio.Reader, size int, err error) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	// another song might have started in the meantime
+	if source != provider.source {
+		return
+	}
+
+	provider.position += time.Duration(size) * time.Second / time.Duration(provider.bytesPerSecond())
+
+	if err != nil {
+		provider.endSong()
+	}
+}
+
+// endSong stops the decoder and tells Wait the song ended. The lock must be held.
+func (provider *Provider) endSong() {
+	if provider.decoder != nil {
+		_ = provider.decoder.Process.Kill()
+		go provider.decoder.Wait()
+		provider.decoder = nil
+	}
+
+	provider.source = nil
+	provider.song = nil
+
+	if provider.done != nil {
+		close(provider.done)
+		provider.done = nil
+	}
+}
+
+func (provider *Provider) CanPlay(song music.Song) bool {
+	return true
+}
+
+// PlaysLocally is true, the stream is decoded on the machine of the bot
+func (provider *Provider) PlaysLocally() bool {
+	return true
+}
+
+// SetVolume sets the volume of the stream. The current song is decoded again at the new volume.
+func (provider *Provider) SetVolume(percentage int) error {
+	provider.lock.Lock()
+	provider.volume = percentage
+	playing := provider.song != nil
+	position := provider.position
+	provider.lock.Unlock()
+
+	if !playing {
+		return nil
+	}
+
+	return provider.restart(position)
+}
+
+func (provider *Provider) GetVolume() (int, error) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	return provider.volume, nil
+}
+
+func (provider *Provider) PlaySong(song music.Song) error {
+	provider.lock.Lock()
+	provider.endSong()
+	volume := provider.volume
+	provider.lock.Unlock()
+
+	decoder, source, err := provider.decode(song, 0, volume)
+	if err != nil {
+		return err
+	}
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.decoder = decoder
+	provider.source = source
+	provider.done = make(chan struct{})
+	provider.song = &song
+	provider.position = 0
+	provider.broadcaster.setTitle(fmt.Sprintf("%s - %s", song.Artist, song.Name))
+
+	return nil
+}
+
+// decode starts decoding the song from the position. It waits for the first audio, so songs that
+// can not be decoded fail right away.
+func (provider *Provider) decode(song music.Song, position time.Duration, volume int) (*exec.Cmd, *bufio.Reader, error) {
+	arguments := []string{"--volume=" + strconv.Itoa(volume)}
+	if position > 0 {
+		arguments = append(arguments, "--start="+strconv.FormatFloat(position.Seconds(), 'f', 3, 64))
+	}
+
+	decoder := provider.encode(song.Path, arguments...)
+	stdout, err := decoder.StdoutPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := decoder.Start(); err != nil {
+		return nil, nil, fmt.Errorf("unable to start the decoder: %v", err)
+	}
+
+	source := bufio.NewReaderSize(stdout, provider.bytesPerSecond())
+
+	loaded := make(chan error, 1)
+	go func() {
+		_, err := source.Peek(1)
+		loaded <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), maxLoadTimeout)
+	defer cancel()
+
+	select {
+	case err = <-loaded:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		_ = decoder.Process.Kill()
+		go decoder.Wait()
+		return nil, nil, fmt.Errorf("unable to decode %s: %v", song.Path, err)
+	}
+
+	return decoder, source, nil
+}
+
+// restart decodes the current song again from the position. The listeners hear the previous
+// decoder until the new one has audio.
+func (provider *Provider) restart(position time.Duration) error {
+	provider.lock.Lock()
+	song := provider.song
+	volume := provider.volume
+	provider.restarts++
+	restart := provider.restarts
+	provider.lock.Unlock()
+
+	if song == nil {
+		return errNothingPlaying
+	}
+
+	decoder, source, err := provider.decode(*song, position, volume)
+	if err != nil {
+		return err
+	}
+
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	// the song ended, another song started or a later restart is already running
+	if provider.song != song || provider.restarts != restart {
+		_ = decoder.Process.Kill()
+		go decoder.Wait()
+		return nil
+	}
+
+	if provider.decoder != nil {
+		_ = provider.decoder.Process.Kill()
+		go provider.decoder.Wait()
+	}
+
+	provider.decoder = decoder
+	provider.source = source
+	provider.position = position
+
+	return nil
+}
+
+// Prefetch does nothing, the stream continues with silence until the next song starts
+func (provider *Provider) Prefetch(song *music.Song) error {
+	return nil
+}
+
+func (provider *Provider) Play() error {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.paused = false
+	return nil
+}
+
+func (provider *Provider) Pause() error {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.paused = true
+	return nil
+}
+
+func (provider *Provider) Skip() error {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.endSong()
+	provider.broadcaster.setTitle("")
+
+	return nil
+}
+
+// Seek decodes the current song again from the position
+func (provider *Provider) Seek(position time.Duration) error {
+	return provider.restart(position)
+}
+
+// SeekRelative decodes the current song again from the position plus the offset
+func (provider *Provider) SeekRelative(offset time.Duration) error {
+	provider.lock.Lock()
+	position := provider.position + offset
+	provider.lock.Unlock()
+
+	if position < 0 {
+		position = 0
+	}
+
+	return provider.restart(position)
+}
+
+// Position returns how much of the current song has been sent to the listeners
+func (provider *Provider) Position() (time.Duration, error) {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	return provider.position, nil
+}
+
+// Duration is not known, the duration provided by the data provider is used instead
+func (provider *Provider) Duration() (time.Duration, error) {
+	return 0, errors.New("the stream does not know the duration of songs")
+}
+
+func (provider *Provider) Wait() {
+	provider.lock.Lock()
+	done := provider.done
+	provider.lock.Unlock()
+
+	if done != nil {
+		<-done
+	}
+}
+
+func (provider *Provider) Stop() {
+	provider.lock.Lock()
+	defer provider.lock.Unlock()
+
+	provider.stopped = true
+	provider.endSong()
+
+	if provider.server != nil {
+		_ = provider.server.Close()
+	}
+}
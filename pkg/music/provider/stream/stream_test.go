@@ -0,0 +1,133 @@
+package stream
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/svenwiltink/go-musicbot/pkg/music"
+)
+
+// fakeMpv writes a script that logs its arguments and outputs silence instead of decoding, songs
+// containing fail can't be decoded
+func fakeMpv(t *testing.T) (*Provider, string) {
+	directory := t.TempDir()
+	arguments := filepath.Join(directory, "arguments")
+	script := filepath.Join(directory, "mpv")
+
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+echo "$@" >> `+arguments+`
+case "$*" in *fail*) exit 1;; esac
+head -c 5000 /dev/zero
+`), 0o755)
+	assert.NoError(t, err)
+
+	// 1000 bytes per second
+	provider := New(Config{MpvPath: script, Bitrate: 8})
+	t.Cleanup(provider.Stop)
+
+	return provider, arguments
+}
+
+func lastArguments(t *testing.T, file string) string {
+	content, err := os.ReadFile(file)
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	return lines[len(lines)-1]
+}
+
+func TestProvider_PlaySong(t *testing.T) {
+	t.Parallel()
+
+	provider, arguments := fakeMpv(t)
+
+	assert.NoError(t, provider.SetVolume(40))
+	assert.NoError(t, provider.PlaySong(music.Song{Artist: "Rick Astley", Name: "Never Gonna Give You Up", Path: "song.mp3"}))
+	assert.Contains(t, lastArguments(t, arguments), "--volume=40")
+	assert.True(t, strings.HasSuffix(lastArguments(t, arguments), "song.mp3"))
+	assert.NotNil(t, provider.source)
+
+	assert.Error(t, provider.PlaySong(music.Song{Path: "fail.mp3"}))
+}
+
+func TestProvider_Advance(t *testing.T) {
+	t.Parallel()
+
+	provider, _ := fakeMpv(t)
+
+	assert.NoError(t, provider.PlaySong(music.Song{Path: "song.mp3"}))
+	source := provider.source
+
+	provider.advance(source, 1500, nil)
+	position, err := provider.Position()
+	assert.NoError(t, err)
+	assert.Equal(t, 1500*time.Millisecond, position)
+
+	// a source of a previous song does not affect the current one
+	provider.advance(bufio.NewReader(strings.NewReader("")), 1000, io.EOF)
+	position, _ = provider.Position()
+	assert.Equal(t, 1500*time.Millisecond, position)
+
+	provider.advance(source, 500, io.EOF)
+	position, _ = provider.Position()
+	assert.Equal(t, 2*time.Second, position)
+	assert.Nil(t, provider.source)
+
+	waited := make(chan struct{})
+	go func() {
+		provider.Wait()
+		close(waited)
+	}()
+
+	select {
+	case <-waited:
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the song ended")
+	}
+}
+
+func TestProvider_Seek(t *testing.T) {
+	t.Parallel()
+
+	provider, arguments := fakeMpv(t)
+
+	assert.ErrorIs(t, provider.Seek(time.Second), errNothingPlaying)
+
+	assert.NoError(t, provider.PlaySong(music.Song{Path: "song.mp3"}))
+	source := provider.source
+
+	assert.NoError(t, provider.Seek(30*time.Second))
+	assert.Contains(t, lastArguments(t, arguments), "--start=30.000")
+	assert.NotSame(t, source, provider.source)
+
+	position, _ := provider.Position()
+	assert.Equal(t, 30*time.Second, position)
+
+	assert.NoError(t, provider.SeekRelative(-40*time.Second))
+	assert.NotContains(t, lastArguments(t, arguments), "--start")
+
+	position, _ = provider.Position()
+	assert.Equal(t, time.Duration(0), position)
+}
+
+func TestProvider_SetVolume(t *testing.T) {
+	t.Parallel()
+
+	provider, arguments := fakeMpv(t)
+
+	assert.NoError(t, provider.PlaySong(music.Song{Path: "song.mp3"}))
+	provider.advance(provider.source, 2000, nil)
+
+	// the song is decoded again at the new volume from the current position
+	assert.NoError(t, provider.SetVolume(60))
+	assert.Contains(t, lastArguments(t, arguments), "--volume=60 --start=2.000")
+
+	volume, _ := provider.GetVolume()
+	assert.Equal(t, 60, volume)
+}
@@ -14,6 +14,9 @@ import (
 const (
 	songAdded   eventemitter.EventType = "song-added"
 	songDeleted eventemitter.EventType = "song-deleted"
+
+	// EventQueueChanged is emitted whenever songs are added, removed or reordered
+	EventQueueChanged eventemitter.EventType = "queue-changed"
 )
 
 var (
@@ -36,6 +39,18 @@ func (queue *Queue) Append(songs ...Song) {
 	queue.songs = append(queue.songs, songs...)
 	log.Println("Song added to the queue")
 	queue.EmitEvent(songAdded)
+	queue.EmitEvent(EventQueueChanged)
+}
+
+// Prepend adds the songs to the front of the queue
+func (queue *Queue) Prepend(songs ...Song) {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+
+	queue.songs = append(append(make([]Song, 0, len(songs)+len(queue.songs)), songs...), queue.songs...)
+	log.Println("Song added to the front of the queue")
+	queue.EmitEvent(songAdded)
+	queue.EmitEvent(EventQueueChanged)
 }
 
 func (queue *Queue) Delete(item int) error {
@@ -53,6 +68,7 @@ func (queue *Queue) Delete(item int) error {
 	queue.songs = append(queue.songs[:item], queue.songs[item+1:]...)
 	log.Println("Song deleted from the queue")
 	queue.EmitEvent(songDeleted)
+	queue.EmitEvent(EventQueueChanged)
 
 	return nil
 }
@@ -124,12 +140,14 @@ func (queue *Queue) Shuffle() {
 	queue.randSource.Shuffle(len(queue.songs), func(i, j int) {
 		queue.songs[i], queue.songs[j] = queue.songs[j], queue.songs[i]
 	})
+	queue.EmitEvent(EventQueueChanged)
 }
 
 func (queue *Queue) Flush() {
 	queue.lock.Lock()
 	defer queue.lock.Unlock()
 	queue.songs = make([]Song, 0)
+	queue.EmitEvent(EventQueueChanged)
 }
 
 // WaitForNext is a blocking call that returns the next song in the queue and wait for one to be added
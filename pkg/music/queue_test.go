@@ -36,6 +36,20 @@ func TestQueue_Append(t *testing.T) {
 	assert.Equal(t, queue.songs[0], song)
 }
 
+func TestQueue_Prepend(t *testing.T) {
+	t.Parallel()
+	queue, song1, song2 := getTestQueue()
+
+	song3 := Song{
+		Duration: time.Minute,
+		Name:     "song3",
+	}
+
+	queue.Prepend(song3)
+
+	assert.Equal(t, []Song{song3, song1, song2}, queue.songs)
+}
+
 func TestQueue_Delete(t *testing.T) {
 	newQueue := func() *Queue {
 		queue := NewQueue()